@@ -196,3 +196,17 @@ func GetBundleLists(myacinfo, teamId string, pageNumber, pageSize int) (AppIds,
 	}
 	return list, nil
 }
+
+// listAllAppIds return the app ids of every GetBundleLists page
+func listAllAppIds(myacinfo, teamId string) ([]AppId, error) {
+	var apps []AppId
+	err := readPages(func(pageNumber int) (int, int, int, error) {
+		list, err := GetBundleLists(myacinfo, teamId, pageNumber, listPageSize)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		apps = append(apps, list.AppIds...)
+		return len(list.AppIds), list.TotalRecords, list.PageNumber, nil
+	})
+	return apps, err
+}
@@ -2,6 +2,7 @@ package apple
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
@@ -22,6 +23,7 @@ type CertificateData struct {
 type certificateListRequest struct {
 	Error []map[string]string `json:"errors"`
 	Data  []CertificateData   `json:"data"`
+	apiPage
 }
 
 type certificatDataRequest struct {
@@ -38,6 +40,9 @@ type createCertificatResponse struct {
 	Data  CertificateData     `json:"data"`
 }
 
+// ErrCertificateNotFound no certificate matches the search
+var ErrCertificateNotFound = errors.New("Certificate does not exist")
+
 var pemCSRPrefix = []byte("-----BEGIN")
 
 // CreateCertificate info
@@ -81,8 +86,34 @@ func CreateCertificate(certificateType, csrContent, teamId, myacinfo string) (Ce
 
 // CertLists filter[id] certificateType
 func CertLists(customSearch map[string]string, teamId, myacinfo string) ([]CertificateData, error) {
-	search := BuildSearchQueryString(teamId, customSearch)
+	data, err := queryCertificates(BuildSearchQueryString(teamId, customSearch), myacinfo)
+	if err != nil {
+		return []CertificateData{}, err
+	}
+	return data.Data, nil
+}
+
+// listAllCertificates read every page of the certificates of the team
+func listAllCertificates(teamId, myacinfo string) ([]CertificateData, error) {
+	var certs []CertificateData
+	query := firstPageQuery(teamId)
+	err := readPages(func(int) (int, int, int, error) {
+		data, err := queryCertificates(query, myacinfo)
+		if err == ErrCertificateNotFound {
+			return 0, 0, 0, nil
+		}
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		certs = append(certs, data.Data...)
+		var total int
+		query, total = data.next(teamId, query, len(certs))
+		return len(data.Data), total, 0, nil
+	})
+	return certs, err
+}
 
+func queryCertificates(search, myacinfo string) (certificateListRequest, error) {
 	requestParams := struct {
 		UrlEncodedQueryParams string `json:"urlEncodedQueryParams"`
 	}{
@@ -91,7 +122,7 @@ func CertLists(customSearch map[string]string, teamId, myacinfo string) ([]Certi
 
 	postJson, err := json.Marshal(requestParams)
 	if err != nil {
-		return []CertificateData{}, err
+		return certificateListRequest{}, err
 	}
 
 	// request
@@ -99,23 +130,26 @@ func CertLists(customSearch map[string]string, teamId, myacinfo string) ([]Certi
 	JSONRequestHeader["Cookie"] = "myacinfo=" + myacinfo
 	JSONRequestHeader["X-HTTP-Method-Override"] = "GET"
 	body, _, err := request.SetHeader(JSONRequestHeader).SetBody(postJson).GetBody()
+	if err != nil {
+		return certificateListRequest{}, err
+	}
 
 	var data certificateListRequest
 
 	err = json.Unmarshal(body, &data)
 	if err != nil {
-		return []CertificateData{}, err
+		return certificateListRequest{}, err
 	}
 
 	if len(data.Error) > 0 {
-		return []CertificateData{}, errors.New(data.Error[0]["detail"])
+		return certificateListRequest{}, errors.New(data.Error[0]["detail"])
 	}
 
 	if len(data.Data) <= 0 {
-		return []CertificateData{}, errors.New("Certificate does not exist")
+		return certificateListRequest{}, ErrCertificateNotFound
 	}
 
-	return data.Data, nil
+	return data, nil
 }
 
 // DeleteCertficate
@@ -161,8 +195,13 @@ func DeleteCertficate(Id, teamId, myacinfo string) (bool, error) {
 	return false, errors.New("delete certficate fail")
 }
 
-// ExportCertficate csrContent
+// ExportCertficate csrContent, an "ENCRYPTED PRIVATE KEY" is decrypted with the p12 password
 func ExportCertficate(csrContent, priKey, password string) ([]byte, error) {
+	return ExportCertficateWithKeyPassword(csrContent, priKey, password, password)
+}
+
+// ExportCertficateWithKeyPassword csrContent, an "ENCRYPTED PRIVATE KEY" is decrypted with keyPassword
+func ExportCertficateWithKeyPassword(csrContent, priKey, keyPassword, password string) ([]byte, error) {
 	// format cert
 	if !bytes.HasPrefix([]byte(csrContent), pemCSRPrefix) {
 		csrContent = ContentToPem(csrContent, 64)
@@ -172,33 +211,47 @@ func ExportCertficate(csrContent, priKey, password string) ([]byte, error) {
 	if certBlock == nil {
 		return nil, errors.New("error decoding certificate")
 	}
-	// pri
+	// parse private key
+	parsedKey, err := ParseEncryptedPrivateKey(priKey, keyPassword)
+	if err != nil {
+		return nil, err
+	}
+	// export p12
+	p12, err := pkcs12.Encode(certBlock.Bytes, parsedKey, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return p12, nil
+}
+
+// ParsePrivateKey parse PEM encoded PKCS1, PKCS8 or EC private key
+func ParsePrivateKey(priKey string) (crypto.PrivateKey, error) {
 	priKeyBlock, _ := pem.Decode([]byte(priKey))
 	if priKeyBlock == nil {
 		return nil, errors.New("error decoding private key")
 	}
-	// parse private key
-	var parsedKey interface{}
-	var err error
+	return parsePrivateKeyBlock(priKeyBlock)
+}
+
+func parsePrivateKeyBlock(priKeyBlock *pem.Block) (crypto.PrivateKey, error) {
+	if priKeyBlock.Type == "ENCRYPTED PRIVATE KEY" {
+		return nil, ErrPrivateKeyEncrypted
+	}
 	if priKeyBlock.Type == "EC PRIVATE KEY" {
-		parsedKey, err = x509.ParseECPrivateKey(priKeyBlock.Bytes)
+		parsedKey, err := x509.ParseECPrivateKey(priKeyBlock.Bytes)
 		if err != nil {
 			return nil, errors.New("unable to parse private key to native object")
 		}
-	} else {
-		parsedKey, err = x509.ParsePKCS1PrivateKey(priKeyBlock.Bytes)
-		if err != nil {
-			parsedKey, err = x509.ParsePKCS8PrivateKey(priKeyBlock.Bytes)
-			if err != nil {
-				return nil, fmt.Errorf("private key should be a PEM or plain PKCS1 or PKCS8; parse error: %v", err)
-			}
-		}
+		return parsedKey, nil
 	}
-	// export p12
-	p12, err := pkcs12.Encode(certBlock.Bytes, parsedKey, password)
+	parsedKey, err := x509.ParsePKCS1PrivateKey(priKeyBlock.Bytes)
 	if err != nil {
-		return nil, err
+		pkcs8Key, err := x509.ParsePKCS8PrivateKey(priKeyBlock.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("private key should be a PEM or plain PKCS1 or PKCS8; parse error: %v", err)
+		}
+		return pkcs8Key, nil
 	}
-
-	return p12, nil
+	return parsedKey, nil
 }
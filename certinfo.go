@@ -0,0 +1,115 @@
+package apple
+
+import (
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultExpiryWindow certificates expiring within this window are near expiry
+const DefaultExpiryWindow = 30 * 24 * time.Hour
+
+// certificate common name prefixes mapped to certificate type
+var certTypePrefixes = []struct {
+	prefix   string
+	certType string
+}{
+	{"Apple Development:", "DEVELOPMENT"},
+	{"Apple Distribution:", "DISTRIBUTION"},
+	{"iPhone Developer:", "IOS_DEVELOPMENT"},
+	{"iPhone Distribution:", "IOS_DISTRIBUTION"},
+	{"Mac Developer:", "MAC_APP_DEVELOPMENT"},
+	{"3rd Party Mac Developer Application:", "MAC_APP_DISTRIBUTION"},
+	{"3rd Party Mac Developer Installer:", "MAC_INSTALLER_DISTRIBUTION"},
+	{"Developer ID Application:", "DEVELOPER_ID_APPLICATION"},
+	{"Developer ID Installer:", "DEVELOPER_ID_INSTALLER"},
+	{"Apple Push Services:", "APPLE_PUSH_SERVICES"},
+}
+
+// CertificateInfo certificate metadata
+type CertificateInfo struct {
+	SerialNumber    string
+	TeamID          string
+	CommonName      string
+	CertificateType string
+	NotBefore       time.Time
+	NotAfter        time.Time
+	SHA1            string
+}
+
+// IsExpired report whether the certificate is expired
+func (i CertificateInfo) IsExpired() bool {
+	return time.Now().After(i.NotAfter)
+}
+
+// ExpiresWithin report whether the certificate expires within d
+func (i CertificateInfo) ExpiresWithin(d time.Duration) bool {
+	return time.Now().Add(d).After(i.NotAfter)
+}
+
+// IsNearExpiry report whether the certificate expires within DefaultExpiryWindow
+func (i CertificateInfo) IsNearExpiry() bool {
+	return i.ExpiresWithin(DefaultExpiryWindow)
+}
+
+// Certificate decode certificateContent to x509 certificate
+func (c CertificateData) Certificate() (*x509.Certificate, error) {
+	content, ok := c.Attributes["certificateContent"]
+	if !ok || len(content) == 0 {
+		return nil, errors.New("certificate content is empty")
+	}
+	return ParseCertificateContent(content)
+}
+
+// Info decode certificateContent and return certificate metadata
+func (c CertificateData) Info() (CertificateInfo, error) {
+	cert, err := c.Certificate()
+	if err != nil {
+		return CertificateInfo{}, err
+	}
+	info := GetCertificateInfo(cert)
+	if certType, ok := c.Attributes["certificateType"]; ok && len(certType) > 0 {
+		info.CertificateType = certType
+	}
+	return info, nil
+}
+
+// ParseCertificateContent parse base64 der or pem certificate content
+func ParseCertificateContent(content string) (*x509.Certificate, error) {
+	if block, _ := pem.Decode([]byte(content)); block != nil {
+		return x509.ParseCertificate(block.Bytes)
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(content))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding certificate content: %v", err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// GetCertificateInfo return certificate metadata
+func GetCertificateInfo(cert *x509.Certificate) CertificateInfo {
+	fingerprint := sha1.Sum(cert.Raw)
+	info := CertificateInfo{
+		SerialNumber: fmt.Sprintf("%X", cert.SerialNumber),
+		CommonName:   cert.Subject.CommonName,
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+		SHA1:         strings.ToUpper(hex.EncodeToString(fingerprint[:])),
+	}
+	if len(cert.Subject.OrganizationalUnit) > 0 {
+		info.TeamID = cert.Subject.OrganizationalUnit[0]
+	}
+	for _, v := range certTypePrefixes {
+		if strings.HasPrefix(info.CommonName, v.prefix) {
+			info.CertificateType = v.certType
+			break
+		}
+	}
+	return info
+}
@@ -0,0 +1,141 @@
+package apple
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCertificateDER return a self-signed certificate with the common name, serial and expiry
+func testCertificateDER(t *testing.T, commonName string, serial int64, notAfter time.Time) []byte {
+	t.Helper()
+	key := testECKey(t)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName, OrganizationalUnit: []string{"TEAMID1234"}},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestCertificateInfo(t *testing.T) {
+	notAfter := time.Now().Add(10 * 24 * time.Hour).Truncate(time.Second)
+	tests := []struct {
+		commonName string
+		attrType   string
+		certType   string
+	}{
+		{"Apple Development: Widuu (ABCDE12345)", "", "DEVELOPMENT"},
+		{"Apple Distribution: Widuu (TEAMID1234)", "", "DISTRIBUTION"},
+		{"iPhone Developer: Widuu (ABCDE12345)", "", "IOS_DEVELOPMENT"},
+		{"iPhone Distribution: Widuu (TEAMID1234)", "", "IOS_DISTRIBUTION"},
+		{"Developer ID Application: Widuu (TEAMID1234)", "", "DEVELOPER_ID_APPLICATION"},
+		{"Apple Push Services: com.widuu.app", "", "APPLE_PUSH_SERVICES"},
+		{"Unknown: Widuu", "", ""},
+		// the certificateType attribute of the API wins over the common name
+		{"Apple Development: Widuu (ABCDE12345)", "IOS_DEVELOPMENT", "IOS_DEVELOPMENT"},
+	}
+	for i, tt := range tests {
+		der := testCertificateDER(t, tt.commonName, int64(0xABC0+i), notAfter)
+		fingerprint := sha1.Sum(der)
+		attributes := map[string]string{"certificateContent": base64.StdEncoding.EncodeToString(der)}
+		if tt.attrType != "" {
+			attributes["certificateType"] = tt.attrType
+		}
+		data := CertificateData{CertType: "certificates", Id: "CERT", Attributes: attributes}
+
+		cert, err := data.Certificate()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.commonName, err)
+		}
+		if base64.StdEncoding.EncodeToString(cert.Raw) != attributes["certificateContent"] {
+			t.Errorf("%s: certificate content changed", tt.commonName)
+		}
+		info, err := data.Info()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.commonName, err)
+		}
+		want := CertificateInfo{
+			SerialNumber:    strings.ToUpper(big.NewInt(int64(0xABC0 + i)).Text(16)),
+			TeamID:          "TEAMID1234",
+			CommonName:      tt.commonName,
+			CertificateType: tt.certType,
+			SHA1:            strings.ToUpper(hex.EncodeToString(fingerprint[:])),
+		}
+		if !info.NotAfter.Equal(notAfter) || !info.NotBefore.Equal(notAfter.Add(-365*24*time.Hour)) {
+			t.Errorf("%s: validity %v - %v", tt.commonName, info.NotBefore, info.NotAfter)
+		}
+		info.NotBefore, info.NotAfter = time.Time{}, time.Time{}
+		if info != want {
+			t.Errorf("%s: Info = %+v, want %+v", tt.commonName, info, want)
+		}
+	}
+}
+
+func TestParseCertificateContent(t *testing.T) {
+	der := testCertificateDER(t, "Apple Development: Widuu", 1, time.Now().Add(time.Hour))
+	for name, content := range map[string]string{
+		"base64":      base64.StdEncoding.EncodeToString(der),
+		"base64 line": base64.StdEncoding.EncodeToString(der) + "\n",
+		"pem":         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	} {
+		cert, err := ParseCertificateContent(content)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if cert.Subject.CommonName != "Apple Development: Widuu" {
+			t.Errorf("%s: CommonName = %q", name, cert.Subject.CommonName)
+		}
+	}
+
+	for name, content := range map[string]string{
+		"not base64":      "not base64!",
+		"not certificate": base64.StdEncoding.EncodeToString([]byte("garbage")),
+		"bad pem":         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("garbage")})),
+	} {
+		if _, err := ParseCertificateContent(content); err == nil {
+			t.Errorf("%s: parsed invalid content", name)
+		}
+	}
+	for name, attributes := range map[string]map[string]string{
+		"missing": {},
+		"empty":   {"certificateContent": ""},
+		"invalid": {"certificateContent": "not base64!"},
+	} {
+		data := CertificateData{Attributes: attributes}
+		if _, err := data.Info(); err == nil {
+			t.Errorf("%s: Info of invalid content succeeded", name)
+		}
+	}
+}
+
+func TestCertificateInfoExpiry(t *testing.T) {
+	tests := []struct {
+		notAfter            time.Duration
+		expired, nearExpiry bool
+	}{
+		{-time.Hour, true, true},
+		{24 * time.Hour, false, true},
+		{DefaultExpiryWindow + 24*time.Hour, false, false},
+	}
+	for _, tt := range tests {
+		info := CertificateInfo{NotAfter: time.Now().Add(tt.notAfter)}
+		if info.IsExpired() != tt.expired || info.IsNearExpiry() != tt.nearExpiry {
+			t.Errorf("NotAfter in %v: expired %v near expiry %v, want %v %v", tt.notAfter, info.IsExpired(), info.IsNearExpiry(), tt.expired, tt.nearExpiry)
+		}
+	}
+}
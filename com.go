@@ -1,13 +1,10 @@
 package apple
 
 import (
-	"bytes"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
-	"encoding/pem"
+	"net/url"
+	"strconv"
 	"strings"
 
 	uuid "github.com/satori/go.uuid"
@@ -26,8 +23,10 @@ func BuildSearchQueryString(teamId string, s map[string]string) string {
 	search.WriteString(teamId)
 
 	for k, v := range s {
-		if k == "limit" {
-			search.WriteString("&limit=")
+		if k == "limit" || k == "include" {
+			search.WriteString("&")
+			search.WriteString(k)
+			search.WriteString("=")
 			search.WriteString(v)
 			continue
 		}
@@ -62,10 +61,10 @@ func ContentToPem(body string, chunklen uint) string {
 }
 
 func GetSubject(commonName, emailAddress string) pkix.Name {
-	oidEmailAddress := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
-	return pkix.Name{
-		CommonName: commonName,
-		ExtraNames: []pkix.AttributeTypeAndValue{
+	subject := pkix.Name{CommonName: commonName}
+	if emailAddress != "" {
+		oidEmailAddress := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+		subject.ExtraNames = []pkix.AttributeTypeAndValue{
 			{
 				Type: oidEmailAddress,
 				Value: asn1.RawValue{
@@ -73,30 +72,73 @@ func GetSubject(commonName, emailAddress string) pkix.Name {
 					Bytes: []byte(emailAddress),
 				},
 			},
-		},
+		}
 	}
+	return subject
 }
 
-func CreateCertificateSigningRequest(commonName, emailAddress string, years int) (string, string) {
-	subject := GetSubject(commonName, emailAddress)
-	keys, _ := rsa.GenerateKey(rand.Reader, 2048)
+func GenerateUDID() string {
+	UDID := uuid.NewV4()
+	return UDID.String()
+}
 
-	csrTemplate := x509.CertificateRequest{
-		Subject:            subject,
-		SignatureAlgorithm: x509.SHA256WithRSA,
-		EmailAddresses:     strings.Split(emailAddress, "#"),
-	}
-	csr, _ := x509.CreateCertificateRequest(rand.Reader, &csrTemplate, keys)
+// listPageSize page size of the QH65B2 list actions
+const listPageSize = 500
 
-	var csrContent, privateKey bytes.Buffer
+// apiPageSize page size of the services/v1 lists
+const apiPageSize = 200
 
-	pem.Encode(&csrContent, &pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})
-	pem.Encode(&privateKey, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(keys)})
+// apiPage paging of a services/v1 list response, the next page is requested
+// with the query of links.next
+type apiPage struct {
+	Links struct {
+		Next string `json:"next"`
+	} `json:"links"`
+	Meta struct {
+		Paging struct {
+			Total int `json:"total"`
+		} `json:"paging"`
+	} `json:"meta"`
+}
 
-	return csrContent.String(), privateKey.String()
+// firstPageQuery return the query of the first page of a services/v1 list
+func firstPageQuery(teamId string) string {
+	return BuildSearchQueryString(teamId, map[string]string{"limit": strconv.Itoa(apiPageSize)})
 }
 
-func GenerateUDID() string {
-	UDID := uuid.NewV4()
-	return UDID.String()
+// next return the query of the next page and the total for readPages once read records
+// are read, the query is empty and the total is read on the last page
+func (p apiPage) next(teamId, query string, read int) (string, int) {
+	u, err := url.Parse(p.Links.Next)
+	if p.Links.Next == "" || err != nil || u.RawQuery == "" || u.RawQuery == query {
+		return "", read
+	}
+	next := u.RawQuery
+	if !strings.HasPrefix(next, "teamId=") && !strings.Contains(next, "&teamId=") {
+		next = "teamId=" + teamId + "&" + next
+	}
+	if p.Meta.Paging.Total > read {
+		return next, p.Meta.Paging.Total
+	}
+	return next, read + 1
+}
+
+// readPages call fetch from the first page until total records are read, fetch
+// return the records of the page, the total and the page number the server answered
+func readPages(fetch func(pageNumber int) (records, total, page int, err error)) error {
+	read, pageNumber := 0, 0
+	for {
+		records, total, page, err := fetch(pageNumber)
+		if err != nil {
+			return err
+		}
+		read += records
+		if records == 0 || read >= total {
+			return nil
+		}
+		if page < pageNumber {
+			page = pageNumber
+		}
+		pageNumber = page + 1
+	}
 }
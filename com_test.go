@@ -0,0 +1,317 @@
+package apple
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/widuu/apple/plist"
+)
+
+func TestReadPages(t *testing.T) {
+	tests := []struct {
+		name  string
+		total int
+		sizes []int // records of each page
+		first int   // page number the server gives the first page
+		want  []int
+	}{
+		{"one page", 3, []int{3}, 0, []int{0}},
+		{"several pages", 5, []int{2, 2, 1}, 0, []int{0, 1, 2}},
+		{"one based pages", 5, []int{2, 2, 1}, 1, []int{0, 2, 3}},
+		{"short last page", 9, []int{2, 0}, 0, []int{0, 1}},
+		{"empty", 0, []int{0}, 0, []int{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requested []int
+			err := readPages(func(pageNumber int) (int, int, int, error) {
+				i := len(requested)
+				requested = append(requested, pageNumber)
+				if i >= len(tt.sizes) {
+					t.Fatalf("requested page %d after the last page", pageNumber)
+				}
+				return tt.sizes[i], tt.total, tt.first + i, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(requested, tt.want) {
+				t.Errorf("requested pages %v, want %v", requested, tt.want)
+			}
+		})
+	}
+
+	want := errors.New("request failed")
+	if err := readPages(func(int) (int, int, int, error) { return 0, 0, 0, want }); err != want {
+		t.Errorf("error = %v, want %v", err, want)
+	}
+}
+
+func TestAPIPageNext(t *testing.T) {
+	const first = "teamId=TEAMID1234&limit=200"
+	tests := []struct {
+		name      string
+		next      string
+		total     int
+		wantQuery string
+		wantTotal int
+	}{
+		{"last page", "", 0, "", 3},
+		{"same query", "https://developerservices2.apple.com/services/v1/profiles?" + first, 10, "", 3},
+		{"cursor", "https://developerservices2.apple.com/services/v1/profiles?teamId=TEAMID1234&limit=200&cursor=Mg", 10, "teamId=TEAMID1234&limit=200&cursor=Mg", 10},
+		{"without team", "https://developerservices2.apple.com/services/v1/profiles?limit=200&cursor=Mg", 10, "teamId=TEAMID1234&limit=200&cursor=Mg", 10},
+		// without a total the next page is read while there is a next link
+		{"without total", "https://developerservices2.apple.com/services/v1/profiles?limit=200&cursor=Mg", 0, "teamId=TEAMID1234&limit=200&cursor=Mg", 4},
+	}
+	for _, tt := range tests {
+		var page apiPage
+		page.Links.Next = tt.next
+		page.Meta.Paging.Total = tt.total
+		query, total := page.next("TEAMID1234", first, 3)
+		if query != tt.wantQuery || total != tt.wantTotal {
+			t.Errorf("%s: next = %q, %d, want %q, %d", tt.name, query, total, tt.wantQuery, tt.wantTotal)
+		}
+	}
+}
+
+// fakeDeveloperAPI developer API of the team TEAMID1234, lists are served pageSize records a page
+type fakeDeveloperAPI struct {
+	t        *testing.T
+	pageSize int
+	certs    []CertificateData
+	profiles []ProfileData
+	apps     []AppId
+	devices  []map[string]string
+	// createError rejects create certificate requests with the detail
+	createError string
+	// regenError fails regenProvisioningProfile with the user string
+	regenError string
+
+	created   int
+	regens    []createProfileRequest
+	downloads []string
+	deleted   []string
+}
+
+// serve the fake for the duration of the test
+func (f *fakeDeveloperAPI) serve() {
+	testAPIServer(f.t, f.handle)
+}
+
+func (f *fakeDeveloperAPI) handle(w http.ResponseWriter, r *http.Request) {
+	t := f.t
+	method, path := apiMethod(r), r.URL.Path
+	switch {
+	case method == "GET" && path == "/services/v1/certificates":
+		var certs []interface{}
+		for _, c := range f.certs {
+			certs = append(certs, c)
+		}
+		f.writeList(w, r, certs, func(i int) string { return f.certs[i].Id })
+	case method == "GET" && path == "/services/v1/profiles":
+		var profiles []interface{}
+		for _, p := range f.profiles {
+			profiles = append(profiles, p)
+		}
+		f.writeList(w, r, profiles, func(i int) string { return f.profiles[i].Id })
+	case method == "POST" && path == "/services/v1/certificates":
+		attributes := readCreateCertificate(t, r)
+		if f.createError != "" {
+			writeJSON(t, w, apiError(f.createError))
+			return
+		}
+		f.created++
+		cert := CertificateData{CertType: "certificates", Id: fmt.Sprintf("NEW%d", f.created), Attributes: map[string]string{
+			"certificateType":    attributes["certificateType"],
+			"certificateContent": testIssueCertificate(t, attributes["csrContent"]),
+		}}
+		f.certs = append(f.certs, cert)
+		writeJSON(t, w, map[string]interface{}{"data": cert})
+	case method == "DELETE" && strings.HasPrefix(path, "/services/v1/certificates/"):
+		id := strings.TrimPrefix(path, "/services/v1/certificates/")
+		for i, c := range f.certs {
+			if c.Id == id {
+				f.certs = append(f.certs[:i], f.certs[i+1:]...)
+				f.deleted = append(f.deleted, "certificates/"+id)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(t, w, apiError("There is no certificate with id "+id))
+	case method == "DELETE" && strings.HasPrefix(path, "/services/v1/profiles/"):
+		id := strings.TrimPrefix(path, "/services/v1/profiles/")
+		for i, p := range f.profiles {
+			if p.Id == id {
+				f.profiles = append(f.profiles[:i], f.profiles[i+1:]...)
+				f.deleted = append(f.deleted, "profiles/"+id)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(t, w, apiError("There is no profile with id "+id))
+	case path == "/services/QH65B2/ios/listAppIds.action":
+		start, end, page := f.readPlistPage(r, len(f.apps))
+		f.writePlist(w, AppIds{AppIds: f.apps[start:end], PageNumber: page, PageSize: f.pageSize, TotalRecords: len(f.apps)})
+	case path == "/services/QH65B2/ios/listDevices.action":
+		start, end, page := f.readPlistPage(r, len(f.devices))
+		f.writePlist(w, DeviceListRequest{Devices: f.devices[start:end], PageNumber: page, PageSize: f.pageSize, TotalRecords: len(f.devices)})
+	case path == "/services/QH65B2/ios/regenProvisioningProfile.action":
+		var req createProfileRequest
+		f.readPlist(r, &req)
+		f.regens = append(f.regens, req)
+		if f.regenError != "" {
+			f.writePlist(w, createProfileResponse{UserString: f.regenError, Code: 35})
+			return
+		}
+		f.writePlist(w, createProfileResponse{Profile: ProvisioningProfile{
+			ProvisioningProfileId: req.ProvisioningProfileID,
+			Name:                  req.ProvisioningProfileName,
+			Status:                "Active",
+		}})
+	case path == "/services/QH65B2/ios/downloadTeamProvisioningProfile.action":
+		var req downloadTeamProfileRequest
+		f.readPlist(r, &req)
+		f.downloads = append(f.downloads, req.BundleId)
+		for _, app := range f.apps {
+			if app.AppIDID == req.BundleId {
+				f.writePlist(w, createProfileResponse{Profile: ProvisioningProfile{ProvisioningProfileId: "TEAM" + app.AppIDID, Name: "iOS Team Provisioning Profile: " + app.Identifier}})
+				return
+			}
+		}
+		f.writePlist(w, createProfileResponse{UserString: "No App ID with id " + req.BundleId, Code: 35})
+	default:
+		t.Errorf("unexpected %s %s", method, path)
+		http.NotFound(w, r)
+	}
+}
+
+// writeList write the page of records the urlEncodedQueryParams of the request asks for,
+// the next page is linked with a cursor and without the team
+func (f *fakeDeveloperAPI) writeList(w http.ResponseWriter, r *http.Request, records []interface{}, id func(int) string) {
+	t := f.t
+	var req struct {
+		UrlEncodedQueryParams string `json:"urlEncodedQueryParams"`
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Errorf("list request %s: %v", body, err)
+	}
+	query, err := url.ParseQuery(req.UrlEncodedQueryParams)
+	if err != nil || query.Get("teamId") != "TEAMID1234" {
+		t.Errorf("list query %q: %v", req.UrlEncodedQueryParams, err)
+	}
+	if filter := query.Get("filter[id]"); filter != "" {
+		var matched []interface{}
+		for i, record := range records {
+			if id(i) == filter {
+				matched = append(matched, record)
+			}
+		}
+		records = matched
+	}
+
+	start, _ := strconv.Atoi(query.Get("cursor"))
+	end := start + f.pageSize
+	if end > len(records) {
+		end = len(records)
+	}
+	res := map[string]interface{}{
+		"data": append([]interface{}{}, records[start:end]...),
+		"meta": map[string]interface{}{"paging": map[string]int{"total": len(records), "limit": f.pageSize}},
+	}
+	if end < len(records) {
+		res["links"] = map[string]string{"next": fmt.Sprintf("https://developerservices2.apple.com%s?limit=%d&cursor=%d", r.URL.Path, f.pageSize, end)}
+	}
+	writeJSON(t, w, res)
+}
+
+// readPlistPage return the records of the page a QH65B2 list request asks for
+func (f *fakeDeveloperAPI) readPlistPage(r *http.Request, total int) (start, end, page int) {
+	var req struct {
+		TeamID     string `plist:"teamId"`
+		PageNumber int    `plist:"pageNumber"`
+	}
+	f.readPlist(r, &req)
+	if req.TeamID != "TEAMID1234" {
+		f.t.Errorf("list team %q", req.TeamID)
+	}
+	start = req.PageNumber * f.pageSize
+	if start > total {
+		start = total
+	}
+	end = start + f.pageSize
+	if end > total {
+		end = total
+	}
+	return start, end, req.PageNumber
+}
+
+func (f *fakeDeveloperAPI) readPlist(r *http.Request, v interface{}) {
+	body, _ := ioutil.ReadAll(r.Body)
+	if err := plist.Unmarshal(body, v); err != nil {
+		f.t.Errorf("%s request %s: %v", r.URL.Path, body, err)
+	}
+}
+
+func (f *fakeDeveloperAPI) writePlist(w http.ResponseWriter, v interface{}) {
+	data, err := plist.Marshal(v)
+	if err != nil {
+		f.t.Error(err)
+		return
+	}
+	w.Write(data)
+}
+
+// testAPICertificate development certificate of the team expiring at notAfter
+func testAPICertificate(t *testing.T, id string, notAfter time.Time) CertificateData {
+	t.Helper()
+	der := testCertificateDER(t, "Apple Development: "+id, 1, notAfter)
+	return CertificateData{CertType: "certificates", Id: id, Attributes: map[string]string{
+		"certificateType":    "DEVELOPMENT",
+		"certificateContent": base64.StdEncoding.EncodeToString(der),
+	}}
+}
+
+// testAPIProfile profile of the app TEAMID1234.com.widuu.app with the devices and certificates
+func testAPIProfile(t *testing.T, signer *testIdentity, id, profileType, platform string, devices []string, certs ...CertificateData) ProfileData {
+	t.Helper()
+	profile := profilePlist{
+		Name:           id,
+		UUID:           id,
+		TeamIdentifier: []string{"TEAMID1234"},
+		Entitlements:   map[string]interface{}{"application-identifier": "TEAMID1234.com.widuu.app"},
+		ExpirationDate: time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second),
+		CreationDate:   time.Now().UTC().Truncate(time.Second),
+	}
+	if len(devices) > 0 {
+		profile.ProvisionedDevices = devices
+	}
+	for _, c := range certs {
+		cert, err := c.Certificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		profile.DeveloperCertificates = append(profile.DeveloperCertificates, cert.Raw)
+	}
+	content := signTestProfile(t, profile, signer, signer.cert)
+	return ProfileData{Stype: "profiles", Id: id, Attributes: map[string]string{
+		"name":           id,
+		"uuid":           id,
+		"profileType":    profileType,
+		"platform":       platform,
+		"profileState":   "ACTIVE",
+		"profileContent": base64.StdEncoding.EncodeToString(content),
+	}}
+}
@@ -0,0 +1,161 @@
+package apple
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeyType private key algorithm used for CSR generation
+type KeyType int
+
+// key types
+const (
+	RSA2048 KeyType = iota
+	RSA4096
+	ECDSAP256
+	ECDSAP384
+)
+
+func (t KeyType) String() string {
+	switch t {
+	case RSA2048:
+		return "RSA-2048"
+	case RSA4096:
+		return "RSA-4096"
+	case ECDSAP256:
+		return "ECDSA-P256"
+	case ECDSAP384:
+		return "ECDSA-P384"
+	}
+	return fmt.Sprintf("KeyType(%d)", int(t))
+}
+
+// GenerateKey generate a new private key of the key type
+func (t KeyType) GenerateKey() (crypto.Signer, error) {
+	switch t {
+	case RSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case RSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case ECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case ECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	}
+	return nil, fmt.Errorf("unsupported key type %v", t)
+}
+
+// CSROptions certificate signing request options
+type CSROptions struct {
+	CommonName string
+	// EmailAddress one address, or several separated by "#"
+	EmailAddress       string
+	Organization       string
+	OrganizationalUnit string
+	Country            string
+	// KeyType of the generated key, ignored when Signer is set
+	KeyType KeyType
+	// Signer sign the request with an existing key (KMS, HSM ...)
+	Signer crypto.Signer
+}
+
+// GenerateCertificateSigningRequest return PEM encoded CSR and the key which signed it
+func GenerateCertificateSigningRequest(opts CSROptions) (string, crypto.Signer, error) {
+	if opts.CommonName == "" {
+		return "", nil, errors.New("csr common name is empty")
+	}
+
+	signer := opts.Signer
+	if signer == nil {
+		var err error
+		signer, err = opts.KeyType.GenerateKey()
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	subject := GetSubject(opts.CommonName, opts.EmailAddress)
+	if opts.Organization != "" {
+		subject.Organization = []string{opts.Organization}
+	}
+	if opts.OrganizationalUnit != "" {
+		subject.OrganizationalUnit = []string{opts.OrganizationalUnit}
+	}
+	if opts.Country != "" {
+		subject.Country = []string{opts.Country}
+	}
+
+	csrTemplate := x509.CertificateRequest{Subject: subject}
+	if opts.EmailAddress != "" {
+		csrTemplate.EmailAddresses = strings.Split(opts.EmailAddress, "#")
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &csrTemplate, signer)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})), signer, nil
+}
+
+// EncodePrivateKey return "RSA PRIVATE KEY" or "EC PRIVATE KEY" PEM text
+func EncodePrivateKey(key crypto.PrivateKey) (string, error) {
+	var block *pem.Block
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return "", err
+		}
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	default:
+		return "", fmt.Errorf("unsupported private key type %T", key)
+	}
+	return string(pem.EncodeToMemory(block)), nil
+}
+
+// CreateCertificateSigningRequest return PEM encoded CSR and RSA-2048 private key, empty
+// strings when generation fails, the error is dropped. years has no effect, Apple sets the
+// certificate validity.
+//
+// Deprecated: use GenerateCertificateSigningRequest, which returns the error, and
+// EncodePrivateKey.
+func CreateCertificateSigningRequest(commonName, emailAddress string, years int) (string, string) {
+	csrContent, key, err := GenerateCertificateSigningRequest(CSROptions{
+		CommonName:   commonName,
+		EmailAddress: emailAddress,
+	})
+	if err != nil {
+		return "", ""
+	}
+	privateKey, err := EncodePrivateKey(key)
+	if err != nil {
+		return "", ""
+	}
+	return csrContent, privateKey
+}
+
+// CreateEncryptedCertificateSigningRequest return PEM encoded CSR and passphrase encrypted PKCS8 private key
+func CreateEncryptedCertificateSigningRequest(opts CSROptions, passphrase string) (string, string, error) {
+	if passphrase == "" {
+		return "", "", errors.New("private key passphrase is empty")
+	}
+	csrContent, key, err := GenerateCertificateSigningRequest(opts)
+	if err != nil {
+		return "", "", err
+	}
+	privateKey, err := EncryptPrivateKey(key, passphrase)
+	if err != nil {
+		return "", "", err
+	}
+	return csrContent, privateKey, nil
+}
@@ -0,0 +1,77 @@
+package apple
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"reflect"
+	"testing"
+)
+
+func parseTestCSR(t *testing.T, content string) *x509.CertificateRequest {
+	t.Helper()
+	block, _ := pem.Decode([]byte(content))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		t.Fatalf("not a PEM certificate request: %q", content)
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Fatal(err)
+	}
+	return csr
+}
+
+func TestCreateCertificateSigningRequest(t *testing.T) {
+	csrContent, privateKey := CreateCertificateSigningRequest("dev", "a@example.com#b@example.com", 1)
+	csr := parseTestCSR(t, csrContent)
+	if want := []string{"a@example.com", "b@example.com"}; !reflect.DeepEqual(csr.EmailAddresses, want) {
+		t.Errorf("EmailAddresses = %v, want %v", csr.EmailAddresses, want)
+	}
+	if csr.Subject.CommonName != "dev" {
+		t.Errorf("CommonName = %q", csr.Subject.CommonName)
+	}
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		t.Fatalf("private key is not an RSA PEM: %q", privateKey)
+	}
+
+	if csrContent, privateKey := CreateCertificateSigningRequest("", "", 1); csrContent != "" || privateKey != "" {
+		t.Error("created a request without common name")
+	}
+}
+
+func TestGenerateCertificateSigningRequest(t *testing.T) {
+	csrContent, key, err := GenerateCertificateSigningRequest(CSROptions{
+		CommonName:   "dev",
+		Organization: "Widuu",
+		Country:      "CN",
+		KeyType:      ECDSAP256,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr := parseTestCSR(t, csrContent)
+	if csr.PublicKeyAlgorithm != x509.ECDSA {
+		t.Errorf("PublicKeyAlgorithm = %v, want ECDSA", csr.PublicKeyAlgorithm)
+	}
+	if !reflect.DeepEqual(csr.PublicKey, key.Public()) {
+		t.Error("request is not signed by the returned key")
+	}
+	if len(csr.EmailAddresses) != 0 {
+		t.Errorf("EmailAddresses = %v, want none", csr.EmailAddresses)
+	}
+	if csr.Subject.Organization[0] != "Widuu" || csr.Subject.Country[0] != "CN" {
+		t.Errorf("Subject = %v", csr.Subject)
+	}
+}
+
+func TestGetSubject(t *testing.T) {
+	if subject := GetSubject("dev", ""); len(subject.ExtraNames) != 0 {
+		t.Errorf("ExtraNames = %v, want none without email address", subject.ExtraNames)
+	}
+	if subject := GetSubject("dev", "a@example.com"); len(subject.ExtraNames) != 1 {
+		t.Errorf("ExtraNames = %v, want the email address", subject.ExtraNames)
+	}
+}
@@ -117,6 +117,20 @@ func DeviceLists(teamID, myacinfo string, pageNumber, pageSize int) (DeviceListR
 	return data, nil
 }
 
+// listAllDevices return the devices of every DeviceLists page
+func listAllDevices(teamID, myacinfo string) ([]map[string]string, error) {
+	var devices []map[string]string
+	err := readPages(func(pageNumber int) (int, int, int, error) {
+		data, err := DeviceLists(teamID, myacinfo, pageNumber, listPageSize)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		devices = append(devices, data.Devices...)
+		return len(data.Devices), data.TotalRecords, data.PageNumber, nil
+	})
+	return devices, err
+}
+
 // GetDeviceTotal device total
 func GetDeviceTotal(teamID, myacinfo string) (map[string]int, error) {
 	requestData, err := DeviceLists(teamID, myacinfo, 0, 500)
@@ -0,0 +1,291 @@
+package apple
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/widuu/apple/plist"
+)
+
+const bundleIdUrl = "https://developerservices2.apple.com/services/v1/bundleIds"
+
+// Entitlements .entitlements plist dictionary
+type Entitlements map[string]interface{}
+
+// base entitlements copied from every profile
+var baseEntitlements = []string{
+	"application-identifier",
+	"com.apple.application-identifier",
+	"com.apple.developer.team-identifier",
+	"keychain-access-groups",
+	"get-task-allow",
+	"com.apple.security.get-task-allow",
+}
+
+// CapabilityEntitlements entitlement keys granted by each App ID capability type
+var CapabilityEntitlements = map[string][]string{
+	"ACCESS_WIFI_INFORMATION":          {"com.apple.developer.networking.wifi-info"},
+	"APP_GROUPS":                       {"com.apple.security.application-groups"},
+	"APPLE_ID_AUTH":                    {"com.apple.developer.applesignin"},
+	"APPLE_PAY":                        {"com.apple.developer.in-app-payments"},
+	"ASSOCIATED_DOMAINS":               {"com.apple.developer.associated-domains"},
+	"AUTOFILL_CREDENTIAL_PROVIDER":     {"com.apple.developer.authentication-services.autofill-credential-provider"},
+	"CLASSKIT":                         {"com.apple.developer.ClassKit-environment"},
+	"DATA_PROTECTION":                  {"com.apple.developer.default-data-protection"},
+	"GAME_CENTER":                      {"com.apple.developer.game-center"},
+	"HEALTHKIT":                        {"com.apple.developer.healthkit", "com.apple.developer.healthkit.access"},
+	"HOMEKIT":                          {"com.apple.developer.homekit"},
+	"HOT_SPOT":                         {"com.apple.developer.networking.HotspotConfiguration"},
+	"ICLOUD":                           {"com.apple.developer.icloud-container-identifiers", "com.apple.developer.icloud-container-environment", "com.apple.developer.icloud-services", "com.apple.developer.ubiquity-container-identifiers", "com.apple.developer.ubiquity-kvstore-identifier"},
+	"INTER_APP_AUDIO":                  {"inter-app-audio"},
+	"MULTIPATH":                        {"com.apple.developer.networking.multipath"},
+	"NETWORK_EXTENSIONS":               {"com.apple.developer.networking.networkextension"},
+	"NFC_TAG_READING":                  {"com.apple.developer.nfc.readersession.formats"},
+	"PERSONAL_VPN":                     {"com.apple.developer.networking.vpn.api"},
+	"PUSH_NOTIFICATIONS":               {"aps-environment", "com.apple.developer.aps-environment"},
+	"SIRIKIT":                          {"com.apple.developer.siri"},
+	"WALLET":                           {"com.apple.developer.pass-type-identifiers"},
+	"WIRELESS_ACCESSORY_CONFIGURATION": {"com.apple.external-accessory.wireless-configuration"},
+}
+
+// BundleCapabilities return the enabled capability types of the App ID
+func BundleCapabilities(bundleId, teamId, myacinfo string) ([]string, error) {
+	postJson, err := json.Marshal(struct {
+		UrlEncodedQueryParams string `json:"urlEncodedQueryParams"`
+	}{
+		UrlEncodedQueryParams: BuildSearchQueryString(teamId, map[string]string{"limit": "200"}),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// request
+	request := NewClientRequest(bundleIdUrl+"/"+bundleId+"/bundleIdCapabilities", "POST")
+	JSONRequestHeader["Cookie"] = "myacinfo=" + myacinfo
+	JSONRequestHeader["X-HTTP-Method-Override"] = "GET"
+	body, _, err := request.SetHeader(JSONRequestHeader).SetBody(postJson).GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Error []struct {
+			Detail string `json:"detail"`
+		} `json:"errors"`
+		Data []Resource `json:"data"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+	if len(data.Error) > 0 {
+		return nil, errors.New(data.Error[0].Detail)
+	}
+
+	var capabilities []string
+	for _, res := range data.Data {
+		if c := res.String("capabilityType"); c != "" {
+			capabilities = append(capabilities, c)
+		}
+	}
+	sort.Strings(capabilities)
+	return capabilities, nil
+}
+
+// entitlements whose values are app ids, a wildcard value such as TEAMID.* is expanded to the bundle id
+var appIDEntitlements = map[string]bool{
+	"application-identifier":           true,
+	"com.apple.application-identifier": true,
+	"keychain-access-groups":           true,
+}
+
+// GenerateEntitlements build the entitlements of the enabled capabilities from the values the profile allows,
+// capability entitlements missing from the profile are skipped. Wildcard app ids of a wildcard profile,
+// like TEAMID.* in application-identifier and keychain-access-groups, are expanded to the bundle id
+func GenerateEntitlements(capabilities []string, bundleID string, profile *Profile) (Entitlements, error) {
+	res := Entitlements{}
+	copyKey := func(key string) error {
+		v, ok := profile.Entitlements[key]
+		if !ok {
+			return nil
+		}
+		if appIDEntitlements[key] {
+			expanded, err := expandAppIDWildcard(v, bundleID)
+			if err != nil {
+				return fmt.Errorf("entitlement %s: %v", key, err)
+			}
+			v = expanded
+		}
+		res[key] = v
+		return nil
+	}
+	for _, key := range baseEntitlements {
+		if err := copyKey(key); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range capabilities {
+		for _, key := range CapabilityEntitlements[c] {
+			if err := copyKey(key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return res, nil
+}
+
+// expandAppIDWildcard replace app ids ending in * in the string or list value with PREFIX.bundleID
+func expandAppIDWildcard(value interface{}, bundleID string) (interface{}, error) {
+	expand := func(appID string) (string, error) {
+		if !strings.HasSuffix(appID, "*") {
+			return appID, nil
+		}
+		if bundleID == "" {
+			return "", errors.New("bundle id is empty")
+		}
+		expanded := bundleID
+		if idx := strings.Index(appID, "."); idx >= 0 {
+			expanded = appID[:idx+1] + bundleID
+		}
+		if !entitlementStringMatch(appID, expanded) {
+			return "", fmt.Errorf("bundle id %s does not match %s", bundleID, appID)
+		}
+		return expanded, nil
+	}
+	switch v := value.(type) {
+	case string:
+		return expand(v)
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, item := range v {
+			res[i] = item
+			if s, ok := item.(string); ok {
+				expanded, err := expand(s)
+				if err != nil {
+					return nil, err
+				}
+				res[i] = expanded
+			}
+		}
+		return res, nil
+	}
+	return value, nil
+}
+
+// ParseEntitlements parse an .entitlements plist
+func ParseEntitlements(data []byte) (Entitlements, error) {
+	var res Entitlements
+	if err := plist.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Marshal encode the entitlements as an xml plist
+func (e Entitlements) Marshal() ([]byte, error) {
+	return plist.MarshalIndent(map[string]interface{}(e), "\t")
+}
+
+// WriteFile write the entitlements plist to path
+func (e Entitlements) WriteFile(path string) error {
+	data, err := e.Marshal()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// EntitlementMismatch requested entitlement the profile does not allow
+type EntitlementMismatch struct {
+	Key       string
+	Requested interface{}
+	// Allowed nil when the profile does not contain the key
+	Allowed interface{}
+}
+
+func (m EntitlementMismatch) Error() string {
+	if m.Allowed == nil {
+		return fmt.Sprintf("entitlement %s is not allowed by the profile", m.Key)
+	}
+	return fmt.Sprintf("entitlement %s: requested %v, profile allows %v", m.Key, m.Requested, m.Allowed)
+}
+
+// ValidateEntitlements check the requested entitlements against the profile,
+// profile values ending in * match any requested value with that prefix
+func ValidateEntitlements(requested Entitlements, profile *Profile) []EntitlementMismatch {
+	var res []EntitlementMismatch
+	for key, v := range requested {
+		// allowed is nil when the profile does not contain the key
+		allowed := profile.Entitlements[key]
+		if !entitlementAllowed(v, allowed) {
+			res = append(res, EntitlementMismatch{Key: key, Requested: v, Allowed: allowed})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+	return res
+}
+
+func entitlementAllowed(requested, allowed interface{}) bool {
+	switch r := requested.(type) {
+	case bool:
+		// false never needs the profile's permission
+		a, ok := allowed.(bool)
+		return !r || ok && a
+	case string:
+		if list, ok := allowed.([]interface{}); ok {
+			return entitlementListAllows(list, r)
+		}
+		a, ok := allowed.(string)
+		return ok && entitlementStringMatch(a, r)
+	case []interface{}:
+		list, ok := allowed.([]interface{})
+		if !ok {
+			if a, isString := allowed.(string); isString {
+				list = []interface{}{a}
+			}
+		}
+		for _, v := range r {
+			s, ok := v.(string)
+			if !ok {
+				if !entitlementListContains(list, v) {
+					return false
+				}
+				continue
+			}
+			if !entitlementListAllows(list, s) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(requested, allowed)
+}
+
+func entitlementListAllows(list []interface{}, value string) bool {
+	for _, v := range list {
+		if s, ok := v.(string); ok && entitlementStringMatch(s, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func entitlementListContains(list []interface{}, value interface{}) bool {
+	for _, v := range list {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func entitlementStringMatch(allowed, value string) bool {
+	if strings.HasSuffix(allowed, "*") {
+		return strings.HasPrefix(value, strings.TrimSuffix(allowed, "*"))
+	}
+	return allowed == value
+}
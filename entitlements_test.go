@@ -0,0 +1,99 @@
+package apple
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testWildcardProfile() *Profile {
+	return &Profile{Entitlements: map[string]interface{}{
+		"application-identifier":              "TEAMID1234.*",
+		"com.apple.developer.team-identifier": "TEAMID1234",
+		"keychain-access-groups":              []interface{}{"TEAMID1234.*", "com.apple.token"},
+		"get-task-allow":                      true,
+		"aps-environment":                     "development",
+		"com.apple.security.application-groups": []interface{}{
+			"group.com.example.shared",
+		},
+		"com.apple.developer.associated-domains": "*",
+	}}
+}
+
+func TestGenerateEntitlements(t *testing.T) {
+	got, err := GenerateEntitlements([]string{"PUSH_NOTIFICATIONS", "APP_GROUPS"}, "com.example.app", testWildcardProfile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Entitlements{
+		"application-identifier":              "TEAMID1234.com.example.app",
+		"com.apple.developer.team-identifier": "TEAMID1234",
+		"keychain-access-groups":              []interface{}{"TEAMID1234.com.example.app", "com.apple.token"},
+		"get-task-allow":                      true,
+		"aps-environment":                     "development",
+		"com.apple.security.application-groups": []interface{}{
+			"group.com.example.shared",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GenerateEntitlements = %v, want %v", got, want)
+	}
+
+	// the generated entitlements are allowed by the profile they come from
+	if mismatches := ValidateEntitlements(got, testWildcardProfile()); len(mismatches) != 0 {
+		t.Errorf("generated entitlements mismatch the profile: %v", mismatches)
+	}
+
+	if _, err := GenerateEntitlements(nil, "", testWildcardProfile()); err == nil {
+		t.Error("expanded a wildcard without bundle id")
+	}
+}
+
+func TestGenerateEntitlementsPartialWildcard(t *testing.T) {
+	profile := &Profile{Entitlements: map[string]interface{}{
+		"application-identifier": "TEAMID1234.com.example.*",
+	}}
+	got, err := GenerateEntitlements(nil, "com.example.app", profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["application-identifier"] != "TEAMID1234.com.example.app" {
+		t.Errorf("application-identifier = %v", got["application-identifier"])
+	}
+	if _, err := GenerateEntitlements(nil, "org.other.app", profile); err == nil {
+		t.Error("expanded a wildcard the bundle id does not match")
+	}
+}
+
+func TestValidateEntitlements(t *testing.T) {
+	profile := testWildcardProfile()
+	tests := []struct {
+		name      string
+		requested Entitlements
+		mismatch  []string
+	}{
+		{"wildcard prefix", Entitlements{"application-identifier": "TEAMID1234.com.example.app"}, nil},
+		{"other team", Entitlements{"application-identifier": "OTHERTEAM.com.example.app"}, []string{"application-identifier"}},
+		{"list wildcard", Entitlements{"keychain-access-groups": []interface{}{"TEAMID1234.com.example.app", "TEAMID1234.shared"}}, nil},
+		{"list exact", Entitlements{"keychain-access-groups": []interface{}{"com.apple.token"}}, nil},
+		{"list not allowed", Entitlements{"keychain-access-groups": []interface{}{"OTHERTEAM.shared"}}, []string{"keychain-access-groups"}},
+		{"string in list", Entitlements{"com.apple.security.application-groups": "group.com.example.shared"}, nil},
+		{"list of string", Entitlements{"aps-environment": []interface{}{"development"}}, nil},
+		{"list not in list", Entitlements{"com.apple.security.application-groups": []interface{}{"group.other"}}, []string{"com.apple.security.application-groups"}},
+		{"true allowed", Entitlements{"get-task-allow": true}, nil},
+		{"false missing from profile", Entitlements{"com.apple.security.get-task-allow": false}, nil},
+		{"true missing from profile", Entitlements{"com.apple.security.get-task-allow": true}, []string{"com.apple.security.get-task-allow"}},
+		{"string missing from profile", Entitlements{"com.apple.developer.siri": "yes"}, []string{"com.apple.developer.siri"}},
+		{"changed value", Entitlements{"aps-environment": "production"}, []string{"aps-environment"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var keys []string
+			for _, m := range ValidateEntitlements(tt.requested, profile) {
+				keys = append(keys, m.Key)
+			}
+			if !reflect.DeepEqual(keys, tt.mismatch) {
+				t.Errorf("mismatches = %v, want %v", keys, tt.mismatch)
+			}
+		})
+	}
+}
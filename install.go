@@ -0,0 +1,199 @@
+package apple
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ProfileExt file extension of installed profiles
+const ProfileExt = ".mobileprovision"
+
+// DefaultProfileDir return ~/Library/MobileDevice/Provisioning Profiles
+func DefaultProfileDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "MobileDevice", "Provisioning Profiles"), nil
+}
+
+// ErrNewerProfileInstalled a profile with the same identity and a later creation date is installed
+var ErrNewerProfileInstalled = errors.New("a newer profile with the same name, team and app id is installed")
+
+// validProfileUUID report whether uuid is a canonical 8-4-4-4-12 hex UUID, so it is safe as a file name
+func validProfileUUID(uuid string) bool {
+	if len(uuid) != 36 {
+		return false
+	}
+	for i, c := range uuid {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// sameProfileIdentity report whether the profiles have the same name, team and app id
+func sameProfileIdentity(a, b *Profile) bool {
+	return a.Name == b.Name && a.TeamID() == b.TeamID() && a.AppID() == b.AppID()
+}
+
+// InstalledProfile profile file in the install directory
+type InstalledProfile struct {
+	Path    string
+	Profile *Profile
+}
+
+// ProfileInstallResult installed profile and the profiles it replaced
+type ProfileInstallResult struct {
+	Installed InstalledProfile
+	// Removed paths of expired or superseded profiles with the same name, team and app id
+	Removed []string
+}
+
+// ProfileInstaller install profiles as <UUID>.mobileprovision into Dir
+type ProfileInstaller struct {
+	Dir string
+}
+
+// NewProfileInstaller create the directory if needed, an empty dir uses DefaultProfileDir
+func NewProfileInstaller(dir string) (*ProfileInstaller, error) {
+	if dir == "" {
+		var err error
+		if dir, err = DefaultProfileDir(); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &ProfileInstaller{Dir: dir}, nil
+}
+
+// Install write the .mobileprovision content and remove expired or older profiles with the same
+// name, team and app id; ErrNewerProfileInstalled is returned and nothing is written when such a
+// profile with a later creation date is installed
+func (i *ProfileInstaller) Install(data []byte) (ProfileInstallResult, error) {
+	var result ProfileInstallResult
+	profile, err := ParseProfile(data)
+	if err != nil {
+		return result, err
+	}
+	if !validProfileUUID(profile.UUID) {
+		return result, errors.New("profile UUID is invalid: " + profile.UUID)
+	}
+
+	installed, err := i.List()
+	if err != nil {
+		return result, err
+	}
+
+	name := filepath.Join(i.Dir, profile.UUID+ProfileExt)
+	for _, p := range installed {
+		if p.Path != name && sameProfileIdentity(p.Profile, profile) && p.Profile.CreationDate.After(profile.CreationDate) {
+			return result, ErrNewerProfileInstalled
+		}
+	}
+	if err := writeFileAtomic(name, data, 0644); err != nil {
+		return result, err
+	}
+	result.Installed = InstalledProfile{Path: name, Profile: profile}
+
+	for _, p := range installed {
+		if p.Path == name || !sameProfileIdentity(p.Profile, profile) {
+			continue
+		}
+		if !p.Profile.IsExpired() && !p.Profile.CreationDate.Before(profile.CreationDate) {
+			continue
+		}
+		if err := os.Remove(p.Path); err != nil && !os.IsNotExist(err) {
+			return result, err
+		}
+		result.Removed = append(result.Removed, p.Path)
+	}
+	return result, nil
+}
+
+// InstallContent install the base64 profileContent returned by GetProfileContent or CreateProfile
+func (i *ProfileInstaller) InstallContent(profileContent string) (ProfileInstallResult, error) {
+	data, err := base64.StdEncoding.DecodeString(profileContent)
+	if err != nil {
+		return ProfileInstallResult{}, err
+	}
+	return i.Install(data)
+}
+
+// List return the installed profiles sorted by name and creation date,
+// files that are not valid profiles are skipped
+func (i *ProfileInstaller) List() ([]InstalledProfile, error) {
+	files, err := ioutil.ReadDir(i.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var res []InstalledProfile
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ProfileExt) {
+			continue
+		}
+		name := filepath.Join(i.Dir, f.Name())
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		profile, err := ParseProfile(data)
+		if err != nil {
+			continue
+		}
+		res = append(res, InstalledProfile{Path: name, Profile: profile})
+	}
+	sort.Slice(res, func(a, b int) bool {
+		if res[a].Profile.Name != res[b].Profile.Name {
+			return res[a].Profile.Name < res[b].Profile.Name
+		}
+		return res[a].Profile.CreationDate.Before(res[b].Profile.CreationDate)
+	})
+	return res, nil
+}
+
+// Remove delete the installed profile with the uuid
+func (i *ProfileInstaller) Remove(uuid string) error {
+	if !validProfileUUID(uuid) {
+		return errors.New("profile UUID is invalid: " + uuid)
+	}
+	err := os.Remove(filepath.Join(i.Dir, uuid+ProfileExt))
+	if os.IsNotExist(err) {
+		return ErrProfileNotFound
+	}
+	return err
+}
+
+// Prune delete every expired profile and return the removed paths
+func (i *ProfileInstaller) Prune() ([]string, error) {
+	installed, err := i.List()
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, p := range installed {
+		if !p.Profile.IsExpired() {
+			continue
+		}
+		if err := os.Remove(p.Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, p.Path)
+	}
+	return removed, nil
+}
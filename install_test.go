@@ -0,0 +1,117 @@
+package apple
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testProfileData return a signed .mobileprovision of the profile
+func testProfileData(t *testing.T, uuid, name, appID string, created time.Time) []byte {
+	t.Helper()
+	signer := newTestIdentity(t, AppleProfileSigningCommonName, nil)
+	return signTestProfile(t, profilePlist{
+		Name:           name,
+		UUID:           uuid,
+		TeamIdentifier: []string{"TEAMID1234"},
+		CreationDate:   created,
+		ExpirationDate: created.Add(365 * 24 * time.Hour),
+		Entitlements:   map[string]interface{}{"application-identifier": "TEAMID1234." + appID},
+	}, signer, signer.cert)
+}
+
+const (
+	testUUID1 = "0f6e2c8e-5f3a-4a57-9f1b-4d2f1f3a9b10"
+	testUUID2 = "1f6e2c8e-5f3a-4a57-9f1b-4d2f1f3a9b11"
+	testUUID3 = "2f6e2c8e-5f3a-4a57-9f1b-4d2f1f3a9b12"
+)
+
+func TestValidProfileUUID(t *testing.T) {
+	tests := map[string]bool{
+		testUUID1:                               true,
+		"0F6E2C8E-5F3A-4A57-9F1B-4D2F1F3A9B10":  true,
+		"":                                      false,
+		"../../etc/passwd":                      false,
+		"0f6e2c8e-5f3a-4a57-9f1b-4d2f1f3a9b1":   false,
+		"0f6e2c8e-5f3a-4a57-9f1b-4d2f1f3a9b10/": false,
+		"0f6e2c8e/5f3a-4a57-9f1b-4d2f1f3a9b10":  false,
+		"0f6e2c8g-5f3a-4a57-9f1b-4d2f1f3a9b10":  false,
+	}
+	for uuid, want := range tests {
+		if got := validProfileUUID(uuid); got != want {
+			t.Errorf("validProfileUUID(%q) = %v, want %v", uuid, got, want)
+		}
+	}
+}
+
+func TestProfileInstaller(t *testing.T) {
+	dir := testTempDir(t)
+	installer, err := NewProfileInstaller(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	old, err := installer.Install(testProfileData(t, testUUID1, "App", "com.example.app", now.Add(-time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Installed.Path != filepath.Join(dir, testUUID1+ProfileExt) {
+		t.Errorf("installed at %s", old.Installed.Path)
+	}
+	// same name for another app id is kept
+	if _, err := installer.Install(testProfileData(t, testUUID2, "App", "com.example.other", now.Add(-2*time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := installer.Install(testProfileData(t, testUUID3, "App", "com.example.app", now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Removed) != 1 || result.Removed[0] != old.Installed.Path {
+		t.Errorf("Removed = %v, want [%s]", result.Removed, old.Installed.Path)
+	}
+	installed, err := installer.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(installed) != 2 {
+		t.Fatalf("got %d installed profiles, want 2", len(installed))
+	}
+
+	// an older profile with the same identity is not written
+	_, err = installer.Install(testProfileData(t, testUUID1, "App", "com.example.app", now.Add(-time.Hour)))
+	if err != ErrNewerProfileInstalled {
+		t.Errorf("installing an older profile error = %v, want ErrNewerProfileInstalled", err)
+	}
+	if _, err := os.Stat(old.Installed.Path); !os.IsNotExist(err) {
+		t.Errorf("older profile written: %v", err)
+	}
+
+	// reinstalling the same profile is allowed
+	if _, err := installer.Install(testProfileData(t, testUUID3, "App", "com.example.app", now)); err != nil {
+		t.Errorf("reinstall: %v", err)
+	}
+}
+
+func TestProfileInstallerInvalidUUID(t *testing.T) {
+	dir := testTempDir(t)
+	installer, err := NewProfileInstaller(filepath.Join(dir, "profiles"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := installer.Install(testProfileData(t, "../escape", "App", "com.example.app", time.Now())); err == nil {
+		t.Error("installed a profile with an invalid UUID")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape"+ProfileExt)); !os.IsNotExist(err) {
+		t.Errorf("profile written outside the directory: %v", err)
+	}
+
+	if err := installer.Remove("../escape"); err == nil || err == ErrProfileNotFound {
+		t.Errorf("Remove invalid UUID error = %v", err)
+	}
+	if err := installer.Remove(testUUID1); err != ErrProfileNotFound {
+		t.Errorf("Remove missing profile error = %v, want ErrProfileNotFound", err)
+	}
+}
@@ -0,0 +1,502 @@
+package apple
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/widuu/apple/pkcs12"
+)
+
+// ErrKeyNotFound private key not found in key store
+var ErrKeyNotFound = errors.New("private key not found")
+
+const (
+	keyStoreSaltSize   = 16
+	keyStoreIterations = 100000
+)
+
+// KeyStore private keys indexed by public key hash
+type KeyStore interface {
+	// Put store the private key and return its public key hash
+	Put(key crypto.PrivateKey) (string, error)
+	// Get return the private key with the public key hash
+	Get(id string) (crypto.PrivateKey, error)
+	// List return public key hashes of all stored keys
+	List() ([]string, error)
+	// Delete remove the private key with the public key hash
+	Delete(id string) error
+}
+
+// PublicKeyHash return hex sha256 of the PKIX encoded public key
+func PublicKeyHash(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// PrivateKeyHash return public key hash of the private key
+func PrivateKeyHash(key crypto.PrivateKey) (string, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return "", errors.New("private key does not implement crypto.Signer")
+	}
+	return PublicKeyHash(signer.Public())
+}
+
+// CertificateKeyHash return public key hash of the certificate
+func CertificateKeyHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
+}
+
+func marshalPrivateKeyPem(key crypto.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// MemoryKeyStore in-memory key store
+type MemoryKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]crypto.PrivateKey
+}
+
+// NewMemoryKeyStore return empty MemoryKeyStore
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: map[string]crypto.PrivateKey{}}
+}
+
+// Put store the private key
+func (s *MemoryKeyStore) Put(key crypto.PrivateKey) (string, error) {
+	id, err := PrivateKeyHash(key)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.keys[id] = key
+	s.mu.Unlock()
+	return id, nil
+}
+
+// Get return the private key
+func (s *MemoryKeyStore) Get(id string) (crypto.PrivateKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+// List return public key hashes
+func (s *MemoryKeyStore) List() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.keys))
+	for id := range s.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Delete remove the private key
+func (s *MemoryKeyStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[id]; !ok {
+		return ErrKeyNotFound
+	}
+	delete(s.keys, id)
+	return nil
+}
+
+// DirKeyStore directory of PEM private key files, new keys are written as <hash>.pem
+type DirKeyStore struct {
+	Dir string
+
+	mu    sync.Mutex
+	files map[string]dirKeyFile // parsed files by name
+}
+
+// dirKeyFile public key hash of a parsed file, reparsed when the file changes
+type dirKeyFile struct {
+	id      string
+	size    int64
+	modTime time.Time
+}
+
+// NewDirKeyStore create the directory if needed and return DirKeyStore
+func NewDirKeyStore(dir string) (*DirKeyStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DirKeyStore{Dir: dir}, nil
+}
+
+// index map public key hash to file, only new or changed PEM files are read
+func (s *DirKeyStore) index() (map[string]string, error) {
+	files, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cache := make(map[string]dirKeyFile, len(files))
+	res := map[string]string{}
+	for _, f := range files {
+		if f.IsDir() || !(strings.HasSuffix(f.Name(), ".pem") || strings.HasSuffix(f.Name(), ".key")) {
+			continue
+		}
+		entry, ok := s.files[f.Name()]
+		if !ok || entry.size != f.Size() || !entry.modTime.Equal(f.ModTime()) {
+			entry = dirKeyFile{size: f.Size(), modTime: f.ModTime()}
+			if key, err := s.readKey(f.Name()); err == nil {
+				// files which are not private keys are cached with an empty id
+				entry.id, _ = PrivateKeyHash(key)
+			} else if err != errNotKeyFile {
+				return nil, err
+			}
+		}
+		cache[f.Name()] = entry
+		if entry.id != "" {
+			res[entry.id] = filepath.Join(s.Dir, f.Name())
+		}
+	}
+	s.files = cache
+	return res, nil
+}
+
+// readKey read and parse the private key file
+func (s *DirKeyStore) readKey(name string) (crypto.PrivateKey, error) {
+	content, err := ioutil.ReadFile(filepath.Join(s.Dir, name))
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParsePrivateKey(string(content))
+	if err != nil {
+		return nil, errNotKeyFile
+	}
+	return key, nil
+}
+
+var errNotKeyFile = errors.New("not a private key file")
+
+// lookup return the file holding the private key, <id>.pem is tried before the index
+func (s *DirKeyStore) lookup(id string) (string, crypto.PrivateKey, error) {
+	if key, err := s.readKey(id + ".pem"); err == nil {
+		if keyID, _ := PrivateKeyHash(key); keyID == id {
+			return filepath.Join(s.Dir, id+".pem"), key, nil
+		}
+	}
+	files, err := s.index()
+	if err != nil {
+		return "", nil, err
+	}
+	name, ok := files[id]
+	if !ok {
+		return "", nil, ErrKeyNotFound
+	}
+	key, err := s.readKey(filepath.Base(name))
+	if err != nil {
+		return "", nil, err
+	}
+	return name, key, nil
+}
+
+// Put write the private key to <hash>.pem
+func (s *DirKeyStore) Put(key crypto.PrivateKey) (string, error) {
+	id, err := PrivateKeyHash(key)
+	if err != nil {
+		return "", err
+	}
+	content, err := marshalPrivateKeyPem(key)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(filepath.Join(s.Dir, id+".pem"), content, 0600); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Get read the private key
+func (s *DirKeyStore) Get(id string) (crypto.PrivateKey, error) {
+	_, key, err := s.lookup(id)
+	return key, err
+}
+
+// List return public key hashes
+func (s *DirKeyStore) List() ([]string, error) {
+	files, err := s.index()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(files))
+	for id := range files {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Delete remove the private key file
+func (s *DirKeyStore) Delete(id string) error {
+	name, _, err := s.lookup(id)
+	if err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// EncryptedFileKeyStore keys kept in one AES-256-GCM encrypted file
+type EncryptedFileKeyStore struct {
+	mu       sync.Mutex // serializes changes and saves
+	path     string
+	password []byte
+	mem      *MemoryKeyStore
+}
+
+// OpenEncryptedFileKeyStore open or create the encrypted key store file
+func OpenEncryptedFileKeyStore(path, password string) (*EncryptedFileKeyStore, error) {
+	s := &EncryptedFileKeyStore{path: path, password: []byte(password), mem: NewMemoryKeyStore()}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	plain, err := s.decrypt(content)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var block *pem.Block
+		block, plain = pem.Decode(plain)
+		if block == nil {
+			break
+		}
+		key, err := parsePrivateKeyBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.mem.Put(key); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *EncryptedFileKeyStore) gcm(salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2Key(s.password, salt, keyStoreIterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt return salt | nonce | ciphertext
+func (s *EncryptedFileKeyStore) encrypt(plain []byte) ([]byte, error) {
+	salt := make([]byte, keyStoreSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := s.gcm(salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(salt, nonce...)
+	return gcm.Seal(out, nonce, plain, nil), nil
+}
+
+func (s *EncryptedFileKeyStore) decrypt(content []byte) ([]byte, error) {
+	if len(content) < keyStoreSaltSize {
+		return nil, errors.New("key store file is corrupted")
+	}
+	gcm, err := s.gcm(content[:keyStoreSaltSize])
+	if err != nil {
+		return nil, err
+	}
+	content = content[keyStoreSaltSize:]
+	if len(content) < gcm.NonceSize() {
+		return nil, errors.New("key store file is corrupted")
+	}
+	plain, err := gcm.Open(nil, content[:gcm.NonceSize()], content[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("incorrect key store password or corrupted file")
+	}
+	return plain, nil
+}
+
+// save write every key to the encrypted file
+func (s *EncryptedFileKeyStore) save() error {
+	ids, _ := s.mem.List()
+	var plain bytes.Buffer
+	for _, id := range ids {
+		key, _ := s.mem.Get(id)
+		content, err := marshalPrivateKeyPem(key)
+		if err != nil {
+			return err
+		}
+		plain.Write(content)
+	}
+	content, err := s.encrypt(plain.Bytes())
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, content, 0600)
+}
+
+// Put store the private key and save the file, the key is not kept when saving fails
+func (s *EncryptedFileKeyStore) Put(key crypto.PrivateKey) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, err := PrivateKeyHash(key)
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.mem.Get(id); err == nil {
+		// already stored
+		return id, nil
+	}
+	if _, err := s.mem.Put(key); err != nil {
+		return "", err
+	}
+	if err := s.save(); err != nil {
+		s.mem.Delete(id)
+		return "", err
+	}
+	return id, nil
+}
+
+// Get return the private key
+func (s *EncryptedFileKeyStore) Get(id string) (crypto.PrivateKey, error) {
+	return s.mem.Get(id)
+}
+
+// List return public key hashes
+func (s *EncryptedFileKeyStore) List() ([]string, error) {
+	return s.mem.List()
+}
+
+// Delete remove the private key and save the file, the key is kept when saving fails
+func (s *EncryptedFileKeyStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, err := s.mem.Get(id)
+	if err != nil {
+		return err
+	}
+	s.mem.Delete(id)
+	if err := s.save(); err != nil {
+		s.mem.Put(key)
+		return err
+	}
+	return nil
+}
+
+// writeFileAtomic write data to a temporary file in the same directory, sync
+// it and rename it over path, so path holds either the old or the new content
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// CertificateKeyPair certificate and the matching private key held in the key store
+type CertificateKeyPair struct {
+	Certificate CertificateData
+	X509        *x509.Certificate
+	KeyID       string
+	// Key is nil when the key store does not hold the private key
+	Key crypto.PrivateKey
+}
+
+// HasKey report whether the private key is held
+func (p CertificateKeyPair) HasKey() bool {
+	return p.Key != nil
+}
+
+// MatchCertificates pair each certificate from CertLists with the private key in the store
+func MatchCertificates(store KeyStore, certs []CertificateData) ([]CertificateKeyPair, error) {
+	res := make([]CertificateKeyPair, 0, len(certs))
+	for _, c := range certs {
+		cert, err := c.Certificate()
+		if err != nil {
+			return nil, err
+		}
+		pair := CertificateKeyPair{Certificate: c, X509: cert, KeyID: CertificateKeyHash(cert)}
+		key, err := store.Get(pair.KeyID)
+		if err != nil && err != ErrKeyNotFound {
+			return nil, err
+		}
+		pair.Key = key
+		res = append(res, pair)
+	}
+	return res, nil
+}
+
+// ExportMatchedCertificates export every certificate with a held private key to p12, keyed by certificate id
+func ExportMatchedCertificates(store KeyStore, certs []CertificateData, password string) (map[string][]byte, error) {
+	pairs, err := MatchCertificates(store, certs)
+	if err != nil {
+		return nil, err
+	}
+	res := map[string][]byte{}
+	for _, pair := range pairs {
+		if !pair.HasKey() {
+			continue
+		}
+		p12, err := pkcs12.Encode(pair.X509.Raw, pair.Key, password)
+		if err != nil {
+			return nil, err
+		}
+		res[pair.Certificate.Id] = p12
+	}
+	return res, nil
+}
@@ -0,0 +1,322 @@
+package apple
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/widuu/apple/pkcs12"
+)
+
+func testECKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// testCertificateData return CertificateData with a self-signed certificate of the key
+func testCertificateData(t *testing.T, id string, key crypto.Signer) CertificateData {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Apple Development: " + id, OrganizationalUnit: []string{"TEAMID1234"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return CertificateData{
+		CertType:   "certificates",
+		Id:         id,
+		Attributes: map[string]string{"certificateContent": base64.StdEncoding.EncodeToString(der)},
+	}
+}
+
+func testTempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// testKeyStore run the KeyStore contract against store
+func testKeyStore(t *testing.T, store KeyStore) {
+	t.Helper()
+	key1, key2 := testECKey(t), testECKey(t)
+	id1, err := store.Put(key1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := PrivateKeyHash(key1); id1 != want {
+		t.Errorf("Put id = %s, want %s", id1, want)
+	}
+	id2, err := store.Put(key2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Get(id1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key1.Equal(got) {
+		t.Error("Get returned a different key")
+	}
+	ids, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{id1, id2}
+	if id2 < id1 {
+		want = []string{id2, id1}
+	}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("List = %v, want %v", ids, want)
+	}
+
+	if err := store.Delete(id1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(id1); err != ErrKeyNotFound {
+		t.Errorf("Get deleted key error = %v, want ErrKeyNotFound", err)
+	}
+	if err := store.Delete(id1); err != ErrKeyNotFound {
+		t.Errorf("Delete deleted key error = %v, want ErrKeyNotFound", err)
+	}
+	if ids, _ := store.List(); !reflect.DeepEqual(ids, []string{id2}) {
+		t.Errorf("List after Delete = %v, want [%s]", ids, id2)
+	}
+}
+
+func TestMemoryKeyStore(t *testing.T) {
+	testKeyStore(t, NewMemoryKeyStore())
+}
+
+func TestDirKeyStore(t *testing.T) {
+	dir := testTempDir(t)
+	store, err := NewDirKeyStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testKeyStore(t, store)
+}
+
+func TestDirKeyStoreForeignFiles(t *testing.T) {
+	dir := testTempDir(t)
+	store, err := NewDirKeyStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := testECKey(t)
+	content, err := EncodePrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// keys not named by their hash are found through the index
+	if err := ioutil.WriteFile(filepath.Join(dir, "dev.key"), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "notes.pem"), []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := PrivateKeyHash(key)
+	if ids, err := store.List(); err != nil || !reflect.DeepEqual(ids, []string{id}) {
+		t.Fatalf("List = %v, %v, want [%s]", ids, err, id)
+	}
+	if _, err := store.Get(id); err != nil {
+		t.Fatal(err)
+	}
+
+	// a changed file is parsed again
+	other := testECKey(t)
+	content, _ = EncodePrivateKey(other)
+	if err := ioutil.WriteFile(filepath.Join(dir, "dev.key"), []byte(content+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	otherID, _ := PrivateKeyHash(other)
+	if ids, _ := store.List(); !reflect.DeepEqual(ids, []string{otherID}) {
+		t.Errorf("List after change = %v, want [%s]", ids, otherID)
+	}
+
+	if err := store.Delete(otherID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dev.key")); !os.IsNotExist(err) {
+		t.Errorf("dev.key not removed: %v", err)
+	}
+}
+
+func TestEncryptedFileKeyStore(t *testing.T) {
+	path := filepath.Join(testTempDir(t), "keys.enc")
+	store, err := OpenEncryptedFileKeyStore(path, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testKeyStore(t, store)
+
+	ids, _ := store.List()
+	reopened, err := OpenEncryptedFileKeyStore(path, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := reopened.List(); !reflect.DeepEqual(got, ids) {
+		t.Errorf("reopened List = %v, want %v", got, ids)
+	}
+	if _, err := OpenEncryptedFileKeyStore(path, "wrong"); err == nil {
+		t.Error("opened with a wrong password")
+	}
+
+	files, _ := ioutil.ReadDir(filepath.Dir(path))
+	if len(files) != 1 {
+		t.Errorf("directory has %d files, want only the key store", len(files))
+	}
+}
+
+func TestEncryptedFileKeyStoreSaveFailure(t *testing.T) {
+	dir := testTempDir(t)
+	path := filepath.Join(dir, "keys.enc")
+	store, err := OpenEncryptedFileKeyStore(path, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := store.Put(testECKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// saving fails once the directory is gone
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Put(testECKey(t)); err == nil {
+		t.Fatal("Put succeeded without a directory")
+	}
+	if ids, _ := store.List(); !reflect.DeepEqual(ids, []string{id}) {
+		t.Errorf("List after failed Put = %v, want [%s]", ids, id)
+	}
+	if err := store.Delete(id); err == nil {
+		t.Fatal("Delete succeeded without a directory")
+	}
+	if _, err := store.Get(id); err != nil {
+		t.Errorf("key lost after failed Delete: %v", err)
+	}
+}
+
+func TestMatchCertificates(t *testing.T) {
+	store := NewMemoryKeyStore()
+	held, missing := testECKey(t), testECKey(t)
+	if _, err := store.Put(held); err != nil {
+		t.Fatal(err)
+	}
+	certs := []CertificateData{
+		testCertificateData(t, "HELD", held),
+		testCertificateData(t, "MISSING", missing),
+	}
+
+	pairs, err := MatchCertificates(store, certs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pairs) != 2 {
+		t.Fatalf("got %d pairs, want 2", len(pairs))
+	}
+	if !pairs[0].HasKey() || !held.Equal(pairs[0].Key) {
+		t.Error("held key not matched")
+	}
+	if pairs[1].HasKey() {
+		t.Error("missing key matched")
+	}
+
+	exported, err := ExportMatchedCertificates(store, certs, "p12pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 1 {
+		t.Fatalf("exported %d certificates, want 1", len(exported))
+	}
+	key, cert, err := pkcs12.Decode(exported["HELD"], "p12pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "Apple Development: HELD" || !held.Equal(key) {
+		t.Errorf("p12 holds %q and a different key", cert.Subject.CommonName)
+	}
+
+	bad := []CertificateData{{Id: "EMPTY", Attributes: map[string]string{}}}
+	if _, err := MatchCertificates(store, bad); err == nil {
+		t.Error("matched a certificate without content")
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey := testECKey(t)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPem, _ := EncodePrivateKey(rsaKey)
+	ecPem, _ := EncodePrivateKey(ecKey)
+	encrypted, err := EncryptPrivateKey(ecKey, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    crypto.PrivateKey
+		err     bool
+	}{
+		{"pkcs1", rsaPem, rsaKey, false},
+		{"ec", ecPem, ecKey, false},
+		{"pkcs8", string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})), ecKey, false},
+		{"encrypted", encrypted, nil, true},
+		{"not pem", "not a key", nil, true},
+		{"garbage", string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("garbage")})), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParsePrivateKey(tt.content)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.want.(interface{ Equal(crypto.PrivateKey) bool }).Equal(key) {
+				t.Error("parsed a different key")
+			}
+		})
+	}
+	if _, err := ParsePrivateKey(encrypted); err != ErrPrivateKeyEncrypted {
+		t.Errorf("encrypted key error = %v, want ErrPrivateKeyEncrypted", err)
+	}
+}
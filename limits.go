@@ -0,0 +1,235 @@
+package apple
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CertificateLimits maximum number of certificates per certificate type,
+// types not listed are not limited
+var CertificateLimits = map[string]int{
+	"DEVELOPMENT":                2,
+	"DISTRIBUTION":               3,
+	"IOS_DEVELOPMENT":            2,
+	"IOS_DISTRIBUTION":           3,
+	"MAC_APP_DEVELOPMENT":        2,
+	"MAC_APP_DISTRIBUTION":       3,
+	"MAC_INSTALLER_DISTRIBUTION": 3,
+	"DEVELOPER_ID_APPLICATION":   5,
+	"DEVELOPER_ID_INSTALLER":     5,
+}
+
+// CertificateUsage certificates of one type
+type CertificateUsage struct {
+	CertificateType string
+	Count           int
+	// Limit is 0 when the type is not limited
+	Limit        int
+	Certificates []CertificateData
+}
+
+// Full report whether the limit is reached
+func (u CertificateUsage) Full() bool {
+	return u.Limit > 0 && u.Count >= u.Limit
+}
+
+// CertificateLimitError the certificate limit of the type is reached
+type CertificateLimitError struct {
+	CertificateType string
+	Limit           int
+}
+
+func (e *CertificateLimitError) Error() string {
+	return fmt.Sprintf("certificate limit reached: %s allows %d certificates", e.CertificateType, e.Limit)
+}
+
+// GetCertificateUsage count certificates of each type
+func GetCertificateUsage(teamId, myacinfo string) (map[string]CertificateUsage, error) {
+	certs, err := listAllCertificates(teamId, myacinfo)
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]CertificateUsage{}
+	for _, c := range certs {
+		certType := c.Attributes["certificateType"]
+		if certType == "" {
+			info, err := c.Info()
+			if err != nil {
+				return nil, err
+			}
+			certType = info.CertificateType
+		}
+		usage := res[certType]
+		usage.CertificateType = certType
+		usage.Count++
+		usage.Limit = CertificateLimits[certType]
+		usage.Certificates = append(usage.Certificates, c)
+		res[certType] = usage
+	}
+	return res, nil
+}
+
+// RevocationPolicy revoke a certificate to make room when the limit is reached
+type RevocationPolicy struct {
+	// CertificateID revoke this certificate, the oldest one is revoked when empty
+	CertificateID string
+	// KeyStore certificates whose private key is in the store are protected
+	KeyStore KeyStore
+	// Force revoke protected certificates
+	Force bool
+}
+
+// inactiveProfileStates profile states which do not protect their certificates
+var inactiveProfileStates = []string{"INVALID", "EXPIRED"}
+
+// profileActive report whether the profileState is active; an empty or unknown
+// state counts as active, so a certificate is only revoked when every profile
+// using it is known to be invalid or expired
+func profileActive(state string) bool {
+	for _, s := range inactiveProfileStates {
+		if strings.EqualFold(state, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// protected return why the certificate must not be revoked, or an empty string
+func (p *RevocationPolicy) protected(c CertificateData, references map[string][]ProfileData) (string, error) {
+	if p.Force {
+		return "", nil
+	}
+	cert, err := c.Certificate()
+	if err != nil {
+		return "", err
+	}
+	if p.KeyStore != nil {
+		_, err := p.KeyStore.Get(CertificateKeyHash(cert))
+		if err == nil {
+			return "private key is held locally", nil
+		}
+		if err != ErrKeyNotFound {
+			return "", err
+		}
+	}
+	info := GetCertificateInfo(cert)
+	for _, profile := range references[info.SHA1] {
+		if profileActive(profile.Attributes["profileState"]) {
+			return "referenced by active profile " + profile.Attributes["name"], nil
+		}
+	}
+	return "", nil
+}
+
+// selectCertificate choose the certificate to revoke from the usage
+func (p *RevocationPolicy) selectCertificate(usage CertificateUsage, teamId, myacinfo string) (CertificateData, error) {
+	references, err := certificateProfiles(teamId, myacinfo)
+	if err != nil {
+		return CertificateData{}, err
+	}
+
+	if p.CertificateID != "" {
+		for _, c := range usage.Certificates {
+			if c.Id != p.CertificateID {
+				continue
+			}
+			reason, err := p.protected(c, references)
+			if err != nil {
+				return CertificateData{}, err
+			}
+			if reason != "" {
+				return CertificateData{}, fmt.Errorf("certificate %s can not be revoked: %s", c.Id, reason)
+			}
+			return c, nil
+		}
+		return CertificateData{}, fmt.Errorf("certificate %s is not a %s certificate", p.CertificateID, usage.CertificateType)
+	}
+
+	// oldest first
+	candidates := make([]CertificateData, len(usage.Certificates))
+	infos := make(map[string]CertificateInfo, len(usage.Certificates))
+	copy(candidates, usage.Certificates)
+	for _, c := range candidates {
+		info, err := c.Info()
+		if err != nil {
+			return CertificateData{}, err
+		}
+		infos[c.Id] = info
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return infos[candidates[i].Id].NotBefore.Before(infos[candidates[j].Id].NotBefore)
+	})
+	for _, c := range candidates {
+		reason, err := p.protected(c, references)
+		if err != nil {
+			return CertificateData{}, err
+		}
+		if reason == "" {
+			return c, nil
+		}
+	}
+	return CertificateData{}, errors.New("no " + usage.CertificateType + " certificate can be revoked safely")
+}
+
+// checkCertificateSigningRequest verify the PEM or base64 der CSR and its signature
+func checkCertificateSigningRequest(csrContent string) error {
+	der := []byte(csrContent)
+	if block, _ := pem.Decode(der); block != nil {
+		der = block.Bytes
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(csrContent))
+		if err != nil {
+			return fmt.Errorf("error decoding certificate signing request: %v", err)
+		}
+		der = decoded
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return fmt.Errorf("error parsing certificate signing request: %v", err)
+	}
+	return csr.CheckSignature()
+}
+
+// CreateCertificateWithPolicy create the certificate, when the limit of the type is reached
+// a certificate is revoked first according to the policy; a nil policy never revokes.
+// The CSR is verified before anything is revoked
+func CreateCertificateWithPolicy(certificateType, csrContent string, policy *RevocationPolicy, teamId, myacinfo string) (CertificateData, error) {
+	if certificateType == "" {
+		return CertificateData{}, errors.New("certificate type is empty")
+	}
+	if err := checkCertificateSigningRequest(csrContent); err != nil {
+		return CertificateData{}, err
+	}
+	usages, err := GetCertificateUsage(teamId, myacinfo)
+	if err != nil {
+		return CertificateData{}, err
+	}
+	usage := usages[certificateType]
+	usage.CertificateType = certificateType
+	usage.Limit = CertificateLimits[certificateType]
+
+	if usage.Full() {
+		if policy == nil {
+			return CertificateData{}, &CertificateLimitError{certificateType, usage.Limit}
+		}
+		revoke, err := policy.selectCertificate(usage, teamId, myacinfo)
+		if err != nil {
+			return CertificateData{}, err
+		}
+		if _, err := DeleteCertficate(revoke.Id, teamId, myacinfo); err != nil {
+			return CertificateData{}, err
+		}
+		certData, err := CreateCertificate(certificateType, csrContent, teamId, myacinfo)
+		if err != nil {
+			return CertificateData{}, fmt.Errorf("create certificate after revoking %s: %v", revoke.Id, err)
+		}
+		return certData, nil
+	}
+
+	return CreateCertificate(certificateType, csrContent, teamId, myacinfo)
+}
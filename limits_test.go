@@ -0,0 +1,113 @@
+package apple
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func TestProfileActive(t *testing.T) {
+	tests := []struct {
+		state  string
+		active bool
+	}{
+		{"ACTIVE", true},
+		{"active", true},
+		{"", true},
+		{"PENDING", true},
+		{"INVALID", false},
+		{"Expired", false},
+	}
+	for _, tt := range tests {
+		if got := profileActive(tt.state); got != tt.active {
+			t.Errorf("profileActive(%q) = %v, want %v", tt.state, got, tt.active)
+		}
+	}
+}
+
+func TestRevocationPolicyProtected(t *testing.T) {
+	key := testECKey(t)
+	cert := testCertificateData(t, "CERT", key)
+	x509Cert, err := cert.Certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha1 := GetCertificateInfo(x509Cert).SHA1
+	profiles := func(states ...string) map[string][]ProfileData {
+		var list []ProfileData
+		for _, state := range states {
+			list = append(list, ProfileData{Attributes: map[string]string{"name": "App " + state, "profileState": state}})
+		}
+		return map[string][]ProfileData{sha1: list}
+	}
+
+	tests := []struct {
+		name       string
+		policy     RevocationPolicy
+		references map[string][]ProfileData
+		protected  bool
+	}{
+		{"unreferenced", RevocationPolicy{}, nil, false},
+		{"active profile", RevocationPolicy{}, profiles("ACTIVE"), true},
+		{"empty state", RevocationPolicy{}, profiles(""), true},
+		{"unknown state", RevocationPolicy{}, profiles("PENDING"), true},
+		{"inactive profiles", RevocationPolicy{}, profiles("INVALID", "EXPIRED"), false},
+		{"one active profile", RevocationPolicy{}, profiles("INVALID", "ACTIVE"), true},
+		{"forced", RevocationPolicy{Force: true}, profiles("ACTIVE"), false},
+		{"key store without key", RevocationPolicy{KeyStore: NewMemoryKeyStore()}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, err := tt.policy.protected(cert, tt.references)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (reason != "") != tt.protected {
+				t.Errorf("protected reason %q, want protected %v", reason, tt.protected)
+			}
+		})
+	}
+
+	store := NewMemoryKeyStore()
+	if _, err := store.Put(key); err != nil {
+		t.Fatal(err)
+	}
+	policy := RevocationPolicy{KeyStore: store}
+	if reason, _ := policy.protected(cert, nil); !strings.Contains(reason, "private key") {
+		t.Errorf("held key reason = %q", reason)
+	}
+}
+
+func TestCheckCertificateSigningRequest(t *testing.T) {
+	csrContent, _, err := GenerateCertificateSigningRequest(CSROptions{CommonName: "dev", KeyType: ECDSAP256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkCertificateSigningRequest(csrContent); err != nil {
+		t.Errorf("PEM request: %v", err)
+	}
+	block, _ := pem.Decode([]byte(csrContent))
+	if err := checkCertificateSigningRequest(base64.StdEncoding.EncodeToString(block.Bytes)); err != nil {
+		t.Errorf("base64 request: %v", err)
+	}
+
+	// a request with a broken signature
+	block.Bytes[len(block.Bytes)-1] ^= 0xff
+	if err := checkCertificateSigningRequest(string(pem.EncodeToMemory(block))); err == nil {
+		t.Error("accepted a request with a broken signature")
+	}
+	if err := checkCertificateSigningRequest("not a request"); err == nil {
+		t.Error("accepted garbage")
+	}
+}
+
+func TestCreateCertificateWithPolicyChecksRequest(t *testing.T) {
+	// fails before any request is sent
+	if _, err := CreateCertificateWithPolicy("IOS_DEVELOPMENT", "not a request", &RevocationPolicy{}, "TEAMID1234", ""); err == nil {
+		t.Error("accepted an invalid request")
+	}
+	if _, err := CreateCertificateWithPolicy("", "", &RevocationPolicy{}, "TEAMID1234", ""); err == nil {
+		t.Error("accepted an empty certificate type")
+	}
+}
@@ -0,0 +1,253 @@
+package apple
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/widuu/apple/pkcs7"
+	"github.com/widuu/apple/plist"
+)
+
+// Profile parsed .mobileprovision file
+type Profile struct {
+	AppIDName                   string
+	ApplicationIdentifierPrefix []string
+	CreationDate                time.Time
+	ExpirationDate              time.Time
+	Platform                    []string
+	IsXcodeManaged              bool
+	DeveloperCertificates       []*x509.Certificate
+	Entitlements                map[string]interface{}
+	Name                        string
+	ProvisionedDevices          []string
+	ProvisionsAllDevices        bool
+	TeamIdentifier              []string
+	TeamName                    string
+	TimeToLive                  int
+	UUID                        string
+	Version                     int
+	// Plist the embedded plist
+	Plist []byte
+	// SignedData the CMS envelope
+	SignedData *pkcs7.SignedData
+}
+
+// profilePlist embedded profile plist keys
+type profilePlist struct {
+	AppIDName                   string                 `plist:"AppIDName"`
+	ApplicationIdentifierPrefix []string               `plist:"ApplicationIdentifierPrefix"`
+	CreationDate                time.Time              `plist:"CreationDate"`
+	ExpirationDate              time.Time              `plist:"ExpirationDate"`
+	Platform                    []string               `plist:"Platform"`
+	IsXcodeManaged              bool                   `plist:"IsXcodeManaged"`
+	DeveloperCertificates       [][]byte               `plist:"DeveloperCertificates"`
+	Entitlements                map[string]interface{} `plist:"Entitlements"`
+	Name                        string                 `plist:"Name"`
+	ProvisionedDevices          []string               `plist:"ProvisionedDevices"`
+	ProvisionsAllDevices        bool                   `plist:"ProvisionsAllDevices"`
+	TeamIdentifier              []string               `plist:"TeamIdentifier"`
+	TeamName                    string                 `plist:"TeamName"`
+	TimeToLive                  int                    `plist:"TimeToLive"`
+	UUID                        string                 `plist:"UUID"`
+	Version                     int                    `plist:"Version"`
+}
+
+// ParseProfile parse .mobileprovision file content
+func ParseProfile(data []byte) (*Profile, error) {
+	sd, err := pkcs7.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(sd.Content) == 0 {
+		return nil, errors.New("profile content is empty")
+	}
+
+	var raw profilePlist
+	if err := plist.Unmarshal(sd.Content, &raw); err != nil {
+		return nil, err
+	}
+
+	profile := &Profile{
+		AppIDName:                   raw.AppIDName,
+		ApplicationIdentifierPrefix: raw.ApplicationIdentifierPrefix,
+		CreationDate:                raw.CreationDate,
+		ExpirationDate:              raw.ExpirationDate,
+		Platform:                    raw.Platform,
+		IsXcodeManaged:              raw.IsXcodeManaged,
+		Entitlements:                raw.Entitlements,
+		Name:                        raw.Name,
+		ProvisionedDevices:          raw.ProvisionedDevices,
+		ProvisionsAllDevices:        raw.ProvisionsAllDevices,
+		TeamIdentifier:              raw.TeamIdentifier,
+		TeamName:                    raw.TeamName,
+		TimeToLive:                  raw.TimeToLive,
+		UUID:                        raw.UUID,
+		Version:                     raw.Version,
+		Plist:                       sd.Content,
+		SignedData:                  sd,
+	}
+	for _, der := range raw.DeveloperCertificates {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		profile.DeveloperCertificates = append(profile.DeveloperCertificates, cert)
+	}
+	return profile, nil
+}
+
+// ParseProfileContent parse base64 profileContent returned by GetProfileContent
+func ParseProfileContent(profileContent string) (*Profile, error) {
+	data, err := base64.StdEncoding.DecodeString(profileContent)
+	if err != nil {
+		return nil, err
+	}
+	return ParseProfile(data)
+}
+
+// TeamID return the first team identifier
+func (p *Profile) TeamID() string {
+	if len(p.TeamIdentifier) > 0 {
+		return p.TeamIdentifier[0]
+	}
+	return ""
+}
+
+// AppID return the application identifier, e.g. TEAMID.com.example.app
+func (p *Profile) AppID() string {
+	if id, ok := p.Entitlements["application-identifier"].(string); ok {
+		return id
+	}
+	id, _ := p.Entitlements["com.apple.application-identifier"].(string)
+	return id
+}
+
+// BundleID return the application identifier without the prefix
+func (p *Profile) BundleID() string {
+	appID := p.AppID()
+	if idx := strings.Index(appID, "."); idx >= 0 {
+		return appID[idx+1:]
+	}
+	return appID
+}
+
+// IsExpired report whether the profile is expired
+func (p *Profile) IsExpired() bool {
+	return time.Now().After(p.ExpirationDate)
+}
+
+// HasCertificate report whether the certificate is a developer certificate of the profile
+func (p *Profile) HasCertificate(cert *x509.Certificate) bool {
+	for _, c := range p.DeveloperCertificates {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+// AppleRootCAFingerprint hex SHA-256 fingerprint of Apple Root CA, the root of provisioning profile signatures
+const AppleRootCAFingerprint = "b0b1730ecbc7ff4505142c49f1295e6eda6bcaed7e2c68c5be91b5a11001f024"
+
+// common names of the certificate which signs provisioning profiles and of its issuer
+const (
+	AppleProfileSigningCommonName   = "Apple iPhone OS Provisioning Profile Signing"
+	AppleProfileSigningCACommonName = "Apple iPhone Certification Authority"
+)
+
+// ProfileVerifier verify provisioning profile signatures
+type ProfileVerifier struct {
+	// Roots trusted roots, nil trusts only the Apple Root CA certificate carried by the
+	// profile, recognized by AppleRootCAFingerprint
+	Roots *x509.CertPool
+	// CurrentTime verification time, zero uses the current time
+	CurrentTime time.Time
+}
+
+// Verify check the profile signature matches its content and chains to the roots through
+// Apple's provisioning profile signing certificate and its issuing CA
+func (v ProfileVerifier) Verify(p *Profile) error {
+	if p.SignedData == nil {
+		return errors.New("profile has no signature")
+	}
+	roots := v.Roots
+	if roots == nil {
+		var err error
+		roots, err = appleRoots(p.SignedData.Certificates)
+		if err != nil {
+			return err
+		}
+	}
+	chains, err := p.SignedData.Verify(x509.VerifyOptions{Roots: roots, CurrentTime: v.CurrentTime})
+	if err != nil {
+		return err
+	}
+	for _, chain := range chains {
+		if err := checkProfileSigner(chain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appleRoots return a pool of the certificates matching AppleRootCAFingerprint
+func appleRoots(certs []*x509.Certificate) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	found := false
+	for _, cert := range certs {
+		sum := sha256.Sum256(cert.Raw)
+		if hex.EncodeToString(sum[:]) == AppleRootCAFingerprint {
+			pool.AddCert(cert)
+			found = true
+		}
+	}
+	if !found {
+		return nil, errors.New("profile does not carry the Apple Root CA certificate")
+	}
+	return pool, nil
+}
+
+// checkProfileSigner require the chain to start with Apple's profile signing certificate
+// issued by Apple's profile signing CA
+func checkProfileSigner(chain []*x509.Certificate) error {
+	if len(chain) < 3 {
+		return errors.New("profile is not signed by Apple: signer is not issued by " + AppleProfileSigningCACommonName)
+	}
+	if !isAppleCertificate(chain[0], AppleProfileSigningCommonName) {
+		return errors.New("profile is not signed by Apple: signer is " + chain[0].Subject.CommonName)
+	}
+	if !isAppleCertificate(chain[1], AppleProfileSigningCACommonName) {
+		return errors.New("profile is not signed by Apple: signer is issued by " + chain[1].Subject.CommonName)
+	}
+	return nil
+}
+
+func isAppleCertificate(cert *x509.Certificate, commonName string) bool {
+	return cert.Subject.CommonName == commonName && stringsContains(cert.Subject.Organization, "Apple Inc.")
+}
+
+// VerifyProfile parse the .mobileprovision file and verify its signature against the roots
+func VerifyProfile(data []byte, roots *x509.CertPool) (*Profile, error) {
+	profile, err := ParseProfile(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := (ProfileVerifier{Roots: roots}).Verify(profile); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func stringsContains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
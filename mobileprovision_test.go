@@ -0,0 +1,202 @@
+package apple
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/widuu/apple/plist"
+)
+
+var (
+	oidTestSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTestData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidTestSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidTestRSA           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidTestMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+)
+
+type testAttribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type testSignerInfo struct {
+	Version   int
+	SID       asn1.RawValue
+	Digest    pkix.AlgorithmIdentifier
+	Attrs     []testAttribute `asn1:"optional,omitempty,tag:0"`
+	SigAlg    pkix.AlgorithmIdentifier
+	Signature []byte
+}
+
+type testSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      struct {
+		ContentType asn1.ObjectIdentifier
+		Content     []byte `asn1:"explicit,optional,tag:0"`
+	}
+	Certificates asn1.RawValue    `asn1:"optional,tag:0"`
+	SignerInfos  []testSignerInfo `asn1:"set"`
+}
+
+type testIdentity struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+// newTestIdentity create a certificate of Apple Inc. signed by parent, or self signed when parent is nil
+func newTestIdentity(t *testing.T, commonName string, parent *testIdentity) *testIdentity {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"Apple Inc."}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	issuer, signer := template, key
+	if parent != nil {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIdentity{cert, key}
+}
+
+// signTestProfile return a .mobileprovision of the profile plist signed by signer
+func signTestProfile(t *testing.T, profile profilePlist, signer *testIdentity, certs ...*x509.Certificate) []byte {
+	t.Helper()
+	content, err := plist.Marshal(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(content)
+	messageDigest, _ := asn1.Marshal(digest[:])
+	attrs := []testAttribute{{
+		Type:  oidTestMessageDigest,
+		Value: asn1.RawValue{Tag: asn1.TagSet, Class: asn1.ClassUniversal, IsCompound: true, Bytes: messageDigest},
+	}}
+	signedAttrs, err := asn1.MarshalWithParams(attrs, "set")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrsDigest := sha256.Sum256(signedAttrs)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, signer.key, crypto.SHA256, attrsDigest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sid, err := asn1.Marshal(struct {
+		Issuer asn1.RawValue
+		Serial *big.Int
+	}{asn1.RawValue{FullBytes: signer.cert.RawIssuer}, signer.cert.SerialNumber})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rawCerts []byte
+	for _, c := range certs {
+		rawCerts = append(rawCerts, c.Raw...)
+	}
+	sd := testSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidTestSHA256}},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: rawCerts},
+		SignerInfos: []testSignerInfo{{
+			Version:   1,
+			SID:       asn1.RawValue{FullBytes: sid},
+			Digest:    pkix.AlgorithmIdentifier{Algorithm: oidTestSHA256},
+			Attrs:     attrs,
+			SigAlg:    pkix.AlgorithmIdentifier{Algorithm: oidTestRSA},
+			Signature: signature,
+		}},
+	}
+	sd.ContentInfo.ContentType = oidTestData
+	sd.ContentInfo.Content = content
+	inner, err := asn1.Marshal(sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{oidTestSignedData, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestProfileVerifier(t *testing.T) {
+	root := newTestIdentity(t, "Apple Root CA", nil)
+	ca := newTestIdentity(t, AppleProfileSigningCACommonName, root)
+	signing := newTestIdentity(t, AppleProfileSigningCommonName, ca)
+	developer := newTestIdentity(t, "Apple Development: Forged", ca)
+	direct := newTestIdentity(t, AppleProfileSigningCommonName, root)
+	otherCA := newTestIdentity(t, "Apple Worldwide Developer Relations Certification Authority", root)
+	otherSigning := newTestIdentity(t, AppleProfileSigningCommonName, otherCA)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root.cert)
+	profile := profilePlist{Name: "App", UUID: "0f6e2c8e-5f3a-4a57-9f1b-4d2f1f3a9b10"}
+
+	tests := []struct {
+		name   string
+		signer *testIdentity
+		certs  []*x509.Certificate
+		err    string
+	}{
+		{"apple signing certificate", signing, []*x509.Certificate{signing.cert, ca.cert, root.cert}, ""},
+		{"developer certificate", developer, []*x509.Certificate{developer.cert, ca.cert, root.cert}, "signer is Apple Development: Forged"},
+		{"signed by the root", direct, []*x509.Certificate{direct.cert, root.cert}, "not issued by"},
+		{"other intermediate", otherSigning, []*x509.Certificate{otherSigning.cert, otherCA.cert, root.cert}, "issued by Apple Worldwide"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseProfile(signTestProfile(t, profile, tt.signer, tt.certs...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ProfileVerifier{Roots: roots}.Verify(parsed)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	// the default roots only trust the real Apple Root CA
+	data := signTestProfile(t, profile, signing, signing.cert, ca.cert, root.cert)
+	if _, err := VerifyProfile(data, nil); err == nil || !strings.Contains(err.Error(), "Apple Root CA") {
+		t.Errorf("default roots error = %v, want missing Apple Root CA", err)
+	}
+	if _, err := VerifyProfile(data, roots); err != nil {
+		t.Errorf("VerifyProfile: %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package apple
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"testing"
+)
+
+// RFC 6070 PBKDF2-HMAC-SHA1 test vectors, without the 16777216 iteration one
+var pbkdf2SHA1Tests = []struct {
+	password, salt string
+	iter, keyLen   int
+	want           string
+}{
+	{"password", "salt", 1, 20, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+	{"password", "salt", 2, 20, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+	{"password", "salt", 4096, 20, "4b007901b765489abead49d926f721d065a429c1"},
+	{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, 25, "3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038"},
+	{"pass\x00word", "sa\x00lt", 4096, 16, "56fa6aa75548099dcc37d7f03425e0c3"},
+}
+
+func TestPBKDF2Key(t *testing.T) {
+	for _, tt := range pbkdf2SHA1Tests {
+		want, _ := hex.DecodeString(tt.want)
+		got := pbkdf2Key([]byte(tt.password), []byte(tt.salt), tt.iter, tt.keyLen, sha1.New)
+		if !bytes.Equal(got, want) {
+			t.Errorf("pbkdf2Key(%q, %q, %d) = %x, want %s", tt.password, tt.salt, tt.iter, got, tt.want)
+		}
+	}
+}
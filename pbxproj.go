@@ -0,0 +1,609 @@
+package apple
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/widuu/apple/plist"
+)
+
+// Xcode build settings used for signing
+const (
+	BuildSettingBundleIdentifier = "PRODUCT_BUNDLE_IDENTIFIER"
+	BuildSettingDevelopmentTeam  = "DEVELOPMENT_TEAM"
+	BuildSettingCodeSignStyle    = "CODE_SIGN_STYLE"
+	BuildSettingCodeSignIdentity = "CODE_SIGN_IDENTITY"
+	BuildSettingProfileSpecifier = "PROVISIONING_PROFILE_SPECIFIER"
+)
+
+// PBXObject object of the project objects dictionary
+type PBXObject map[string]interface{}
+
+// ISA return the object class, e.g. PBXNativeTarget
+func (o PBXObject) ISA() string {
+	return o.String("isa")
+}
+
+// String return the string value of key
+func (o PBXObject) String(key string) string {
+	v, _ := o[key].(string)
+	return v
+}
+
+// Strings return the string list value of key
+func (o PBXObject) Strings(key string) []string {
+	list, _ := o[key].([]interface{})
+	res := make([]string, 0, len(list))
+	for _, v := range list {
+		if s, ok := v.(string); ok {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// XcodeBuildConfiguration XCBuildConfiguration object
+type XcodeBuildConfiguration struct {
+	ID            string
+	Name          string
+	BuildSettings map[string]interface{}
+}
+
+// XcodeTarget target of the project
+type XcodeTarget struct {
+	ID             string
+	ISA            string
+	Name           string
+	ProductName    string
+	ProductType    string
+	Configurations []XcodeBuildConfiguration
+}
+
+// XcodeProject project.pbxproj object graph, edits are applied to the original text
+// so writing the project back only changes the edited lines
+type XcodeProject struct {
+	ArchiveVersion string
+	ObjectVersion  string
+	RootObject     string
+	Objects        map[string]PBXObject
+
+	data []byte
+	// settings offsets of the '{' of the buildSettings of each build configuration,
+	// indexed on the first edit and shifted by every edit after it
+	settings map[string]int
+}
+
+type pbxprojFile struct {
+	ArchiveVersion string               `plist:"archiveVersion"`
+	ObjectVersion  string               `plist:"objectVersion"`
+	RootObject     string               `plist:"rootObject"`
+	Objects        map[string]PBXObject `plist:"objects"`
+}
+
+// ParseXcodeProject parse project.pbxproj content
+func ParseXcodeProject(data []byte) (*XcodeProject, error) {
+	var file pbxprojFile
+	if err := plist.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if _, ok := file.Objects[file.RootObject]; !ok {
+		return nil, errors.New("pbxproj: root object not found")
+	}
+	return &XcodeProject{
+		ArchiveVersion: file.ArchiveVersion,
+		ObjectVersion:  file.ObjectVersion,
+		RootObject:     file.RootObject,
+		Objects:        file.Objects,
+		data:           data,
+	}, nil
+}
+
+// ReadXcodeProject read a project.pbxproj file, or the one inside an .xcodeproj directory
+func ReadXcodeProject(path string) (*XcodeProject, error) {
+	if strings.HasSuffix(strings.TrimRight(path, "/"), ".xcodeproj") {
+		path = strings.TrimRight(path, "/") + "/project.pbxproj"
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseXcodeProject(data)
+}
+
+// Bytes return the project file content
+func (p *XcodeProject) Bytes() []byte {
+	return p.data
+}
+
+// WriteFile write the project file content to path
+func (p *XcodeProject) WriteFile(path string) error {
+	return ioutil.WriteFile(path, p.data, 0644)
+}
+
+// Targets return the project targets in project order
+func (p *XcodeProject) Targets() []XcodeTarget {
+	var targets []XcodeTarget
+	for _, id := range p.Objects[p.RootObject].Strings("targets") {
+		obj, ok := p.Objects[id]
+		if !ok {
+			continue
+		}
+		targets = append(targets, XcodeTarget{
+			ID:             id,
+			ISA:            obj.ISA(),
+			Name:           obj.String("name"),
+			ProductName:    obj.String("productName"),
+			ProductType:    obj.String("productType"),
+			Configurations: p.configurations(obj.String("buildConfigurationList")),
+		})
+	}
+	return targets
+}
+
+// Target return the target with the name
+func (p *XcodeProject) Target(name string) (XcodeTarget, error) {
+	for _, t := range p.Targets() {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+	return XcodeTarget{}, fmt.Errorf("pbxproj: target %q not found", name)
+}
+
+// ProjectConfigurations return the project level build configurations
+func (p *XcodeProject) ProjectConfigurations() []XcodeBuildConfiguration {
+	return p.configurations(p.Objects[p.RootObject].String("buildConfigurationList"))
+}
+
+func (p *XcodeProject) configurations(listId string) []XcodeBuildConfiguration {
+	var res []XcodeBuildConfiguration
+	for _, id := range p.Objects[listId].Strings("buildConfigurations") {
+		obj, ok := p.Objects[id]
+		if !ok {
+			continue
+		}
+		settings, _ := obj["buildSettings"].(map[string]interface{})
+		res = append(res, XcodeBuildConfiguration{ID: id, Name: obj.String("name"), BuildSettings: settings})
+	}
+	return res
+}
+
+// SetBuildSetting set key in the build settings of the XCBuildConfiguration,
+// value is a string or a string list
+func (p *XcodeProject) SetBuildSetting(configurationId, key string, value interface{}) error {
+	encoded, err := plist.MarshalFormat(value, plist.OpenStepFormat)
+	if err != nil {
+		return err
+	}
+	encoded = bytes.TrimSuffix(encoded, []byte("\n"))
+
+	open, err := p.buildSettingsOffset(configurationId)
+	if err != nil {
+		return err
+	}
+	entries, close, err := scanPBXDict(p.data, open)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.key == key {
+			p.replace(e.valueStart, e.valueEnd, encoded)
+			return p.setObjectBuildSetting(configurationId, key, encoded)
+		}
+	}
+
+	if len(entries) > 0 && bytes.IndexByte(p.data[open:close], '\n') < 0 {
+		// one-line dictionary, insert on the same line keeping the keys sorted
+		entry := encodePBXString(key) + " = " + string(encoded) + ";"
+		at, text := entries[len(entries)-1].end, " "+entry
+		for _, e := range entries {
+			if e.key > key {
+				at, text = e.start, entry+" "
+				break
+			}
+		}
+		p.replace(at, at, []byte(text))
+		return p.setObjectBuildSetting(configurationId, key, encoded)
+	}
+
+	// insert keeping the keys sorted, with the indentation of the existing entries
+	indent := lineIndent(p.data, close) + "\t"
+	at := close
+	for i := len(p.data[:close]) - 1; i >= 0 && (p.data[i] == '\t' || p.data[i] == ' '); i-- {
+		at = i
+	}
+	for _, e := range entries {
+		if e.key > key {
+			at = lineStart(p.data, e.start)
+			indent = lineIndent(p.data, e.start)
+			break
+		}
+		indent = lineIndent(p.data, e.start)
+	}
+	line := indent + encodePBXString(key) + " = " + string(encoded) + ";\n"
+	if at == close {
+		// the closing brace shares its line with the opening brace
+		line = "\n" + line + lineIndent(p.data, close)
+	}
+	p.replace(at, at, []byte(line))
+	return p.setObjectBuildSetting(configurationId, key, encoded)
+}
+
+// setObjectBuildSetting update Objects with the encoded value written to the text
+func (p *XcodeProject) setObjectBuildSetting(configurationId, key string, encoded []byte) error {
+	var value interface{}
+	if err := plist.Unmarshal(encoded, &value); err != nil {
+		return err
+	}
+	obj := p.Objects[configurationId]
+	settings, ok := obj["buildSettings"].(map[string]interface{})
+	if !ok {
+		settings = map[string]interface{}{}
+		obj["buildSettings"] = settings
+	}
+	settings[key] = value
+	return nil
+}
+
+// RemoveBuildSetting remove key from the build settings of the XCBuildConfiguration
+func (p *XcodeProject) RemoveBuildSetting(configurationId, key string) error {
+	open, err := p.buildSettingsOffset(configurationId)
+	if err != nil {
+		return err
+	}
+	entries, _, err := scanPBXDict(p.data, open)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.key != key {
+			continue
+		}
+		start, end := e.start, e.end
+		if ls := lineStart(p.data, e.start); strings.TrimSpace(string(p.data[ls:e.start])) == "" {
+			// remove the whole line, with a trailing comment of the entry
+			rest := end
+			for rest < len(p.data) && (p.data[rest] == ' ' || p.data[rest] == '\t') {
+				rest++
+			}
+			if bytes.HasPrefix(p.data[rest:], []byte("//")) {
+				if i := bytes.IndexByte(p.data[rest:], '\n'); i >= 0 {
+					rest += i
+				} else {
+					rest = len(p.data)
+				}
+			}
+			if rest == len(p.data) || p.data[rest] == '\n' {
+				start, end = ls, rest
+				if end < len(p.data) {
+					end++
+				}
+			}
+		}
+		p.replace(start, end, nil)
+		if settings, ok := p.Objects[configurationId]["buildSettings"].(map[string]interface{}); ok {
+			delete(settings, key)
+		}
+		return nil
+	}
+	return nil
+}
+
+// SetTargetBuildSetting set key in every configuration of the target, or only in the named configuration
+func (p *XcodeProject) SetTargetBuildSetting(target, configuration, key string, value interface{}) error {
+	t, err := p.Target(target)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, c := range t.Configurations {
+		if configuration != "" && c.Name != configuration {
+			continue
+		}
+		found = true
+		if err := p.SetBuildSetting(c.ID, key, value); err != nil {
+			return err
+		}
+	}
+	if !found {
+		return fmt.Errorf("pbxproj: configuration %q not found in target %q", configuration, target)
+	}
+	return nil
+}
+
+// replace the data between start and end, the buildSettings offsets after the edit are shifted;
+// the caller updates Objects, so the project is not parsed again
+func (p *XcodeProject) replace(start, end int, content []byte) {
+	data := make([]byte, 0, len(p.data)-(end-start)+len(content))
+	data = append(data, p.data[:start]...)
+	data = append(data, content...)
+	data = append(data, p.data[end:]...)
+	p.data = data
+
+	delta := len(content) - (end - start)
+	for id, offset := range p.settings {
+		if offset >= end {
+			p.settings[id] = offset + delta
+		}
+	}
+}
+
+// buildSettingsOffset return the offset of the '{' of the buildSettings of the configuration
+func (p *XcodeProject) buildSettingsOffset(configurationId string) (int, error) {
+	if p.Objects[configurationId].ISA() != "XCBuildConfiguration" {
+		return 0, fmt.Errorf("pbxproj: %s is not a build configuration", configurationId)
+	}
+	if p.settings == nil {
+		if err := p.indexBuildSettings(); err != nil {
+			return 0, err
+		}
+	}
+	offset, ok := p.settings[configurationId]
+	if !ok {
+		return 0, fmt.Errorf("pbxproj: buildSettings of %s not found", configurationId)
+	}
+	return offset, nil
+}
+
+// indexBuildSettings scan the objects once for the buildSettings offsets of every build configuration
+func (p *XcodeProject) indexBuildSettings() error {
+	root := skipPBXSpace(p.data, 0)
+	if root >= len(p.data) || p.data[root] != '{' {
+		return errors.New("pbxproj: root dictionary not found")
+	}
+	entries, _, err := scanPBXDict(p.data, root)
+	if err != nil {
+		return err
+	}
+	objects := -1
+	for _, e := range entries {
+		if e.key == "objects" && p.data[e.valueStart] == '{' {
+			objects = e.valueStart
+			break
+		}
+	}
+	if objects < 0 {
+		return errors.New("pbxproj: objects not found")
+	}
+	if entries, _, err = scanPBXDict(p.data, objects); err != nil {
+		return err
+	}
+
+	settings := map[string]int{}
+	for _, obj := range entries {
+		if p.Objects[obj.key].ISA() != "XCBuildConfiguration" || p.data[obj.valueStart] != '{' {
+			continue
+		}
+		fields, _, err := scanPBXDict(p.data, obj.valueStart)
+		if err != nil {
+			return err
+		}
+		for _, e := range fields {
+			if e.key == "buildSettings" && p.data[e.valueStart] == '{' {
+				settings[obj.key] = e.valueStart
+				break
+			}
+		}
+	}
+	p.settings = settings
+	return nil
+}
+
+// SigningSettings signing build settings of a target
+type SigningSettings struct {
+	BundleIdentifier string
+	TeamID           string
+	// CodeSignStyle Manual or Automatic
+	CodeSignStyle string
+	// CodeSignIdentity e.g. Apple Development, empty keeps the current value
+	CodeSignIdentity string
+	// ProfileSpecifier provisioning profile name
+	ProfileSpecifier string
+}
+
+// NewSigningSettings manual signing settings from the GetTeamID team, AddBundleID App ID and CreateProfile profile
+func NewSigningSettings(teamId string, app AppId, profile ProvisioningProfile) SigningSettings {
+	return SigningSettings{
+		BundleIdentifier: app.Identifier,
+		TeamID:           teamId,
+		CodeSignStyle:    "Manual",
+		ProfileSpecifier: profile.Name,
+	}
+}
+
+func (s SigningSettings) buildSettings() [][2]string {
+	settings := [][2]string{
+		{BuildSettingBundleIdentifier, s.BundleIdentifier},
+		{BuildSettingDevelopmentTeam, s.TeamID},
+		{BuildSettingCodeSignStyle, s.CodeSignStyle},
+		{BuildSettingCodeSignIdentity, s.CodeSignIdentity},
+		{BuildSettingProfileSpecifier, s.ProfileSpecifier},
+	}
+	res := settings[:0]
+	for _, kv := range settings {
+		if kv[1] != "" {
+			res = append(res, kv)
+		}
+	}
+	return res
+}
+
+// SetSigning set the signing build settings of every configuration of the target,
+// or only of the named configuration, empty settings are left unchanged
+func (p *XcodeProject) SetSigning(target, configuration string, s SigningSettings) error {
+	for _, kv := range s.buildSettings() {
+		if err := p.SetTargetBuildSetting(target, configuration, kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pbxEntry offsets of a key = value; entry in the project text
+type pbxEntry struct {
+	key        string
+	start      int // start of the key
+	valueStart int
+	valueEnd   int // end of the value, before the ';'
+	end        int // after the ';'
+}
+
+// scanPBXDict scan the entries of the dictionary starting at the '{' at open
+// and return them with the offset of the closing '}'
+func scanPBXDict(data []byte, open int) ([]pbxEntry, int, error) {
+	var entries []pbxEntry
+	pos := open + 1
+	for {
+		pos = skipPBXSpace(data, pos)
+		if pos >= len(data) {
+			return nil, 0, errors.New("pbxproj: unterminated dictionary")
+		}
+		if data[pos] == '}' {
+			return entries, pos, nil
+		}
+		start := pos
+		keyEnd, err := skipPBXValue(data, pos)
+		if err != nil {
+			return nil, 0, err
+		}
+		key, err := decodePBXString(data[start:keyEnd])
+		if err != nil {
+			return nil, 0, err
+		}
+		pos = skipPBXSpace(data, keyEnd)
+		if pos >= len(data) || data[pos] != '=' {
+			return nil, 0, fmt.Errorf("pbxproj: expected '=' after %q", key)
+		}
+		valueStart := skipPBXSpace(data, pos+1)
+		valueEnd, err := skipPBXValue(data, valueStart)
+		if err != nil {
+			return nil, 0, err
+		}
+		pos = skipPBXSpace(data, valueEnd)
+		if pos >= len(data) || data[pos] != ';' {
+			return nil, 0, fmt.Errorf("pbxproj: expected ';' after %q", key)
+		}
+		pos++
+		entries = append(entries, pbxEntry{key, start, valueStart, valueEnd, pos})
+	}
+}
+
+// skipPBXValue return the offset after the value starting at pos
+func skipPBXValue(data []byte, pos int) (int, error) {
+	if pos >= len(data) {
+		return 0, errors.New("pbxproj: unexpected end of file")
+	}
+	switch c := data[pos]; c {
+	case '{', '(':
+		depth := 0
+		for pos < len(data) {
+			pos = skipPBXSpace(data, pos)
+			if pos >= len(data) {
+				break
+			}
+			switch data[pos] {
+			case '{', '(':
+				depth++
+			case '}', ')':
+				depth--
+				if depth == 0 {
+					return pos + 1, nil
+				}
+			case '"', '\'':
+				end, err := skipPBXValue(data, pos)
+				if err != nil {
+					return 0, err
+				}
+				pos = end
+				continue
+			}
+			pos++
+		}
+		return 0, errors.New("pbxproj: unterminated collection")
+	case '"', '\'':
+		for i := pos + 1; i < len(data); i++ {
+			switch data[i] {
+			case '\\':
+				i++
+			case c:
+				return i + 1, nil
+			}
+		}
+		return 0, errors.New("pbxproj: unterminated string")
+	case '<':
+		end := bytes.IndexByte(data[pos:], '>')
+		if end < 0 {
+			return 0, errors.New("pbxproj: unterminated data")
+		}
+		return pos + end + 1, nil
+	default:
+		end := pos
+		for end < len(data) && strings.IndexByte(" \t\r\n;=,)}", data[end]) < 0 &&
+			!bytes.HasPrefix(data[end:], []byte("//")) && !bytes.HasPrefix(data[end:], []byte("/*")) {
+			end++
+		}
+		if end == pos {
+			return 0, fmt.Errorf("pbxproj: unexpected %q", c)
+		}
+		return end, nil
+	}
+}
+
+// skipPBXSpace return the offset of the next character that is not whitespace or in a comment
+func skipPBXSpace(data []byte, pos int) int {
+	for pos < len(data) {
+		switch {
+		case strings.IndexByte(" \t\r\n", data[pos]) >= 0:
+			pos++
+		case bytes.HasPrefix(data[pos:], []byte("//")):
+			end := bytes.IndexByte(data[pos:], '\n')
+			if end < 0 {
+				return len(data)
+			}
+			pos += end
+		case bytes.HasPrefix(data[pos:], []byte("/*")):
+			end := bytes.Index(data[pos+2:], []byte("*/"))
+			if end < 0 {
+				return len(data)
+			}
+			pos += end + 4
+		default:
+			return pos
+		}
+	}
+	return pos
+}
+
+func decodePBXString(token []byte) (string, error) {
+	if len(token) > 0 && token[0] != '"' && token[0] != '\'' {
+		// unquoted strings, like object ids, need no unescaping
+		return string(token), nil
+	}
+	var s string
+	if err := plist.Unmarshal(token, &s); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+func encodePBXString(s string) string {
+	encoded, _ := plist.MarshalFormat(s, plist.OpenStepFormat)
+	return string(bytes.TrimSuffix(encoded, []byte("\n")))
+}
+
+func lineStart(data []byte, pos int) int {
+	return bytes.LastIndexByte(data[:pos], '\n') + 1
+}
+
+func lineIndent(data []byte, pos int) string {
+	start := lineStart(data, pos)
+	end := start
+	for end < pos && (data[end] == '\t' || data[end] == ' ') {
+		end++
+	}
+	return string(data[start:end])
+}
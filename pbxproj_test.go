@@ -0,0 +1,292 @@
+package apple
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPBXProject = `// !$*UTF8*$!
+{
+	archiveVersion = 1;
+	classes = {
+	};
+	objectVersion = 50;
+	objects = {
+
+/* Begin PBXNativeTarget section */
+		T1 /* App */ = {
+			isa = PBXNativeTarget;
+			buildConfigurationList = TL /* Build configuration list for PBXNativeTarget "App" */;
+			name = App;
+			productName = App;
+			productType = "com.apple.product-type.application";
+		};
+/* End PBXNativeTarget section */
+
+/* Begin PBXProject section */
+		P1 /* Project object */ = {
+			isa = PBXProject;
+			buildConfigurationList = PL /* Build configuration list for PBXProject "App" */;
+			targets = (
+				T1 /* App */,
+			);
+		};
+/* End PBXProject section */
+
+/* Begin XCBuildConfiguration section */
+		PD /* Debug */ = {
+			isa = XCBuildConfiguration;
+			buildSettings = { ONLY_ACTIVE_ARCH = YES; SDKROOT = iphoneos; };
+			name = Debug;
+		};
+		TD /* Debug */ = {
+			isa = XCBuildConfiguration;
+			buildSettings = {
+				/* signing */
+				CODE_SIGN_STYLE = Automatic;
+				INFOPLIST_FILE = App/Info.plist; // app plist
+				PRODUCT_NAME = "$(TARGET_NAME)";
+			};
+			name = Debug;
+		};
+		TR /* Release */ = {
+			isa = XCBuildConfiguration;
+			buildSettings = {};
+			name = Release;
+		};
+/* End XCBuildConfiguration section */
+
+/* Begin XCConfigurationList section */
+		PL /* Build configuration list for PBXProject "App" */ = {
+			isa = XCConfigurationList;
+			buildConfigurations = (
+				PD /* Debug */,
+			);
+		};
+		TL /* Build configuration list for PBXNativeTarget "App" */ = {
+			isa = XCConfigurationList;
+			buildConfigurations = (
+				TD /* Debug */,
+				TR /* Release */,
+			);
+		};
+/* End XCConfigurationList section */
+	};
+	rootObject = P1 /* Project object */;
+}
+`
+
+// parseTestProject parse content, failing the test on error
+func parseTestProject(t *testing.T, content string) *XcodeProject {
+	t.Helper()
+	p, err := ParseXcodeProject([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// checkRoundTrip check the edited text parses to the objects edited in memory
+func checkRoundTrip(t *testing.T, p *XcodeProject) *XcodeProject {
+	t.Helper()
+	reparsed, err := ParseXcodeProject(p.Bytes())
+	if err != nil {
+		t.Fatalf("edited project does not parse: %v\n%s", err, p.Bytes())
+	}
+	if !reflect.DeepEqual(reparsed.Objects, p.Objects) {
+		t.Errorf("edited objects differ from the parsed text\n%s", p.Bytes())
+	}
+	return reparsed
+}
+
+func buildSettingsOf(p *XcodeProject, id string) map[string]interface{} {
+	settings, _ := p.Objects[id]["buildSettings"].(map[string]interface{})
+	return settings
+}
+
+func TestSetBuildSetting(t *testing.T) {
+	p := parseTestProject(t, testPBXProject)
+
+	// replace, insert before and after existing keys, and insert a list
+	if err := p.SetBuildSetting("TD", "CODE_SIGN_STYLE", "Manual"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetBuildSetting("TD", "ASSETCATALOG_COMPILER_APPICON_NAME", "AppIcon"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetBuildSetting("TD", "SWIFT_VERSION", "5.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetBuildSetting("TD", "LD_RUNPATH_SEARCH_PATHS", []string{"$(inherited)", "@executable_path/Frameworks"}); err != nil {
+		t.Fatal(err)
+	}
+	// empty and one-line dictionaries
+	if err := p.SetBuildSetting("TR", BuildSettingCodeSignIdentity, "Apple Distribution: Widuu (TEAMID1234)"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetBuildSetting("PD", "CLANG_ENABLE_MODULES", "YES"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetBuildSetting("PD", "TARGETED_DEVICE_FAMILY", "1,2"); err != nil {
+		t.Fatal(err)
+	}
+
+	reparsed := checkRoundTrip(t, p)
+	want := map[string]interface{}{
+		"ASSETCATALOG_COMPILER_APPICON_NAME": "AppIcon",
+		"CODE_SIGN_STYLE":                    "Manual",
+		"INFOPLIST_FILE":                     "App/Info.plist",
+		"LD_RUNPATH_SEARCH_PATHS":            []interface{}{"$(inherited)", "@executable_path/Frameworks"},
+		"PRODUCT_NAME":                       "$(TARGET_NAME)",
+		"SWIFT_VERSION":                      "5.0",
+	}
+	if got := buildSettingsOf(reparsed, "TD"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Debug buildSettings = %v, want %v", got, want)
+	}
+	if got := buildSettingsOf(reparsed, "TR")[BuildSettingCodeSignIdentity]; got != "Apple Distribution: Widuu (TEAMID1234)" {
+		t.Errorf("Release %s = %v", BuildSettingCodeSignIdentity, got)
+	}
+	if got := buildSettingsOf(reparsed, "PD"); len(got) != 4 || got["TARGETED_DEVICE_FAMILY"] != "1,2" {
+		t.Errorf("project Debug buildSettings = %v", got)
+	}
+
+	text := string(p.Bytes())
+	for _, s := range []string{
+		"/* signing */",
+		"INFOPLIST_FILE = App/Info.plist; // app plist",
+		"PD /* Debug */ = {",
+		`CODE_SIGN_IDENTITY = "Apple Distribution: Widuu (TEAMID1234)";`,
+		`buildSettings = { CLANG_ENABLE_MODULES = YES; ONLY_ACTIVE_ARCH = YES; SDKROOT = iphoneos; TARGETED_DEVICE_FAMILY = "1,2"; };`,
+		"\t\t\t\tASSETCATALOG_COMPILER_APPICON_NAME = AppIcon;\n\t\t\t\tCODE_SIGN_STYLE = Manual;\n",
+		"buildSettings = {\n\t\t\t\tCODE_SIGN_IDENTITY",
+	} {
+		if !strings.Contains(text, s) {
+			t.Errorf("edited project does not contain %q\n%s", s, text)
+		}
+	}
+
+	if err := p.SetBuildSetting("T1", "SWIFT_VERSION", "5.0"); err == nil {
+		t.Error("set a build setting of a target")
+	}
+	if err := p.SetBuildSetting("MISSING", "SWIFT_VERSION", "5.0"); err == nil {
+		t.Error("set a build setting of a missing configuration")
+	}
+}
+
+func TestRemoveBuildSetting(t *testing.T) {
+	p := parseTestProject(t, testPBXProject)
+	for _, kv := range [][2]string{
+		{"TD", "CODE_SIGN_STYLE"},
+		{"TD", "INFOPLIST_FILE"},
+		{"PD", "ONLY_ACTIVE_ARCH"},
+		{"TR", "SWIFT_VERSION"}, // not set, nothing to remove
+	} {
+		if err := p.RemoveBuildSetting(kv[0], kv[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reparsed := checkRoundTrip(t, p)
+	if got := buildSettingsOf(reparsed, "TD"); !reflect.DeepEqual(got, map[string]interface{}{"PRODUCT_NAME": "$(TARGET_NAME)"}) {
+		t.Errorf("Debug buildSettings = %v", got)
+	}
+	if got := buildSettingsOf(reparsed, "PD"); !reflect.DeepEqual(got, map[string]interface{}{"SDKROOT": "iphoneos"}) {
+		t.Errorf("project Debug buildSettings = %v", got)
+	}
+	text := string(p.Bytes())
+	if !strings.Contains(text, "\t\t\t\t/* signing */\n\t\t\t\tPRODUCT_NAME") {
+		t.Errorf("comment or indentation lost\n%s", text)
+	}
+	if strings.Contains(text, "app plist") {
+		t.Errorf("trailing comment of a removed entry kept on its own line\n%s", text)
+	}
+
+	if err := p.RemoveBuildSetting("MISSING", "SWIFT_VERSION"); err == nil {
+		t.Error("removed a build setting of a missing configuration")
+	}
+}
+
+func TestSetSigning(t *testing.T) {
+	p := parseTestProject(t, testPBXProject)
+	s := NewSigningSettings("TEAMID1234", AppId{Identifier: "com.widuu.app"}, ProvisioningProfile{Name: "App Development"})
+	s.CodeSignIdentity = "Apple Development"
+	if err := p.SetSigning("App", "", s); err != nil {
+		t.Fatal(err)
+	}
+
+	reparsed := checkRoundTrip(t, p)
+	target, err := reparsed.Target("App")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range target.Configurations {
+		for _, kv := range s.buildSettings() {
+			if got := c.BuildSettings[kv[0]]; got != kv[1] {
+				t.Errorf("%s %s = %v, want %s", c.Name, kv[0], got, kv[1])
+			}
+		}
+	}
+	if !strings.Contains(string(p.Bytes()), `PROVISIONING_PROFILE_SPECIFIER = "App Development";`) {
+		t.Errorf("profile name not quoted\n%s", p.Bytes())
+	}
+	if got := buildSettingsOf(reparsed, "PD"); len(got) != 2 {
+		t.Errorf("project buildSettings changed: %v", got)
+	}
+
+	if err := p.SetSigning("App", "Release", SigningSettings{TeamID: "OTHERTEAM1"}); err != nil {
+		t.Fatal(err)
+	}
+	reparsed = checkRoundTrip(t, p)
+	if got := buildSettingsOf(reparsed, "TD")[BuildSettingDevelopmentTeam]; got != "TEAMID1234" {
+		t.Errorf("Debug team = %v, want unchanged", got)
+	}
+	if got := buildSettingsOf(reparsed, "TR")[BuildSettingDevelopmentTeam]; got != "OTHERTEAM1" {
+		t.Errorf("Release team = %v", got)
+	}
+
+	before := string(p.Bytes())
+	if err := p.SetSigning("Missing", "", s); err == nil {
+		t.Error("signed a missing target")
+	}
+	if err := p.SetSigning("App", "Profile", s); err == nil {
+		t.Error("signed a missing configuration")
+	}
+	if string(p.Bytes()) != before {
+		t.Error("failed SetSigning changed the project")
+	}
+}
+
+func TestSetSigningLargeProject(t *testing.T) {
+	// a project of about 1 MB with many configurations is edited without parsing it again per edit
+	var objects bytes.Buffer
+	for i := 0; i < 8000; i++ {
+		fmt.Fprintf(&objects, "\t\tF%07d /* file.swift */ = {isa = PBXFileReference; lastKnownFileType = sourcecode.swift; path = \"file %d.swift\"; sourceTree = \"<group>\"; };\n", i, i)
+	}
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&objects, "\t\tC%07d /* Debug */ = {\n\t\t\tisa = XCBuildConfiguration;\n\t\t\tbuildSettings = {\n\t\t\t\tSWIFT_VERSION = 5.0;\n\t\t\t};\n\t\t\tname = Debug;\n\t\t};\n", i)
+	}
+	content := strings.Replace(testPBXProject, "/* Begin XCBuildConfiguration section */\n", "/* Begin XCBuildConfiguration section */\n"+objects.String(), 1)
+	p := parseTestProject(t, content)
+
+	start := time.Now()
+	s := SigningSettings{BundleIdentifier: "com.widuu.app", TeamID: "TEAMID1234", CodeSignStyle: "Manual", ProfileSpecifier: "App Development"}
+	if err := p.SetSigning("App", "", s); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200; i++ {
+		if err := p.SetBuildSetting(fmt.Sprintf("C%07d", i), BuildSettingDevelopmentTeam, "TEAMID1234"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("editing a %d byte project took %v", len(content), elapsed)
+	}
+	reparsed := checkRoundTrip(t, p)
+	if got := buildSettingsOf(reparsed, "C0000199")[BuildSettingDevelopmentTeam]; got != "TEAMID1234" {
+		t.Errorf("last configuration team = %v", got)
+	}
+}
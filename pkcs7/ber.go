@@ -0,0 +1,130 @@
+package pkcs7
+
+import (
+	"errors"
+)
+
+// maxBERDepth limits the nesting of constructed values in ber2der
+const maxBERDepth = 64
+
+var errBERTruncated = errors.New("pkcs7: ber data truncated")
+
+// ber2der converts BER encoded data, which may use indefinite lengths, to the
+// DER length encoding expected by encoding/asn1. Only lengths are rewritten;
+// constructed strings keep their segments.
+func ber2der(ber []byte) ([]byte, error) {
+	der, _, err := readObject(ber, 0)
+	return der, err
+}
+
+// readObject converts the first object of b and returns it with the remaining bytes.
+func readObject(b []byte, depth int) (der, rest []byte, err error) {
+	if depth > maxBERDepth {
+		return nil, nil, errors.New("pkcs7: ber data nested too deeply")
+	}
+	if len(b) < 2 {
+		return nil, nil, errBERTruncated
+	}
+
+	// identifier octets, high tag numbers continue while bit 8 is set
+	i := 1
+	constructed := b[0]&0x20 != 0
+	if b[0]&0x1f == 0x1f {
+		for {
+			if i >= len(b) {
+				return nil, nil, errBERTruncated
+			}
+			i++
+			if b[i-1]&0x80 == 0 {
+				break
+			}
+		}
+	}
+	tag := b[:i]
+	if i >= len(b) {
+		return nil, nil, errBERTruncated
+	}
+
+	// length octets
+	l := b[i]
+	i++
+	var content []byte
+	if l == 0x80 {
+		// indefinite length, content ends with the end-of-contents octets
+		if !constructed {
+			return nil, nil, errors.New("pkcs7: indefinite length on primitive ber value")
+		}
+		rest = b[i:]
+		for {
+			if len(rest) < 2 {
+				return nil, nil, errBERTruncated
+			}
+			if rest[0] == 0 && rest[1] == 0 {
+				rest = rest[2:]
+				break
+			}
+			var child []byte
+			child, rest, err = readObject(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			content = append(content, child...)
+		}
+	} else {
+		length := int(l)
+		if l&0x80 != 0 {
+			n := int(l & 0x7f)
+			if n > 4 {
+				return nil, nil, errors.New("pkcs7: ber length too large")
+			}
+			if i+n > len(b) {
+				return nil, nil, errBERTruncated
+			}
+			length = 0
+			for k := 0; k < n; k++ {
+				length = length<<8 | int(b[i+k])
+			}
+			i += n
+		}
+		if length < 0 || length > len(b)-i {
+			return nil, nil, errBERTruncated
+		}
+		content = b[i : i+length]
+		rest = b[i+length:]
+		if constructed {
+			children := content
+			content = nil
+			for len(children) > 0 {
+				var child []byte
+				child, children, err = readObject(children, depth+1)
+				if err != nil {
+					return nil, nil, err
+				}
+				content = append(content, child...)
+			}
+		}
+	}
+
+	der = make([]byte, 0, len(tag)+6+len(content))
+	der = append(der, tag...)
+	der = appendLength(der, len(content))
+	der = append(der, content...)
+	return der, rest, nil
+}
+
+// appendLength appends the DER encoded length
+func appendLength(b []byte, length int) []byte {
+	if length < 0x80 {
+		return append(b, byte(length))
+	}
+	var buf [4]byte
+	n := 0
+	for l := length; l > 0; l >>= 8 {
+		n++
+	}
+	for k := 0; k < n; k++ {
+		buf[k] = byte(length >> uint(8*(n-1-k)))
+	}
+	b = append(b, 0x80|byte(n))
+	return append(b, buf[:n]...)
+}
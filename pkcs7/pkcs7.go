@@ -0,0 +1,139 @@
+// Package pkcs7 implements parsing of PKCS#7 / CMS SignedData.
+//
+// This implementation is distilled from https://tools.ietf.org/html/rfc5652
+// and covers what is needed to read Apple provisioning profiles.
+package pkcs7
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+var (
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+// contentInfo Content keeps the [0] wrapper, the value is in Content.Bytes
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// encapsulatedContentInfo Content keeps the [0] wrapper, the OCTET STRING is in Content.Bytes
+type encapsulatedContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// rawContent keeps the raw bytes of an implicitly tagged SET
+type rawContent struct {
+	Raw asn1.RawContent
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      encapsulatedContentInfo
+	Certificates     rawContent   `asn1:"optional,tag:0"`
+	CRLs             rawContent   `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttributes   rawContent `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttributes rawContent `asn1:"optional,tag:1"`
+}
+
+// SignedData is a parsed CMS SignedData.
+type SignedData struct {
+	// ContentType is the type of the encapsulated content, normally id-data.
+	ContentType asn1.ObjectIdentifier
+	// Content is the encapsulated content, nil for detached signatures.
+	Content []byte
+	// Certificates are the certificates carried in the SignedData.
+	Certificates []*x509.Certificate
+
+	signers []signerInfo
+}
+
+// Parse parses a BER or DER encoded ContentInfo holding a SignedData.
+func Parse(data []byte) (*SignedData, error) {
+	if len(data) == 0 {
+		return nil, errors.New("pkcs7: input data is empty")
+	}
+	der, err := ber2der(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var info contentInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("pkcs7: error parsing content info: %v", err)
+	}
+	if !info.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("pkcs7: content type %v is not signed data", info.ContentType)
+	}
+
+	var sd signedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("pkcs7: error parsing signed data: %v", err)
+	}
+
+	p := &SignedData{ContentType: sd.ContentInfo.ContentType, signers: sd.SignerInfos}
+	if len(sd.ContentInfo.Content.Bytes) > 0 {
+		var content asn1.RawValue
+		if _, err := asn1.Unmarshal(sd.ContentInfo.Content.Bytes, &content); err != nil {
+			return nil, fmt.Errorf("pkcs7: error parsing content: %v", err)
+		}
+		p.Content, err = octetString(content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(sd.Certificates.Raw) > 0 {
+		var certs asn1.RawValue
+		if _, err := asn1.Unmarshal(sd.Certificates.Raw, &certs); err != nil {
+			return nil, fmt.Errorf("pkcs7: error parsing certificates: %v", err)
+		}
+		p.Certificates, err = x509.ParseCertificates(certs.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("pkcs7: error parsing certificates: %v", err)
+		}
+	}
+	return p, nil
+}
+
+// octetString returns the bytes of a primitive or constructed OCTET STRING.
+func octetString(v asn1.RawValue) ([]byte, error) {
+	if v.Class != asn1.ClassUniversal || v.Tag != asn1.TagOctetString {
+		// content of a non-data type is stored as is
+		return v.Bytes, nil
+	}
+	if !v.IsCompound {
+		return v.Bytes, nil
+	}
+	var out []byte
+	rest := v.Bytes
+	for len(rest) > 0 {
+		var segment asn1.RawValue
+		var err error
+		rest, err = asn1.Unmarshal(rest, &segment)
+		if err != nil {
+			return nil, fmt.Errorf("pkcs7: error parsing content: %v", err)
+		}
+		data, err := octetString(segment)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, data...)
+	}
+	return out, nil
+}
@@ -0,0 +1,275 @@
+package pkcs7
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+)
+
+var (
+	oidTestData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidTestSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidTestRSA           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidTestContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidTestMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+)
+
+type testAttribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type testIssuerAndSerial struct {
+	IssuerName   asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type testSignerInfo struct {
+	Version            int
+	SID                testIssuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttributes   []testAttribute `asn1:"optional,omitempty,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type testEncapsulatedContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type testSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      testEncapsulatedContentInfo
+	Certificates     asn1.RawValue    `asn1:"optional,tag:0"`
+	SignerInfos      []testSignerInfo `asn1:"set"`
+}
+
+type testContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type testIdentity struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+// newTestIdentity creates a CA certificate signed by parent, or self signed when parent is nil.
+func newTestIdentity(t *testing.T, name string, parent *testIdentity) *testIdentity {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	issuer, signer := template, key
+	if parent != nil {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIdentity{cert, key}
+}
+
+// sign builds a SignedData over content with signed attributes.
+func sign(t *testing.T, content []byte, signer *testIdentity, certs ...*x509.Certificate) []byte {
+	digest := sha256.Sum256(content)
+	contentType, _ := asn1.Marshal(oidTestData)
+	messageDigest, _ := asn1.Marshal(digest[:])
+	attrs := []testAttribute{
+		{Type: oidTestContentType, Value: asn1.RawValue{Tag: asn1.TagSet, Class: asn1.ClassUniversal, IsCompound: true, Bytes: contentType}},
+		{Type: oidTestMessageDigest, Value: asn1.RawValue{Tag: asn1.TagSet, Class: asn1.ClassUniversal, IsCompound: true, Bytes: messageDigest}},
+	}
+	signedAttrs, err := asn1.MarshalWithParams(attrs, "set")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrsDigest := sha256.Sum256(signedAttrs)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, signer.key, crypto.SHA256, attrsDigest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rawCerts []byte
+	for _, c := range certs {
+		rawCerts = append(rawCerts, c.Raw...)
+	}
+	sd := testSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidTestSHA256}},
+		ContentInfo:      testEncapsulatedContentInfo{ContentType: oidTestData, Content: content},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: rawCerts},
+		SignerInfos: []testSignerInfo{{
+			Version:            1,
+			SID:                testIssuerAndSerial{asn1.RawValue{FullBytes: signer.cert.RawIssuer}, signer.cert.SerialNumber},
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidTestSHA256},
+			SignedAttributes:   attrs,
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidTestRSA},
+			Signature:          signature,
+		}},
+	}
+	inner, err := asn1.Marshal(sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(testContentInfo{ContentType: oidSignedData, Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestParse(t *testing.T) {
+	ca := newTestIdentity(t, "Test Root CA", nil)
+	leaf := newTestIdentity(t, "Test Signer", ca)
+	content := []byte("<plist><dict/></plist>")
+
+	p, err := Parse(sign(t, content, leaf, leaf.cert, ca.cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p.Content, content) {
+		t.Errorf("content = %q, want %q", p.Content, content)
+	}
+	if len(p.Certificates) != 2 || !p.Certificates[0].Equal(leaf.cert) || !p.Certificates[1].Equal(ca.cert) {
+		t.Errorf("unexpected certificates %v", p.Certificates)
+	}
+	if len(p.signers) != 1 {
+		t.Errorf("signers = %d, want 1", len(p.signers))
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, data := range [][]byte{nil, {0x30}, {0x30, 0x80, 0x02, 0x01}, []byte("not a signed data")} {
+		if _, err := Parse(data); err == nil {
+			t.Errorf("Parse(%x) succeeded, want error", data)
+		}
+	}
+}
+
+func TestBER2DER(t *testing.T) {
+	tests := []struct {
+		ber, der []byte
+	}{
+		// definite length is kept
+		{[]byte{0x04, 0x02, 0x61, 0x62}, []byte{0x04, 0x02, 0x61, 0x62}},
+		// indefinite length sequence
+		{[]byte{0x30, 0x80, 0x04, 0x01, 0x61, 0x00, 0x00}, []byte{0x30, 0x03, 0x04, 0x01, 0x61}},
+		// nested indefinite length
+		{[]byte{0x30, 0x80, 0x30, 0x80, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00}, []byte{0x30, 0x04, 0x30, 0x02, 0x05, 0x00}},
+		// long form length
+		{[]byte{0x04, 0x81, 0x01, 0x61}, []byte{0x04, 0x01, 0x61}},
+	}
+	for _, tt := range tests {
+		der, err := ber2der(tt.ber)
+		if err != nil {
+			t.Errorf("ber2der(%x): %v", tt.ber, err)
+			continue
+		}
+		if !bytes.Equal(der, tt.der) {
+			t.Errorf("ber2der(%x) = %x, want %x", tt.ber, der, tt.der)
+		}
+	}
+}
+
+func TestConstructedOctetString(t *testing.T) {
+	der, err := ber2der([]byte{0x24, 0x80, 0x04, 0x01, 0x61, 0x04, 0x02, 0x62, 0x63, 0x00, 0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &v); err != nil {
+		t.Fatal(err)
+	}
+	data, err := octetString(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "abc" {
+		t.Errorf("octetString = %q, want %q", data, "abc")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ca := newTestIdentity(t, "Test Root CA", nil)
+	intermediate := newTestIdentity(t, "Test Intermediate CA", ca)
+	leaf := newTestIdentity(t, "Test Signer", intermediate)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	p, err := Parse(sign(t, []byte("signed content"), leaf, leaf.cert, intermediate.cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chains, err := p.Verify(x509.VerifyOptions{Roots: roots})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chains) != 1 || len(chains[0]) != 3 || !chains[0][2].Equal(ca.cert) {
+		t.Errorf("unexpected chains %v", chains)
+	}
+}
+
+func TestVerifyUntrustedRoot(t *testing.T) {
+	ca := newTestIdentity(t, "Test Root CA", nil)
+	other := newTestIdentity(t, "Other Root CA", nil)
+	leaf := newTestIdentity(t, "Test Signer", ca)
+	roots := x509.NewCertPool()
+	roots.AddCert(other.cert)
+
+	p, err := Parse(sign(t, []byte("signed content"), leaf, leaf.cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Verify(x509.VerifyOptions{Roots: roots}); err == nil {
+		t.Error("Verify succeeded with an untrusted root")
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	ca := newTestIdentity(t, "Test Root CA", nil)
+	leaf := newTestIdentity(t, "Test Signer", ca)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	der := sign(t, []byte("signed content"), leaf, leaf.cert)
+	idx := bytes.Index(der, []byte("signed content"))
+	der[idx] = 'S'
+	p, err := Parse(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Verify(x509.VerifyOptions{Roots: roots}); err == nil {
+		t.Error("Verify succeeded with tampered content")
+	}
+
+	// replace the content and its digest, the signature no longer matches
+	p.Content = []byte("other content")
+	p.signers[0].Signature[0] ^= 0xff
+	if _, err := p.Verify(x509.VerifyOptions{Roots: roots}); err == nil {
+		t.Error("Verify succeeded with tampered signature")
+	}
+}
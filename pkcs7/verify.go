@@ -0,0 +1,200 @@
+package pkcs7
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+
+	// register hash functions used by CMS digest algorithms
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+var (
+	oidAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidDigestSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidDigestSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidDigestSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidDigestSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+type attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type issuerAndSerial struct {
+	IssuerName   asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// Verify checks the signature of every signer over the content and that each
+// signer certificate chains to opts.Roots. The certificates carried in the
+// SignedData are added to opts.Intermediates. It returns the verified chains.
+//
+// When opts.KeyUsages is empty any extended key usage is accepted, so any
+// certificate issued under opts.Roots can sign. Callers that trust a single
+// signer must check the returned chains.
+func (p *SignedData) Verify(opts x509.VerifyOptions) ([][]*x509.Certificate, error) {
+	if len(p.signers) == 0 {
+		return nil, errors.New("pkcs7: no signers")
+	}
+	if p.Content == nil {
+		return nil, errors.New("pkcs7: detached signatures are not supported")
+	}
+
+	if opts.Intermediates == nil {
+		opts.Intermediates = x509.NewCertPool()
+	}
+	for _, cert := range p.Certificates {
+		opts.Intermediates.AddCert(cert)
+	}
+	if len(opts.KeyUsages) == 0 {
+		opts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+
+	var chains [][]*x509.Certificate
+	for _, signer := range p.signers {
+		cert, err := p.signerCertificate(signer)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.verifySignature(signer, cert); err != nil {
+			return nil, err
+		}
+		verified, err := cert.Verify(opts)
+		if err != nil {
+			return nil, fmt.Errorf("pkcs7: signer certificate %q: %v", cert.Subject.CommonName, err)
+		}
+		chains = append(chains, verified[0])
+	}
+	return chains, nil
+}
+
+// signerCertificate finds the certificate identified by the signer sid.
+func (p *SignedData) signerCertificate(signer signerInfo) (*x509.Certificate, error) {
+	switch {
+	case signer.SID.Class == asn1.ClassUniversal && signer.SID.Tag == asn1.TagSequence:
+		var ias issuerAndSerial
+		if _, err := asn1.Unmarshal(signer.SID.FullBytes, &ias); err != nil {
+			return nil, fmt.Errorf("pkcs7: error parsing signer identifier: %v", err)
+		}
+		for _, cert := range p.Certificates {
+			if cert.SerialNumber.Cmp(ias.SerialNumber) == 0 && bytes.Equal(cert.RawIssuer, ias.IssuerName.FullBytes) {
+				return cert, nil
+			}
+		}
+	case signer.SID.Class == asn1.ClassContextSpecific && signer.SID.Tag == 0:
+		for _, cert := range p.Certificates {
+			if bytes.Equal(cert.SubjectKeyId, signer.SID.Bytes) {
+				return cert, nil
+			}
+		}
+	default:
+		return nil, errors.New("pkcs7: unsupported signer identifier")
+	}
+	return nil, errors.New("pkcs7: signer certificate not found")
+}
+
+// verifySignature checks the signed attributes against the content and the
+// signature against the signer certificate.
+func (p *SignedData) verifySignature(signer signerInfo, cert *x509.Certificate) error {
+	hash, err := digestHash(signer.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	sigAlg, err := signatureAlgorithm(cert.PublicKeyAlgorithm, hash)
+	if err != nil {
+		return err
+	}
+
+	signed := p.Content
+	if len(signer.SignedAttributes.Raw) > 0 {
+		// the signature covers the DER SET OF, not the [0] IMPLICIT tag
+		signed = append([]byte{0x31}, signer.SignedAttributes.Raw[1:]...)
+
+		var attrs []attribute
+		if _, err := asn1.UnmarshalWithParams(signed, &attrs, "set"); err != nil {
+			return fmt.Errorf("pkcs7: error parsing signed attributes: %v", err)
+		}
+		var contentType asn1.ObjectIdentifier
+		var digest []byte
+		for _, attr := range attrs {
+			switch {
+			case attr.Type.Equal(oidAttributeContentType):
+				if _, err := asn1.Unmarshal(attr.Value.Bytes, &contentType); err != nil {
+					return fmt.Errorf("pkcs7: error parsing content type attribute: %v", err)
+				}
+			case attr.Type.Equal(oidAttributeMessageDigest):
+				if _, err := asn1.Unmarshal(attr.Value.Bytes, &digest); err != nil {
+					return fmt.Errorf("pkcs7: error parsing message digest attribute: %v", err)
+				}
+			}
+		}
+		if digest == nil {
+			return errors.New("pkcs7: missing message digest attribute")
+		}
+		if contentType != nil && !contentType.Equal(p.ContentType) {
+			return errors.New("pkcs7: content type attribute does not match the content")
+		}
+		h := hash.New()
+		h.Write(p.Content)
+		if !bytes.Equal(h.Sum(nil), digest) {
+			return errors.New("pkcs7: message digest does not match the content")
+		}
+	}
+
+	if err := cert.CheckSignature(sigAlg, signed, signer.Signature); err != nil {
+		return fmt.Errorf("pkcs7: invalid signature: %v", err)
+	}
+	return nil
+}
+
+func digestHash(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidDigestSHA1):
+		return crypto.SHA1, nil
+	case oid.Equal(oidDigestSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidDigestSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidDigestSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("pkcs7: unsupported digest algorithm %v", oid)
+}
+
+func signatureAlgorithm(pub x509.PublicKeyAlgorithm, hash crypto.Hash) (x509.SignatureAlgorithm, error) {
+	switch pub {
+	case x509.RSA:
+		switch hash {
+		case crypto.SHA1:
+			return x509.SHA1WithRSA, nil
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case x509.ECDSA:
+		switch hash {
+		case crypto.SHA1:
+			return x509.ECDSAWithSHA1, nil
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("pkcs7: unsupported signature algorithm %v with %v", pub, hash)
+}
@@ -0,0 +1,227 @@
+package plist
+
+import (
+	"fmt"
+	"time"
+)
+
+// keyedArchiver is the $archiver of NSKeyedArchiver archives
+const keyedArchiver = "NSKeyedArchiver"
+
+// UnarchiveError reports an NSKeyedArchiver archive that cannot be resolved.
+type UnarchiveError struct {
+	Msg string
+}
+
+func (e *UnarchiveError) Error() string {
+	return "plist: unarchive: " + e.Msg
+}
+
+// Unarchive decodes an NSKeyedArchiver archive in any plist format and
+// resolves the $objects references of its root object into a plain value
+// tree. NSArray and NSSet become []interface{}, NSDictionary becomes
+// map[string]interface{}, NSString becomes string, NSDate becomes time.Time
+// and NSData becomes []byte, including their mutable variants. Numbers and
+// booleans are decoded like Unmarshal into an empty interface does.
+//
+// Objects of other classes become a map[string]interface{} of their resolved
+// fields, with the class name in the "$classname" key. When $top has no
+// "root" key, all top level objects are returned in a map.
+func Unarchive(data []byte) (interface{}, error) {
+	var archive struct {
+		Archiver string                 `plist:"$archiver"`
+		Objects  []interface{}          `plist:"$objects"`
+		Top      map[string]interface{} `plist:"$top"`
+	}
+	if err := Unmarshal(data, &archive); err != nil {
+		return nil, err
+	}
+	if archive.Archiver != keyedArchiver {
+		return nil, &UnarchiveError{fmt.Sprintf("unknown archiver %q", archive.Archiver)}
+	}
+	u := &unarchiver{
+		objects:   archive.Objects,
+		resolved:  make(map[UID]interface{}),
+		resolving: make(map[UID]bool),
+	}
+	if root, ok := archive.Top["root"]; ok {
+		return u.resolve(root)
+	}
+	top := make(map[string]interface{}, len(archive.Top))
+	for k, v := range archive.Top {
+		val, err := u.resolve(v)
+		if err != nil {
+			return nil, err
+		}
+		top[k] = val
+	}
+	return top, nil
+}
+
+type unarchiver struct {
+	objects   []interface{}
+	resolved  map[UID]interface{}
+	resolving map[UID]bool // objects being resolved, to detect cycles
+}
+
+// resolve returns v, or the object it references when v is a UID
+func (u *unarchiver) resolve(v interface{}) (interface{}, error) {
+	uid, ok := v.(UID)
+	if !ok {
+		return v, nil
+	}
+	if val, ok := u.resolved[uid]; ok {
+		return val, nil
+	}
+	if uid >= UID(len(u.objects)) {
+		return nil, &UnarchiveError{fmt.Sprintf("object %d out of range", uid)}
+	}
+	if u.resolving[uid] {
+		return nil, &UnarchiveError{fmt.Sprintf("object %d references itself", uid)}
+	}
+	u.resolving[uid] = true
+	val, err := u.decodeObject(u.objects[uid])
+	delete(u.resolving, uid)
+	if err != nil {
+		return nil, err
+	}
+	u.resolved[uid] = val
+	return val, nil
+}
+
+func (u *unarchiver) decodeObject(obj interface{}) (interface{}, error) {
+	if s, ok := obj.(string); ok && s == "$null" {
+		return nil, nil
+	}
+	fields, ok := obj.(map[string]interface{})
+	if !ok {
+		return obj, nil
+	}
+	classUID, ok := fields["$class"].(UID)
+	if !ok {
+		return nil, &UnarchiveError{"object without $class"}
+	}
+	classes, err := u.classes(classUID)
+	if err != nil {
+		return nil, err
+	}
+	for _, class := range classes {
+		switch class {
+		case "NSArray", "NSMutableArray", "NSSet", "NSMutableSet", "NSOrderedSet", "NSMutableOrderedSet":
+			return u.resolveList(fields["NS.objects"])
+		case "NSDictionary", "NSMutableDictionary":
+			return u.decodeDictionary(fields)
+		case "NSString", "NSMutableString":
+			return u.decodeString(fields)
+		case "NSDate":
+			secs, ok := fields["NS.time"].(float64)
+			if !ok {
+				return nil, &UnarchiveError{"NSDate without NS.time"}
+			}
+			return time.Unix(appleEpoch, 0).Add(time.Duration(secs * float64(time.Second))).In(time.UTC), nil
+		case "NSData", "NSMutableData":
+			val, err := u.resolve(fields["NS.data"])
+			if err != nil {
+				return nil, err
+			}
+			data, ok := val.([]byte)
+			if !ok {
+				return nil, &UnarchiveError{"NSData without NS.data"}
+			}
+			return data, nil
+		}
+	}
+
+	out := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if k == "$class" {
+			continue
+		}
+		val, err := u.resolve(v)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = val
+	}
+	out["$classname"] = classes[0]
+	return out, nil
+}
+
+// classes returns the class name followed by its superclasses
+func (u *unarchiver) classes(uid UID) ([]string, error) {
+	if uid >= UID(len(u.objects)) {
+		return nil, &UnarchiveError{fmt.Sprintf("class %d out of range", uid)}
+	}
+	class, ok := u.objects[uid].(map[string]interface{})
+	if !ok {
+		return nil, &UnarchiveError{fmt.Sprintf("object %d is not a class", uid)}
+	}
+	name, ok := class["$classname"].(string)
+	if !ok {
+		return nil, &UnarchiveError{fmt.Sprintf("class %d without $classname", uid)}
+	}
+	classes := []string{name}
+	list, _ := class["$classes"].([]interface{})
+	for _, c := range list {
+		if s, ok := c.(string); ok && s != name {
+			classes = append(classes, s)
+		}
+	}
+	return classes, nil
+}
+
+func (u *unarchiver) resolveList(v interface{}) ([]interface{}, error) {
+	refs, ok := v.([]interface{})
+	if !ok {
+		return nil, &UnarchiveError{"collection without NS.objects"}
+	}
+	out := make([]interface{}, len(refs))
+	for i, ref := range refs {
+		val, err := u.resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = val
+	}
+	return out, nil
+}
+
+func (u *unarchiver) decodeDictionary(fields map[string]interface{}) (interface{}, error) {
+	keys, err := u.resolveList(fields["NS.keys"])
+	if err != nil {
+		return nil, err
+	}
+	values, err := u.resolveList(fields["NS.objects"])
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) != len(values) {
+		return nil, &UnarchiveError{"NSDictionary with different numbers of keys and objects"}
+	}
+	out := make(map[string]interface{}, len(keys))
+	for i, k := range keys {
+		key, ok := k.(string)
+		if !ok {
+			return nil, &UnarchiveError{fmt.Sprintf("NSDictionary key %v is not a string", k)}
+		}
+		out[key] = values[i]
+	}
+	return out, nil
+}
+
+func (u *unarchiver) decodeString(fields map[string]interface{}) (interface{}, error) {
+	val, err := u.resolve(fields["NS.string"])
+	if err != nil {
+		return nil, err
+	}
+	switch s := val.(type) {
+	case string:
+		return s, nil
+	case []byte:
+		return string(s), nil
+	}
+	if b, ok := fields["NS.bytes"].([]byte); ok {
+		return string(b), nil
+	}
+	return nil, &UnarchiveError{"NSString without NS.string"}
+}
@@ -0,0 +1,118 @@
+package plist
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func keyedArchive() map[string]interface{} {
+	class := func(names ...string) map[string]interface{} {
+		return map[string]interface{}{"$classname": names[0], "$classes": names}
+	}
+	return map[string]interface{}{
+		"$archiver": "NSKeyedArchiver",
+		"$version":  100000,
+		"$top":      map[string]interface{}{"root": UID(1)},
+		"$objects": []interface{}{
+			"$null",
+			map[string]interface{}{
+				"$class":     UID(7),
+				"NS.keys":    []interface{}{UID(2), UID(3), UID(4), UID(13)},
+				"NS.objects": []interface{}{UID(5), UID(6), UID(8), UID(14)},
+			},
+			"name",
+			"items",
+			"when",
+			"App",
+			map[string]interface{}{"$class": UID(9), "NS.objects": []interface{}{UID(2), UID(10), UID(0)}},
+			class("NSMutableDictionary", "NSDictionary", "NSObject"),
+			map[string]interface{}{"$class": UID(11), "NS.time": 10.5},
+			class("NSArray", "NSObject"),
+			map[string]interface{}{"$class": UID(12), "NS.data": []byte{1, 2}},
+			class("NSDate", "NSObject"),
+			class("NSMutableData", "NSData", "NSObject"),
+			"custom",
+			map[string]interface{}{"$class": UID(15), "count": 3, "title": UID(5)},
+			class("AppState", "NSObject"),
+		},
+	}
+}
+
+func TestUnarchive(t *testing.T) {
+	want := map[string]interface{}{
+		"name":  "App",
+		"items": []interface{}{"name", []byte{1, 2}, nil},
+		"when":  time.Date(2001, 1, 1, 0, 0, 10, 5e8, time.UTC),
+		"custom": map[string]interface{}{
+			"$classname": "AppState",
+			"count":      uint64(3),
+			"title":      "App",
+		},
+	}
+	for _, format := range []Format{BinaryFormat, XMLFormat} {
+		data, err := MarshalFormat(keyedArchive(), format)
+		if err != nil {
+			t.Fatalf("%v: %v", format, err)
+		}
+		got, err := Unarchive(data)
+		if err != nil {
+			t.Fatalf("%v: %v", format, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: got %#v\nwant %#v", format, got, want)
+		}
+	}
+}
+
+func TestUIDRoundTrip(t *testing.T) {
+	v := map[string]interface{}{"small": UID(3), "large": UID(70000)}
+	for _, format := range []Format{BinaryFormat, XMLFormat} {
+		data, err := MarshalFormat(v, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format == XMLFormat && !strings.Contains(string(data), "<key>CF$UID</key>") {
+			t.Errorf("xml uid not written as a CF$UID dictionary:\n%s", data)
+		}
+		var got map[string]interface{}
+		if err := Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Errorf("%v: got %#v", format, got)
+		}
+		var typed struct {
+			Small UID    `plist:"small"`
+			Large uint32 `plist:"large"`
+		}
+		if err := Unmarshal(data, &typed); err != nil {
+			t.Fatal(err)
+		}
+		if typed.Small != 3 || typed.Large != 70000 {
+			t.Errorf("%v: got %+v", format, typed)
+		}
+	}
+}
+
+func TestUnarchiveErrors(t *testing.T) {
+	archive := keyedArchive()
+	archive["$top"] = map[string]interface{}{"root": UID(99)}
+	data, _ := MarshalFormat(archive, BinaryFormat)
+	if _, err := Unarchive(data); err == nil {
+		t.Error("expected an error for an out of range root")
+	}
+
+	archive = keyedArchive()
+	archive["$objects"].([]interface{})[6] = map[string]interface{}{"$class": UID(9), "NS.objects": []interface{}{UID(6)}}
+	data, _ = MarshalFormat(archive, BinaryFormat)
+	if _, err := Unarchive(data); err == nil {
+		t.Error("expected an error for a cycle")
+	}
+
+	data, _ = MarshalFormat(map[string]interface{}{"$archiver": "Other"}, BinaryFormat)
+	if _, err := Unarchive(data); err == nil {
+		t.Error("expected an error for an unknown archiver")
+	}
+}
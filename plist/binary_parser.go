@@ -26,45 +26,56 @@ type binaryParser struct {
 	OffsetTable   []uint64 // array of offsets for each object in plist
 	plistTrailer           // last 32 bytes of plist
 	io.ReadSeeker          // reader for plist data
-}
 
-const numObjectsMax = 4 << 20
+	limits   *limiter
+	visiting map[uint64]bool // objects being parsed, to detect cycles
+	size     uint64          // bytes of input before the trailer
+}
 
 // newBinaryParser takes in a ReadSeeker for the bytes of a binary plist and
 // returns a parser after reading the offset table and trailer.
-func newBinaryParser(r io.ReadSeeker) (*binaryParser, error) {
+func newBinaryParser(r io.ReadSeeker, limits *limiter) (*binaryParser, error) {
 	var bp binaryParser
 	bp.ReadSeeker = r
+	bp.limits = limits
+	bp.visiting = make(map[uint64]bool)
 
 	// Read the trailer.
-	if _, err := bp.Seek(-32, io.SeekEnd); err != nil {
+	trailer, err := bp.Seek(-32, io.SeekEnd)
+	if err != nil {
 		return nil, fmt.Errorf("plist: couldn't seek to start of trailer: %v", err)
 	}
 	if err := binary.Read(bp, binary.BigEndian, &bp.plistTrailer); err != nil {
 		return nil, fmt.Errorf("plist: couldn't read trailer: %v", err)
 	}
+	bp.size = uint64(trailer)
+
+	// The offset table lies between the objects and the trailer, so its size
+	// bounds the number of objects whatever the limits are.
+	if bp.OffsetIntSize < 1 || bp.OffsetIntSize > 8 {
+		return nil, fmt.Errorf("plist: invalid offset int size %d", bp.OffsetIntSize)
+	}
+	if bp.ObjectRefSize < 1 || bp.ObjectRefSize > 8 {
+		return nil, fmt.Errorf("plist: invalid object ref size %d", bp.ObjectRefSize)
+	}
+	if bp.OffsetTableOffset > bp.size || bp.NumObjects > (bp.size-bp.OffsetTableOffset)/uint64(bp.OffsetIntSize) {
+		return nil, fmt.Errorf("plist: offset table of %d objects at %d does not fit in %d bytes", bp.NumObjects, bp.OffsetTableOffset, bp.size)
+	}
+	if err := limits.count(bp.NumObjects); err != nil {
+		return nil, err
+	}
 
 	// Read the offset table.
 	if _, err := bp.Seek(int64(bp.OffsetTableOffset), io.SeekStart); err != nil {
 		return nil, fmt.Errorf("plist: couldn't seek to start of offset table: %v", err)
 	}
-
-	// numObjectsMax is arbitrary. Please fix.
-	// TODO(github.com/groob/plist/issues/28)
-	if bp.NumObjects > numObjectsMax {
-		return nil, fmt.Errorf("plist: offset size larger than expected %d", numObjectsMax)
-	}
-
 	bp.OffsetTable = make([]uint64, bp.NumObjects)
-	if bp.OffsetIntSize > 8 {
-		return nil, fmt.Errorf("plist: can't decode when offset int size (%d) is greater than 8", bp.OffsetIntSize)
-	}
+	buf := make([]byte, 8)
 	for i := uint64(0); i < bp.NumObjects; i++ {
-		buf := make([]byte, 8)
-		if _, err := bp.Read(buf[8-bp.OffsetIntSize:]); err != nil {
+		if _, err := io.ReadFull(bp, buf[8-bp.OffsetIntSize:]); err != nil {
 			return nil, fmt.Errorf("plist: couldn't read offset table: %v", err)
 		}
-		bp.OffsetTable[i] = uint64(binary.BigEndian.Uint64(buf))
+		bp.OffsetTable[i] = binary.BigEndian.Uint64(buf)
 	}
 
 	return &bp, nil
@@ -95,9 +106,17 @@ func (bp *binaryParser) parseObjectRef(index uint64) (val *plistValue, err error
 		}
 	}()
 
-	if index > uint64(len(bp.OffsetTable)) {
+	if index >= uint64(len(bp.OffsetTable)) {
 		return nil, fmt.Errorf("plist: offset too large: %d", index)
 	}
+	if err := bp.limits.object(); err != nil {
+		return nil, err
+	}
+	if bp.visiting[index] {
+		return nil, fmt.Errorf("plist: object %d contains itself", index)
+	}
+	bp.visiting[index] = true
+	defer delete(bp.visiting, index)
 	// Move to the start of the object we want to decode.
 	if _, err := bp.Seek(int64(bp.OffsetTable[index]), io.SeekStart); err != nil {
 		return nil, err
@@ -127,8 +146,8 @@ func (bp *binaryParser) parseObjectRef(index uint64) (val *plistValue, err error
 		return bp.parseASCII(marker)
 	case 0x6: // unicode (utf-16) string
 		return bp.parseUTF16(marker)
-	case 0x8: // uid (not supported)
-		return &plistValue{Invalid, nil}, nil
+	case 0x8: // uid
+		return bp.parseUID(marker)
 	case 0xa: // array
 		return bp.parseArray(marker)
 	case 0xc: // set (not supported)
@@ -213,20 +232,10 @@ func (bp *binaryParser) parseInteger(marker byte) (*plistValue, error) {
 	// </dict>
 	// </plist>
 	//
-	// We have two choices here: restrict unsigned values to 63-bits, or just
-	// let the package user interpret the serialized value.  This implementation
-	// lets the user decide: if they want to unmarshal into a uint64 value,
-	// we give them the full 8-bytes as such.  If they unmarshal into a signed
-	// int64 value, we again give them the full 8-bytes as such, which will be
-	// interpreted as negative if the top bit is set.  This is achieved by
-	// setting the signed field of the signedInt value below to false
-	// unconditionally. That way, the Decoder.unmarshalInteger method will do
-	// the right thing.
-	//
-	// For XML property list unmarshaling, the presence of the "negative sign"
-	// on an integer value makes the above unambigious, and the current practice
-	// of using signedInt.signed = true in that case remains valid; see the
-	// xmlParser.parseInteger implementation.
+	// So an 8-byte integer is a signed int64, as CF and Xcode read it, and
+	// only a 16-byte integer holds an unsigned value above math.MaxInt64.
+	// Decoding the latter into a signed Go integer is an IntegerOverflowError,
+	// as for an XML integer, instead of silently turning it negative.
 	//
 	// See: https://bugs.python.org/issue14455
 	nbytes := 1 << (marker & 0xf)
@@ -239,10 +248,8 @@ func (bp *binaryParser) parseInteger(marker byte) (*plistValue, error) {
 	if err != nil {
 		return nil, err
 	}
-	// Truncate values to 64 bits (8 bytes), and treat them all as "unsigned",
-	// so they can be unmarshaled to unsigned and signed integers alike as
-	// discussed above.
-	result := signedInt{binary.BigEndian.Uint64(buf[8:]), false}
+	// Truncate values to 64 bits (8 bytes), only an 8-byte value with the top bit set is negative.
+	result := signedInt{binary.BigEndian.Uint64(buf[8:]), nbytes == 8 && buf[8]&0x80 != 0}
 
 	return &plistValue{Integer, result}, nil
 }
@@ -253,11 +260,21 @@ func (bp *binaryParser) parseReal(marker byte) (*plistValue, error) {
 	if _, err := bp.Read(buf); err != nil {
 		return nil, err
 	}
-	var r float64
-	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &r); err != nil {
-		return nil, err
+	switch nbytes {
+	case 4:
+		var r float32
+		if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &r); err != nil {
+			return nil, err
+		}
+		return &plistValue{Real, sizedFloat{float64(r), 32}}, nil
+	case 8:
+		var r float64
+		if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &r); err != nil {
+			return nil, err
+		}
+		return &plistValue{Real, sizedFloat{r, 64}}, nil
 	}
-	return &plistValue{Real, sizedFloat{r, nbytes * 8}}, nil
+	return nil, fmt.Errorf("plist: invalid real size %d", nbytes)
 }
 
 func (bp *binaryParser) parseDate(marker byte) (*plistValue, error) {
@@ -285,8 +302,14 @@ func (bp *binaryParser) parseData(marker byte) (*plistValue, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := bp.limits.dataSize(count); err != nil {
+		return nil, err
+	}
+	if err := bp.fits(count, 1); err != nil {
+		return nil, err
+	}
 	buf := make([]byte, count)
-	if _, err := bp.Read(buf); err != nil {
+	if _, err := io.ReadFull(bp, buf); err != nil {
 		return nil, err
 	}
 	return &plistValue{Data, buf}, nil
@@ -297,8 +320,14 @@ func (bp *binaryParser) parseASCII(marker byte) (*plistValue, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := bp.limits.stringSize(count); err != nil {
+		return nil, err
+	}
+	if err := bp.fits(count, 1); err != nil {
+		return nil, err
+	}
 	buf := make([]byte, count)
-	if _, err := bp.Read(buf); err != nil {
+	if _, err := io.ReadFull(bp, buf); err != nil {
 		return nil, err
 	}
 	return &plistValue{String, string(buf)}, nil
@@ -309,11 +338,17 @@ func (bp *binaryParser) parseUTF16(marker byte) (*plistValue, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := bp.fits(count, 2); err != nil {
+		return nil, err
+	}
+	if err := bp.limits.stringSize(2 * count); err != nil {
+		return nil, err
+	}
 	// Each character in the UTF16 string is 2 bytes.  First we read everything
 	// into a byte slice, then convert this into a slice of uint16, then this
 	// gets converted into a slice of rune, which gets converted to a string.
 	buf := make([]byte, 2*count)
-	if _, err := bp.Read(buf); err != nil {
+	if _, err := io.ReadFull(bp, buf); err != nil {
 		return nil, err
 	}
 	uni := make([]uint16, count)
@@ -324,10 +359,17 @@ func (bp *binaryParser) parseUTF16(marker byte) (*plistValue, error) {
 }
 
 func (bp *binaryParser) parseArray(marker byte) (*plistValue, error) {
+	if err := bp.limits.enter(); err != nil {
+		return nil, err
+	}
+	defer bp.limits.leave()
 	count, err := bp.readCount(marker)
 	if err != nil {
 		return nil, err
 	}
+	if err := bp.limits.count(count); err != nil {
+		return nil, err
+	}
 	// A list of count object refs representing the items in the array follow.
 	list, err := bp.readObjectList(count)
 	if err != nil {
@@ -337,10 +379,17 @@ func (bp *binaryParser) parseArray(marker byte) (*plistValue, error) {
 }
 
 func (bp *binaryParser) parseDict(marker byte) (*plistValue, error) {
+	if err := bp.limits.enter(); err != nil {
+		return nil, err
+	}
+	defer bp.limits.leave()
 	count, err := bp.readCount(marker)
 	if err != nil {
 		return nil, err
 	}
+	if err := bp.limits.count(2 * count); err != nil {
+		return nil, err
+	}
 	// A list of 2*count object refs follow.  All of the keys are listed first,
 	// followed by all of the values.
 	keys, err := bp.readObjectList(count)
@@ -351,14 +400,14 @@ func (bp *binaryParser) parseDict(marker byte) (*plistValue, error) {
 	if err != nil {
 		return nil, err
 	}
-	m := make(map[string]*plistValue)
+	dict := &dictionary{m: make(map[string]*plistValue)}
 	for i := uint64(0); i < count; i++ {
 		if keys[i].kind != String {
 			return nil, fmt.Errorf("plist: dictionary key is not a string: %v", keys[i])
 		}
-		m[keys[i].value.(string)] = vals[i]
+		dict.set(keys[i].value.(string), vals[i])
 	}
-	return &plistValue{Dictionary, &dictionary{m: m}}, nil
+	return &plistValue{Dictionary, dict}, nil
 }
 
 // readCount reads the variable-length encoded integer count
@@ -403,10 +452,22 @@ func (bp *binaryParser) readObjectRef() (uint64, error) {
 	return binary.BigEndian.Uint64(buf), nil
 }
 
+// fits checks that count elements of size bytes can be in the input, before
+// they are allocated
+func (bp *binaryParser) fits(count, size uint64) error {
+	if count > bp.size/size {
+		return fmt.Errorf("plist: %d elements of %d bytes do not fit in %d bytes", count, size, bp.size)
+	}
+	return nil
+}
+
 // readObjectList is a helper function for parseArray and parseDict.
 // It decodes a sequence of object refs from the current offset in the plist
 // and returns the decoded objects in a slice.
 func (bp *binaryParser) readObjectList(count uint64) ([]*plistValue, error) {
+	if err := bp.fits(count, uint64(bp.ObjectRefSize)); err != nil {
+		return nil, err
+	}
 	list := make([]*plistValue, count)
 	for i := uint64(0); i < count; i++ {
 		// Read index of object in offset table.
@@ -0,0 +1,266 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+	"unicode/utf16"
+)
+
+// appleEpoch is the Unix time of Jan 1, 2001 GMT, the epoch of binary plist dates
+const appleEpoch = 978307200
+
+// binaryEncoder writes plistValues as a bplist00 document
+type binaryEncoder struct {
+	writer io.Writer
+
+	objects []*plistValue          // objects in object table order
+	uniques map[interface{}]uint64 // index of deduplicated scalar objects
+	refs    map[*plistValue]uint64 // index of every flattened object
+	refSize int
+}
+
+// uniqueKey identifies scalar values that can share one object
+type uniqueKey struct {
+	kind  Kind
+	value interface{}
+}
+
+func newBinaryEncoder(w io.Writer) *binaryEncoder {
+	return &binaryEncoder{
+		writer:  w,
+		uniques: make(map[interface{}]uint64),
+		refs:    make(map[*plistValue]uint64),
+	}
+}
+
+func (e *binaryEncoder) generateDocument(pval *plistValue) error {
+	e.flatten(pval)
+	e.refSize = minBytes(uint64(len(e.objects)))
+
+	var buf bytes.Buffer
+	buf.WriteString("bplist00")
+	offsets := make([]uint64, len(e.objects))
+	for i, obj := range e.objects {
+		offsets[i] = uint64(buf.Len())
+		if err := e.writeObject(&buf, obj); err != nil {
+			return err
+		}
+	}
+
+	offsetTableOffset := uint64(buf.Len())
+	offsetIntSize := minBytes(offsetTableOffset)
+	for _, off := range offsets {
+		writeSizedInt(&buf, off, offsetIntSize)
+	}
+
+	trailer := plistTrailer{
+		OffsetIntSize:     uint8(offsetIntSize),
+		ObjectRefSize:     uint8(e.refSize),
+		NumObjects:        uint64(len(e.objects)),
+		RootObject:        0,
+		OffsetTableOffset: offsetTableOffset,
+	}
+	if err := binary.Write(&buf, binary.BigEndian, &trailer); err != nil {
+		return err
+	}
+	_, err := e.writer.Write(buf.Bytes())
+	return err
+}
+
+// flatten assigns object table indexes in depth-first order, the root is object 0
+func (e *binaryEncoder) flatten(pval *plistValue) uint64 {
+	if key, ok := e.uniqueKey(pval); ok {
+		if idx, ok := e.uniques[key]; ok {
+			e.refs[pval] = idx
+			return idx
+		}
+		idx := e.add(pval)
+		e.uniques[key] = idx
+		return idx
+	}
+
+	idx := e.add(pval)
+	switch pval.kind {
+	case Array:
+		for _, v := range pval.value.([]*plistValue) {
+			e.flatten(v)
+		}
+	case Dictionary:
+		dict := pval.value.(*dictionary)
+		dict.populateArrays()
+		for _, k := range dict.keys {
+			e.flatten(&plistValue{String, k})
+		}
+		for _, v := range dict.values {
+			e.flatten(v)
+		}
+	}
+	return idx
+}
+
+func (e *binaryEncoder) add(pval *plistValue) uint64 {
+	idx := uint64(len(e.objects))
+	e.objects = append(e.objects, pval)
+	e.refs[pval] = idx
+	return idx
+}
+
+func (e *binaryEncoder) uniqueKey(pval *plistValue) (interface{}, bool) {
+	switch pval.kind {
+	case String, Integer, Real, Boolean, UIDKind:
+		return uniqueKey{pval.kind, pval.value}, true
+	case Data:
+		return uniqueKey{pval.kind, string(pval.value.([]byte))}, true
+	case Date:
+		// UnixNano overflows outside the years 1678 to 2262
+		t := pval.value.(time.Time)
+		return uniqueKey{pval.kind, [2]int64{t.Unix(), int64(t.Nanosecond())}}, true
+	}
+	return nil, false
+}
+
+// ref returns the index of an already flattened value, dictionary keys are looked up by string
+func (e *binaryEncoder) ref(pval *plistValue) uint64 {
+	if idx, ok := e.refs[pval]; ok {
+		return idx
+	}
+	key, _ := e.uniqueKey(pval)
+	return e.uniques[key]
+}
+
+func (e *binaryEncoder) writeObject(buf *bytes.Buffer, pval *plistValue) error {
+	switch pval.kind {
+	case Boolean:
+		if pval.value.(bool) {
+			buf.WriteByte(0x09)
+		} else {
+			buf.WriteByte(0x08)
+		}
+	case Integer:
+		writeInteger(buf, pval.value.(signedInt))
+	case Real:
+		f := pval.value.(sizedFloat)
+		if f.bits == 32 {
+			buf.WriteByte(0x22)
+			binary.Write(buf, binary.BigEndian, float32(f.value))
+		} else {
+			buf.WriteByte(0x23)
+			binary.Write(buf, binary.BigEndian, f.value)
+		}
+	case Date:
+		t := pval.value.(time.Time)
+		secs := float64(t.Unix()-appleEpoch) + float64(t.Nanosecond())/1e9
+		buf.WriteByte(0x33)
+		binary.Write(buf, binary.BigEndian, secs)
+	case Data:
+		data := pval.value.([]byte)
+		writeMarker(buf, 0x40, uint64(len(data)))
+		buf.Write(data)
+	case String:
+		writeString(buf, pval.value.(string))
+	case UIDKind:
+		uid := uint64(pval.value.(UID))
+		n := minBytes(uid)
+		buf.WriteByte(0x80 | byte(n-1))
+		writeSizedInt(buf, uid, n)
+	case Array:
+		values := pval.value.([]*plistValue)
+		writeMarker(buf, 0xa0, uint64(len(values)))
+		for _, v := range values {
+			writeSizedInt(buf, e.ref(v), e.refSize)
+		}
+	case Dictionary:
+		dict := pval.value.(*dictionary)
+		writeMarker(buf, 0xd0, uint64(len(dict.keys)))
+		for _, k := range dict.keys {
+			writeSizedInt(buf, e.ref(&plistValue{String, k}), e.refSize)
+		}
+		for _, v := range dict.values {
+			writeSizedInt(buf, e.ref(v), e.refSize)
+		}
+	default:
+		return fmt.Errorf("plist: cannot encode %v in a binary plist", pval.kind)
+	}
+	return nil
+}
+
+// writeString writes ASCII strings as bytes and everything else as UTF-16
+func writeString(buf *bytes.Buffer, s string) {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		writeMarker(buf, 0x50, uint64(len(s)))
+		buf.WriteString(s)
+		return
+	}
+	units := utf16.Encode([]rune(s))
+	writeMarker(buf, 0x60, uint64(len(units)))
+	binary.Write(buf, binary.BigEndian, units)
+}
+
+// writeInteger writes 1, 2 and 4 byte unsigned integers, 8 byte signed integers,
+// and 16 byte integers for unsigned values above math.MaxInt64
+func writeInteger(buf *bytes.Buffer, i signedInt) {
+	switch {
+	case i.signed && int64(i.value) < 0:
+		buf.WriteByte(0x13)
+		writeSizedInt(buf, i.value, 8)
+	case !i.signed && i.value > math.MaxInt64:
+		buf.WriteByte(0x14)
+		writeSizedInt(buf, 0, 8)
+		writeSizedInt(buf, i.value, 8)
+	default:
+		n := minBytes(i.value)
+		switch n {
+		case 1:
+			buf.WriteByte(0x10)
+		case 2:
+			buf.WriteByte(0x11)
+		case 4:
+			buf.WriteByte(0x12)
+		default:
+			buf.WriteByte(0x13)
+		}
+		writeSizedInt(buf, i.value, n)
+	}
+}
+
+// writeMarker writes the object marker with the count in the low nibble,
+// or followed by an integer object when the count doesn't fit
+func writeMarker(buf *bytes.Buffer, marker byte, count uint64) {
+	if count < 0xf {
+		buf.WriteByte(marker | byte(count))
+		return
+	}
+	buf.WriteByte(marker | 0xf)
+	writeInteger(buf, signedInt{count, false})
+}
+
+// writeSizedInt writes the low size bytes of v big endian
+func writeSizedInt(buf *bytes.Buffer, v uint64, size int) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	buf.Write(b[8-size:])
+}
+
+// minBytes returns the number of bytes, 1, 2, 4 or 8, needed to store v
+func minBytes(v uint64) int {
+	switch {
+	case v <= math.MaxUint8:
+		return 1
+	case v <= math.MaxUint16:
+		return 2
+	case v <= math.MaxUint32:
+		return 4
+	}
+	return 8
+}
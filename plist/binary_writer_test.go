@@ -0,0 +1,177 @@
+package plist
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type binaryTestStruct struct {
+	Name     string            `plist:"name"`
+	Unicode  string            `plist:"unicode"`
+	Long     string            `plist:"long"`
+	Count    int               `plist:"count"`
+	Negative int64             `plist:"negative"`
+	Big      uint64            `plist:"big"`
+	Ratio    float64           `plist:"ratio"`
+	Small    float32           `plist:"small"`
+	Enabled  bool              `plist:"enabled"`
+	Disabled bool              `plist:"disabled"`
+	Created  time.Time         `plist:"created"`
+	Blob     []byte            `plist:"blob"`
+	Tags     []string          `plist:"tags"`
+	Nested   map[string]string `plist:"nested"`
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	in := binaryTestStruct{
+		Name:     "widuu",
+		Unicode:  "héllo wörld ✓ 😀",
+		Long:     strings.Repeat("a", 300),
+		Count:    70000,
+		Negative: -42,
+		Big:      math.MaxUint64,
+		Ratio:    3.25,
+		Small:    1.5,
+		Enabled:  true,
+		Created:  time.Date(2020, 5, 1, 12, 30, 0, 0, time.UTC),
+		Blob:     []byte{0, 1, 2, 0xff},
+		Tags:     []string{"a", "b", "a", "widuu"},
+		Nested:   map[string]string{"name": "widuu", "k": "v"},
+	}
+	data, err := MarshalFormat(in, BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("bplist00")) {
+		t.Fatalf("missing bplist00 header: %q", data[:8])
+	}
+
+	var out binaryTestStruct
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Created.Equal(in.Created) {
+		t.Errorf("created = %v, want %v", out.Created, in.Created)
+	}
+	out.Created = in.Created
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("round trip mismatch\n got %+v\nwant %+v", out, in)
+	}
+}
+
+func TestBinaryDeduplication(t *testing.T) {
+	in := map[string]interface{}{
+		"a": "same",
+		"b": "same",
+		"c": []interface{}{"same", "same"},
+	}
+	data, err := MarshalFormat(in, BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte("same")); n != 1 {
+		t.Errorf("string written %d times, want 1", n)
+	}
+	parser, err := newBinaryParser(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// dict, keys a b c, "same" and the array
+	if parser.NumObjects != 6 {
+		t.Errorf("objects = %d, want 6", parser.NumObjects)
+	}
+}
+
+func TestBinaryDateDeduplication(t *testing.T) {
+	// dates whose UnixNano overflow to the same value are distinct
+	far := time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)
+	in := []interface{}{far, far.Add(1<<63 - 1).Add(1<<63 - 1).Add(2), far}
+	if in[0].(time.Time).UnixNano() != in[1].(time.Time).UnixNano() {
+		t.Fatal("dates do not collide in UnixNano")
+	}
+	data, err := MarshalFormat(in, BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser, err := newBinaryParser(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// array and two dates
+	if parser.NumObjects != 3 {
+		t.Errorf("objects = %d, want 3", parser.NumObjects)
+	}
+	var out []time.Time
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	// binary dates are float seconds, far dates lose nanoseconds
+	for i := range out {
+		if d := out[i].Sub(in[i].(time.Time)); d > time.Millisecond || d < -time.Millisecond {
+			t.Errorf("date %d = %v, want %v", i, out[i], in[i])
+		}
+	}
+}
+
+func TestBinaryRefSize(t *testing.T) {
+	// more than 256 objects need two byte refs
+	in := make([]int, 400)
+	for i := range in {
+		in[i] = i
+	}
+	data, err := MarshalFormat(in, BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser, err := newBinaryParser(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parser.ObjectRefSize != 2 {
+		t.Errorf("ref size = %d, want 2", parser.ObjectRefSize)
+	}
+	var out []int
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Error("round trip mismatch")
+	}
+}
+
+func TestNewBinaryEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewBinaryEncoder(&buf).Encode(map[string]bool{"ok": true}); err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]bool
+	if err := NewBinaryDecoder(bytes.NewReader(buf.Bytes())).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !out["ok"] {
+		t.Errorf("decoded %v", out)
+	}
+}
+
+func TestBinaryIntegerSign(t *testing.T) {
+	// 8-byte integers are signed, larger unsigned values are written in 16 bytes
+	data, err := MarshalFormat([]interface{}{int64(-1), uint64(1 << 40), uint64(math.MaxUint64)}, BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []interface{}
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, []interface{}{int64(-1), uint64(1 << 40), uint64(math.MaxUint64)}) {
+		t.Errorf("integers = %#v", out)
+	}
+	var unsigned []uint64
+	if err := Unmarshal(data, &unsigned); err == nil {
+		t.Errorf("decoded -1 into uint64: %v", unsigned)
+	}
+}
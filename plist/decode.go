@@ -1,11 +1,15 @@
 package plist
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
 	"reflect"
+	"strconv"
 	"time"
 )
 
@@ -16,20 +20,45 @@ type Unmarshaler interface {
 	UnmarshalPlist(f func(interface{}) error) error
 }
 
+// ErrEmptyInput is returned when decoding an empty or whitespace only input.
+var ErrEmptyInput = errors.New("plist: empty input")
+
 // Unmarshal parses the plist-encoded data and stores the result in the value pointed to by v.
+// The format is detected with DetectFormat, and the document is decoded with DefaultLimits.
 func Unmarshal(data []byte, v interface{}) error {
-	// Check for binary plist here before setting up the decoder.
-	if string(data[:7]) == "bplist0" {
-		return NewBinaryDecoder(bytes.NewReader(data)).Decode(v)
+	format := DetectFormat(data)
+	if format == InvalidFormat {
+		return ErrEmptyInput
 	}
-	return NewXMLDecoder(bytes.NewReader(data)).Decode(v)
+	return (&Decoder{reader: bytes.NewReader(trimInput(data, format)), format: format, limits: DefaultLimits}).Decode(v)
 }
 
 // A Decoder reads and decodes Apple plist objects from an input stream.
-// The plists can be in XML or binary format.
+// The plists can be in XML, binary, OpenStep or JSON format.
 type Decoder struct {
-	reader   io.Reader // binary decoders assert this to io.ReadSeeker
-	isBinary bool      // true if this is a binary plist
+	reader io.Reader // binary decoders assert this to io.ReadSeeker
+	format Format    // InvalidFormat detects the format from the input
+
+	preserveOrder         bool
+	disallowUnknownFields bool
+
+	path   keyPath    // key path of the value being decoded
+	xml    *xmlParser // parser of an XML document, for error positions
+	limits Limits
+}
+
+// DisallowUnknownFields makes Decode return an UnknownFieldError when a
+// dictionary decoded into a struct has a key that matches no field, and the
+// struct has no ,inline map to hold it.
+func (d *Decoder) DisallowUnknownFields() {
+	d.disallowUnknownFields = true
+}
+
+// PreserveOrder makes the decoder keep the source key order by decoding
+// dictionaries into *OrderedMap, instead of map[string]interface{}, when the
+// target is an empty interface. Struct and map targets are not affected.
+func (d *Decoder) PreserveOrder(preserve bool) {
+	d.preserveOrder = preserve
 }
 
 // NewDecoder returns a new XML plist decoder.
@@ -40,51 +69,141 @@ func NewDecoder(r io.Reader) *Decoder {
 
 // NewXMLDecoder returns a new decoder that reads an XML plist from r.
 func NewXMLDecoder(r io.Reader) *Decoder {
-	return &Decoder{reader: r, isBinary: false}
+	return &Decoder{reader: r, format: XMLFormat, limits: DefaultLimits}
 }
 
 // NewBinaryDecoder returns a new decoder that reads a binary plist from r.
 // No error checking is done to make sure that r is actually a binary plist.
 func NewBinaryDecoder(r io.ReadSeeker) *Decoder {
-	return &Decoder{reader: r, isBinary: true}
+	return &Decoder{reader: r, format: BinaryFormat, limits: DefaultLimits}
+}
+
+// NewAutoDecoder returns a new decoder that detects the format of the plist read from r.
+// Binary plists are read into memory when r is not an io.ReadSeeker.
+func NewAutoDecoder(r io.Reader) *Decoder {
+	return &Decoder{reader: r, limits: DefaultLimits}
+}
+
+// NewOpenStepDecoder returns a new decoder that reads an OpenStep or GNUstep plist from r.
+func NewOpenStepDecoder(r io.Reader) *Decoder {
+	return &Decoder{reader: r, format: OpenStepFormat, limits: DefaultLimits}
 }
 
 // Decode reads the next plist-encoded value from its input and stores it in
 // the value pointed to by v.  Decode uses xml.Decoder to do the heavy lifting
-// for XML plists, and uses binaryParser for binary plists.
+// for XML plists, binaryParser for binary plists, openStepParser for
+// OpenStep plists and json.Decoder for JSON plists.
 func (d *Decoder) Decode(v interface{}) error {
 	val := reflect.ValueOf(v)
 	if val.Kind() != reflect.Ptr {
 		return errors.New("plist: non-pointer passed to Unmarshal")
 	}
-	var pval *plistValue
-	if d.isBinary {
-		// For binary decoder, type assert the reader to an io.ReadSeeker
+	d.path, d.xml = nil, nil
+	pval, err := d.parse()
+	if err != nil {
+		return err
+	}
+	return d.unmarshal(pval, val.Elem())
+}
+
+// parse reads the document with the parser of the decoder format
+func (d *Decoder) parse() (*plistValue, error) {
+	limits := newLimiter(d.limits)
+	format, reader := d.format, d.reader
+	start := inputStart(reader)
+	if format == InvalidFormat {
 		var err error
-		r, ok := d.reader.(io.ReadSeeker)
+		format, reader, err = DetectReaderFormat(reader)
+		if err != nil {
+			return nil, err
+		}
+		if format == InvalidFormat {
+			return nil, ErrEmptyInput
+		}
+		if format == BinaryFormat {
+			if rs, ok := d.reader.(io.ReadSeeker); ok {
+				reader = rs
+			} else {
+				data, err := ioutil.ReadAll(limits.reader(reader))
+				if err != nil {
+					return nil, err
+				}
+				reader = bytes.NewReader(data)
+			}
+		}
+	}
+
+	switch format {
+	case BinaryFormat:
+		// For binary decoder, type assert the reader to an io.ReadSeeker
+		r, ok := reader.(io.ReadSeeker)
 		if !ok {
-			return fmt.Errorf("binary plist decoder requires an io.ReadSeeker")
+			return nil, fmt.Errorf("binary plist decoder requires an io.ReadSeeker")
 		}
-		parser, err := newBinaryParser(r)
-		if err != nil {
-			return err
+		if err := limits.seeker(r); err != nil {
+			return nil, err
 		}
-		pval, err = parser.parseDocument()
+		parser, err := newBinaryParser(r, limits)
 		if err != nil {
-			return err
+			return nil, err
 		}
-	} else {
-		var err error
-		parser := newXMLParser(d.reader)
-		pval, err = parser.parseDocument(nil)
+		return parser.parseDocument()
+	case OpenStepFormat, GNUStepFormat:
+		data, err := ioutil.ReadAll(limits.reader(reader))
 		if err != nil {
-			return err
+			return nil, err
 		}
+		parser := newOpenStepParser(trimInput(data, format))
+		parser.limits = limits
+		return parser.parseDocument()
+	case JSONFormat:
+		parser := newJSONParser(skipBOM(limits.reader(reader)))
+		parser.limits = limits
+		return parser.parseDocument()
+	default:
+		parser := newXMLParser(skipBOM(limits.reader(reader)))
+		parser.limits = limits
+		parser.setInput(d.reader, start)
+		d.xml = parser
+		return parser.parseDocument(nil)
 	}
-	return d.unmarshal(pval, val.Elem())
 }
 
+// skipBOM drops a leading UTF-8 byte order mark from r
+func skipBOM(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	if head, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(head, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+	return br
+}
+
+// unmarshal decodes pval into v, errors are returned as a DecodeError when
+// the key path or position of the value is known
 func (d *Decoder) unmarshal(pval *plistValue, v reflect.Value) error {
+	if err := d.unmarshalValue(pval, v); err != nil {
+		return d.decodeError(pval, err)
+	}
+	return nil
+}
+
+func (d *Decoder) decodeError(pval *plistValue, err error) error {
+	if _, ok := err.(*DecodeError); ok {
+		return err
+	}
+	var line, column int
+	if d.xml != nil {
+		if offset, ok := d.xml.offsets[pval]; ok {
+			line, column = d.xml.position(offset)
+		}
+	}
+	if len(d.path) == 0 && line == 0 {
+		return err
+	}
+	return &DecodeError{Path: d.path.String(), Line: line, Column: column, Err: err}
+}
+
+func (d *Decoder) unmarshalValue(pval *plistValue, v reflect.Value) error {
 	// check for empty interface v type
 	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
 		val := reflect.ValueOf(d.valueInterface(pval))
@@ -102,6 +221,11 @@ func (d *Decoder) unmarshal(pval *plistValue, v reflect.Value) error {
 		v = v.Elem()
 	}
 
+	if v.Type() == valueType {
+		v.Set(reflect.ValueOf(*newValue(pval)))
+		return nil
+	}
+
 	unmarshalerType := reflect.TypeOf((*Unmarshaler)(nil)).Elem()
 
 	if v.CanInterface() && v.Type().Implements(unmarshalerType) {
@@ -151,6 +275,12 @@ func (d *Decoder) unmarshal(pval *plistValue, v reflect.Value) error {
 		return d.unmarshalData(pval, v)
 	case Date:
 		return d.unmarshalDate(pval, v)
+	case UIDKind:
+		if v.Type() == uidType {
+			v.Set(reflect.ValueOf(pval.value))
+			return nil
+		}
+		return d.unmarshalUID(pval, v)
 	default:
 		return fmt.Errorf("plist: %v is an unsuported plist element kind", pval.kind)
 	}
@@ -189,18 +319,22 @@ func (d *Decoder) unmarshalBoolean(pval *plistValue, v reflect.Value) error {
 }
 
 func (d *Decoder) unmarshalDictionary(pval *plistValue, v reflect.Value) error {
+	if v.Type() == orderedMapType {
+		d.unmarshalOrderedMap(pval.value.(*dictionary), v)
+		return nil
+	}
+	if v.Type() == uidType {
+		uid, ok := dictionaryUID(pval.value.(*dictionary))
+		if !ok {
+			return UnmarshalTypeError{"dictionary", v.Type()}
+		}
+		v.SetUint(uint64(uid))
+		return nil
+	}
 	subvalues := pval.value.(*dictionary).m
 	switch v.Kind() {
 	case reflect.Struct:
-		fields := cachedTypeFields(v.Type())
-		for _, field := range fields {
-			if _, ok := subvalues[field.name]; !ok {
-				continue
-			}
-			if err := d.unmarshal(subvalues[field.name], field.value(v)); err != nil {
-				return err
-			}
-		}
+		return d.unmarshalStruct(pval.value.(*dictionary), v)
 	case reflect.Map:
 		if v.IsNil() {
 			v.Set(reflect.MakeMap(v.Type()))
@@ -211,7 +345,10 @@ func (d *Decoder) unmarshalDictionary(pval *plistValue, v reflect.Value) error {
 			if !mapElem.IsValid() {
 				mapElem = reflect.New(v.Type().Elem()).Elem()
 			}
-			if err := d.unmarshal(sval, mapElem); err != nil {
+			d.path.pushKey(k)
+			err := d.unmarshal(sval, mapElem)
+			d.path.pop()
+			if err != nil {
 				return err
 			}
 			v.SetMapIndex(keyv, mapElem)
@@ -237,24 +374,19 @@ func (d *Decoder) unmarshalArray(pval *plistValue, v reflect.Value) error {
 		// Slice of element values.
 		// Grow slice.
 		// Borrowed from https://golang.org/src/encoding/xml/read.go
+		// The decoded elements replace the existing ones.
 		cnt := len(subvalues)
-		if cnt >= v.Cap() {
-			ncap := 2 * cnt
-			if ncap < 4 {
-				ncap = 4
-			}
-			new := reflect.MakeSlice(v.Type(), v.Len(), ncap)
-			reflect.Copy(new, v)
-			v.Set(new)
+		if cnt > v.Cap() || v.IsNil() {
+			v.Set(reflect.MakeSlice(v.Type(), cnt, cnt))
 		}
-		n := v.Len()
 		v.SetLen(cnt)
-		for _, sval := range subvalues {
-			if err := d.unmarshal(sval, v.Index(n)); err != nil {
-				v.SetLen(cnt)
+		for n, sval := range subvalues {
+			d.path.pushIndex(n)
+			err := d.unmarshal(sval, v.Index(n))
+			d.path.pop()
+			if err != nil {
 				return err
 			}
-			n++
 		}
 	default:
 		return UnmarshalTypeError{"array", v.Type()}
@@ -265,7 +397,15 @@ func (d *Decoder) unmarshalArray(pval *plistValue, v reflect.Value) error {
 func (d *Decoder) unmarshalInteger(pval *plistValue, v reflect.Value) error {
 	switch v.Kind() {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		v.SetInt(int64(pval.value.(signedInt).value))
+		si := pval.value.(signedInt)
+		if !si.signed && si.value > math.MaxInt64 {
+			return &IntegerOverflowError{strconv.FormatUint(si.value, 10), v.Type()}
+		}
+		i := int64(si.value)
+		if v.OverflowInt(i) {
+			return &IntegerOverflowError{strconv.FormatInt(i, 10), v.Type()}
+		}
+		v.SetInt(i)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16,
 		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		// Make sure plistValue isn't negative when decoding into uint.
@@ -273,7 +413,11 @@ func (d *Decoder) unmarshalInteger(pval *plistValue, v reflect.Value) error {
 			return UnmarshalTypeError{
 				fmt.Sprintf("%v", int64(pval.value.(signedInt).value)), v.Type()}
 		}
-		v.SetUint(pval.value.(signedInt).value)
+		u := pval.value.(signedInt).value
+		if v.OverflowUint(u) {
+			return &IntegerOverflowError{strconv.FormatUint(u, 10), v.Type()}
+		}
+		v.SetUint(u)
 	default:
 		return UnmarshalTypeError{
 			fmt.Sprintf("%v", pval.value.(signedInt).value), v.Type()}
@@ -307,11 +451,16 @@ func (d *Decoder) valueInterface(pval *plistValue) interface{} {
 	case Array:
 		return d.arrayInterface(pval.value.([]*plistValue))
 	case Dictionary:
+		if d.preserveOrder {
+			return d.orderedMapInterface(pval.value.(*dictionary))
+		}
 		return d.dictionaryInterface(pval.value.(*dictionary))
 	case Data:
 		return pval.value.([]byte)
 	case Date:
 		return pval.value.(time.Time)
+	case UIDKind:
+		return pval.value.(UID)
 	default:
 		return nil
 	}
@@ -333,6 +482,100 @@ func (d *Decoder) dictionaryInterface(dict *dictionary) map[string]interface{} {
 	return out
 }
 
+func (d *Decoder) unmarshalStruct(dict *dictionary, v reflect.Value) error {
+	fields := cachedTypeFields(v.Type())
+	known := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		if field.inline {
+			continue
+		}
+		known[field.name] = true
+		sval, ok := dict.m[field.name]
+		if !ok {
+			if field.required {
+				return &RequiredFieldError{field.name, v.Type()}
+			}
+			continue
+		}
+		d.path.pushKey(field.name)
+		var err error
+		if field.asString && sval.kind == String {
+			if err = unmarshalQuoted(sval.value.(string), field.value(v)); err != nil {
+				err = d.decodeError(sval, err)
+			}
+		} else {
+			err = d.unmarshal(sval, field.value(v))
+		}
+		d.path.pop()
+		if err != nil {
+			return err
+		}
+	}
+
+	inline, hasInline := inlineField(fields)
+	for _, k := range dict.orderedKeys() {
+		if known[k] {
+			continue
+		}
+		if !hasInline {
+			if d.disallowUnknownFields {
+				return &UnknownFieldError{k, v.Type()}
+			}
+			continue
+		}
+		m := inline.value(v)
+		if m.IsNil() {
+			m.Set(reflect.MakeMap(m.Type()))
+		}
+		elem := reflect.New(m.Type().Elem()).Elem()
+		d.path.pushKey(k)
+		err := d.unmarshal(dict.m[k], elem)
+		d.path.pop()
+		if err != nil {
+			return err
+		}
+		m.SetMapIndex(reflect.ValueOf(k).Convert(m.Type().Key()), elem)
+	}
+	return nil
+}
+
+// unmarshalQuoted decodes the string of a ,string field
+func unmarshalQuoted(s string, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	var err error
+	switch v.Kind() {
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(s); err == nil {
+			v.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if i, err = strconv.ParseInt(s, 10, v.Type().Bits()); err == nil {
+			v.SetInt(i)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		if u, err = strconv.ParseUint(s, 10, v.Type().Bits()); err == nil {
+			v.SetUint(u)
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(s, v.Type().Bits()); err == nil {
+			v.SetFloat(f)
+		}
+	}
+	if err != nil {
+		return UnmarshalTypeError{fmt.Sprintf("%q", s), v.Type()}
+	}
+	return nil
+}
+
 // An UnmarshalTypeError describes a plist value that was
 // not appropriate for a value of a specific Go type.
 type UnmarshalTypeError struct {
@@ -2,8 +2,11 @@ package plist
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"reflect"
+	"sort"
+	"strconv"
 	"time"
 )
 
@@ -15,7 +18,9 @@ type Marshaler interface {
 type Encoder struct {
 	w io.Writer
 
-	indent string
+	format        Format
+	indent        string
+	preserveOrder bool
 }
 
 // Marshal ...
@@ -38,9 +43,30 @@ func MarshalIndent(v interface{}, indent string) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// NewEncoder returns a new encoder that writes to w.
+// MarshalFormat returns the plist encoding of v in the given format.
+func MarshalFormat(v interface{}, format Format) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.format = format
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NewEncoder returns a new encoder that writes an XML plist to w.
 func NewEncoder(w io.Writer) *Encoder {
-	return &Encoder{w: w}
+	return &Encoder{w: w, format: XMLFormat}
+}
+
+// NewOpenStepEncoder returns a new encoder that writes an OpenStep plist to w.
+func NewOpenStepEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, format: OpenStepFormat}
+}
+
+// NewBinaryEncoder returns a new encoder that writes a binary plist to w.
+func NewBinaryEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, format: BinaryFormat}
 }
 
 // Encode ...
@@ -50,12 +76,29 @@ func (e *Encoder) Encode(v interface{}) error {
 		return err
 	}
 
-	enc := newXMLEncoder(e.w)
-	enc.Indent("", e.indent)
-	return enc.generateDocument(pval)
+	switch e.format {
+	case XMLFormat:
+		enc := newXMLEncoder(e.w)
+		enc.Indent("", e.indent)
+		return enc.generateDocument(pval)
+	case BinaryFormat:
+		return newBinaryEncoder(e.w).generateDocument(pval)
+	case OpenStepFormat, GNUStepFormat:
+		enc := newOpenStepEncoder(e.w, e.format == GNUStepFormat)
+		enc.Indent(e.indent)
+		return enc.generateDocument(pval)
+	}
+	return fmt.Errorf("plist: unsupported format %v", e.format)
+}
+
+// PreserveOrder makes the encoder write struct fields in declaration order
+// instead of sorting them by key. Maps have no order and are always sorted;
+// OrderedMap and Value dictionaries are always written in their own order.
+func (e *Encoder) PreserveOrder(preserve bool) {
+	e.preserveOrder = preserve
 }
 
-// Indent ...
+// Indent sets the indentation of XML and OpenStep output, binary output is not indented.
 func (e *Encoder) Indent(indent string) {
 	e.indent = indent
 }
@@ -85,9 +128,29 @@ func (e *Encoder) marshal(v reflect.Value) (*plistValue, error) {
 	}
 
 	// check for empty interface v type
-	if v.Kind() == reflect.Interface && v.NumMethod() == 0 || v.Kind() == reflect.Ptr {
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
 		v = v.Elem()
 	}
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	// nil pointers and interfaces have no plist value
+	if !v.IsValid() {
+		return nil, &UnsupportedValueError{v, "nil"}
+	}
+
+	if v.Type() == orderedMapType {
+		return e.marshalOrderedMap(v.Interface().(OrderedMap))
+	}
+
+	if v.Type() == uidType {
+		return &plistValue{UIDKind, UID(v.Uint())}, nil
+	}
+
+	if v.Type() == valueType {
+		val := v.Interface().(Value)
+		return val.plistValue()
+	}
 
 	// check for time type
 	if v.Type() == reflect.TypeOf((*time.Time)(nil)).Elem() {
@@ -122,18 +185,44 @@ func (e *Encoder) marshal(v reflect.Value) (*plistValue, error) {
 func (e *Encoder) marshalStruct(v reflect.Value) (*plistValue, error) {
 	fields := cachedTypeFields(v.Type())
 	dict := &dictionary{
-		m: make(map[string]*plistValue, len(fields)),
+		m:       make(map[string]*plistValue, len(fields)),
+		ordered: e.preserveOrder,
 	}
 	for _, field := range fields {
+		if field.inline {
+			continue
+		}
 		val := field.value(v)
 		if field.omitEmpty && isEmptyValue(val) {
 			continue
 		}
+		if field.asString {
+			if s, ok := quotedString(val); ok {
+				dict.set(field.name, &plistValue{String, s})
+				continue
+			}
+		}
 		value, err := e.marshal(field.value(v))
 		if err != nil {
 			return nil, err
 		}
-		dict.m[field.name] = value
+		dict.set(field.name, value)
+	}
+	if inline, ok := inlineField(fields); ok {
+		// inline keys follow the fields, fields win over inline keys of the same name
+		m := inline.value(v)
+		keys := m.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			if _, ok := dict.m[k.String()]; ok {
+				continue
+			}
+			value, err := e.marshal(m.MapIndex(k))
+			if err != nil {
+				return nil, err
+			}
+			dict.set(k.String(), value)
+		}
 	}
 	return &plistValue{Dictionary, dict}, nil
 }
@@ -183,6 +272,27 @@ func (e *Encoder) marshalMap(v reflect.Value) (*plistValue, error) {
 	return &plistValue{Dictionary, dict}, nil
 }
 
+// quotedString returns the string of a ,string field, false for a nil pointer
+func quotedString(v reflect.Value) (string, bool) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), true
+	}
+	return "", false
+}
+
 // An UnsupportedTypeError is returned by Marshal when attempting
 // to encode an unsupported value type.
 type UnsupportedTypeError struct {
@@ -218,6 +328,10 @@ func isEmptyValue(v reflect.Value) bool {
 	case reflect.Interface, reflect.Ptr:
 		return v.IsNil()
 	case reflect.Struct:
+		if v.Type() == valueType {
+			// Value is not comparable, a zero Value has no kind
+			return v.Interface().(Value).kind == Invalid
+		}
 		return v.Interface() == reflect.Zero(v.Type()).Interface()
 	}
 	return false
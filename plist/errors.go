@@ -0,0 +1,168 @@
+package plist
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// DecodeError reports where decoding failed: the key path of the value, like
+// provisioningProfile.deviceIds[3], and for XML input read from an
+// io.ReadSeeker the line and column of its element. Err is the underlying
+// error, such as an UnmarshalTypeError or an IntegerOverflowError.
+type DecodeError struct {
+	Path   string // empty for the root value
+	Line   int    // zero when the position is unknown
+	Column int
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	var b strings.Builder
+	b.WriteString("plist: ")
+	if e.Path != "" {
+		b.WriteString(e.Path)
+	} else {
+		b.WriteString("root value")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&b, " (line %d, column %d)", e.Line, e.Column)
+	}
+	b.WriteString(": ")
+	b.WriteString(strings.TrimPrefix(e.Err.Error(), "plist: "))
+	return b.String()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// IntegerOverflowError reports an integer that does not fit its Go type, or
+// when Type is nil, an integer that does not fit in 64 bits.
+type IntegerOverflowError struct {
+	Value string
+	Type  reflect.Type
+}
+
+func (e *IntegerOverflowError) Error() string {
+	if e.Type == nil {
+		return "plist: integer " + e.Value + " overflows 64 bits"
+	}
+	return "plist: integer " + e.Value + " overflows Go value of type " + e.Type.String()
+}
+
+// InvalidDateError reports a date that is not in the format of its plist format.
+type InvalidDateError struct {
+	Value string
+	Err   error
+}
+
+func (e *InvalidDateError) Error() string {
+	return fmt.Sprintf("plist: invalid date %q", e.Value)
+}
+
+func (e *InvalidDateError) Unwrap() error {
+	return e.Err
+}
+
+// Base64Error reports data that is not valid base64.
+type Base64Error struct {
+	Err error
+}
+
+func (e *Base64Error) Error() string {
+	return "plist: invalid base64 data: " + e.Err.Error()
+}
+
+func (e *Base64Error) Unwrap() error {
+	return e.Err
+}
+
+// RequiredFieldError is returned when a dictionary lacks the key of a
+// ,required struct field.
+type RequiredFieldError struct {
+	Key  string
+	Type reflect.Type
+}
+
+func (e *RequiredFieldError) Error() string {
+	return fmt.Sprintf("plist: missing required key %q for Go value of type %v", e.Key, e.Type)
+}
+
+// UnknownFieldError is returned by a Decoder with DisallowUnknownFields when
+// a dictionary key matches no field of the struct it is decoded into.
+type UnknownFieldError struct {
+	Key  string
+	Type reflect.Type
+}
+
+func (e *UnknownFieldError) Error() string {
+	return fmt.Sprintf("plist: unknown key %q for Go value of type %v", e.Key, e.Type)
+}
+
+// keyPath is the path of the value being decoded, in rendered elements
+type keyPath []string
+
+func (p *keyPath) pushKey(key string) {
+	if len(*p) > 0 {
+		key = "." + key
+	}
+	*p = append(*p, key)
+}
+
+func (p *keyPath) pushIndex(i int) {
+	*p = append(*p, "["+strconv.Itoa(i)+"]")
+}
+
+func (p *keyPath) pop() {
+	*p = (*p)[:len(*p)-1]
+}
+
+func (p keyPath) String() string {
+	return strings.Join(p, "")
+}
+
+// inputPosition returns the 1-based line and column of offset in the input
+// that starts at start in r, after a byte order mark. Positions are only
+// needed for errors, so r is read again here and its offset restored,
+// instead of counting lines while parsing.
+func inputPosition(r io.ReadSeeker, start, offset int64) (line, column int) {
+	cur, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, 0
+	}
+	defer r.Seek(cur, io.SeekStart)
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return 0, 0
+	}
+	br := bufio.NewReader(r)
+	if head, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(head, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+
+	line, lineStart := 1, int64(0)
+	buf := make([]byte, 32*1024)
+	for read := int64(0); read < offset; {
+		if rest := offset - read; rest < int64(len(buf)) {
+			buf = buf[:rest]
+		}
+		n, err := br.Read(buf)
+		for i, chunk := 0, buf[:n]; ; {
+			j := bytes.IndexByte(chunk[i:], '\n')
+			if j < 0 {
+				break
+			}
+			i += j + 1
+			line, lineStart = line+1, read+int64(i)
+		}
+		read += int64(n)
+		if err != nil {
+			break
+		}
+	}
+	return line, int(offset-lineStart) + 1
+}
@@ -0,0 +1,153 @@
+package plist
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const profileResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>provisioningProfile</key>
+	<dict>
+		<key>deviceIds</key>
+		<array>
+			<string>a</string>
+			<string>b</string>
+			<string>c</string>
+			<integer>4</integer>
+		</array>
+	</dict>
+</dict>
+</plist>
+`
+
+func TestDecodeErrorPath(t *testing.T) {
+	var v struct {
+		Profile struct {
+			DeviceIDs []string `plist:"deviceIds"`
+		} `plist:"provisioningProfile"`
+	}
+	err := Unmarshal([]byte(profileResponse), &v)
+	var derr *DecodeError
+	if !errors.As(err, &derr) {
+		t.Fatalf("got %v, want a DecodeError", err)
+	}
+	if derr.Path != "provisioningProfile.deviceIds[3]" || derr.Line != 11 || derr.Column != 4 {
+		t.Errorf("got path %q line %d column %d", derr.Path, derr.Line, derr.Column)
+	}
+	var typeErr UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("got %v, want an UnmarshalTypeError", derr.Err)
+	}
+	want := "plist: provisioningProfile.deviceIds[3] (line 11, column 4): cannot unmarshal 4 into Go value of type string"
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+
+	// positions are found again in a reader that does not start the input, after a byte order mark
+	r := strings.NewReader("ignored\n\xef\xbb\xbf" + profileResponse)
+	r.Seek(int64(len("ignored\n")), io.SeekStart)
+	err = NewDecoder(r).Decode(&v)
+	if !errors.As(err, &derr) || derr.Line != 11 || derr.Column != 4 {
+		t.Errorf("got %v, want line 11 column 4", err)
+	}
+	if n, _ := r.Seek(0, io.SeekCurrent); n != r.Size() {
+		t.Errorf("reader offset %d not restored to %d", n, r.Size())
+	}
+
+	// a reader that can not be read again has no positions
+	err = NewDecoder(ioutil.NopCloser(strings.NewReader(profileResponse))).Decode(&v)
+	if !errors.As(err, &derr) || derr.Path != "provisioningProfile.deviceIds[3]" || derr.Line != 0 {
+		t.Errorf("got %v, want the path without position", err)
+	}
+
+	// without positions, as for JSON input, the path is still reported
+	err = Unmarshal([]byte(`{"provisioningProfile": {"deviceIds": ["a", 1]}}`), &v)
+	if !errors.As(err, &derr) || derr.Path != "provisioningProfile.deviceIds[1]" || derr.Line != 0 {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestIntegerOverflowError(t *testing.T) {
+	var small struct {
+		N uint8 `plist:"n"`
+	}
+	err := Unmarshal([]byte(`{"n": 300}`), &small)
+	var overflow *IntegerOverflowError
+	if !errors.As(err, &overflow) || overflow.Value != "300" || overflow.Type == nil {
+		t.Errorf("got %v, want an IntegerOverflowError", err)
+	}
+
+	var v interface{}
+	doc := "<plist><dict><key>n</key><integer>99999999999999999999</integer></dict></plist>"
+	err = Unmarshal([]byte(doc), &v)
+	var derr *DecodeError
+	if !errors.As(err, &overflow) || overflow.Type != nil || !errors.As(err, &derr) || derr.Path != "n" {
+		t.Errorf("got %v, want an IntegerOverflowError at n", err)
+	}
+
+	err = Unmarshal([]byte(`{ n = <*I99999999999999999999>; }`), &v)
+	if !errors.As(err, &overflow) {
+		t.Errorf("got %v, want an IntegerOverflowError", err)
+	}
+
+	// unsigned values above math.MaxInt64 do not fit signed types
+	binary, err := MarshalFormat(map[string]uint64{"n": math.MaxUint64}, BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, doc := range map[string]string{
+		"xml":      "<plist><dict><key>n</key><integer>18446744073709551615</integer></dict></plist>",
+		"openstep": `{ n = <*I18446744073709551615>; }`,
+		"json":     `{"n": 18446744073709551615}`,
+		"binary":   string(binary),
+	} {
+		var signed struct {
+			N int64 `plist:"n"`
+		}
+		err := Unmarshal([]byte(doc), &signed)
+		if !errors.As(err, &overflow) || overflow.Value != "18446744073709551615" || overflow.Type != reflect.TypeOf(int64(0)) {
+			t.Errorf("%s: got %v, %d, want an IntegerOverflowError", name, err, signed.N)
+		}
+		var unsigned struct {
+			N uint64 `plist:"n"`
+		}
+		if err := Unmarshal([]byte(doc), &unsigned); err != nil || unsigned.N != math.MaxUint64 {
+			t.Errorf("%s: uint64 = %d, %v", name, unsigned.N, err)
+		}
+	}
+}
+
+func TestInvalidDateError(t *testing.T) {
+	var v interface{}
+	err := Unmarshal([]byte("<plist><array><date>yesterday</date></array></plist>"), &v)
+	var dateErr *InvalidDateError
+	var derr *DecodeError
+	if !errors.As(err, &dateErr) || dateErr.Value != "yesterday" || !errors.As(err, &derr) || derr.Path != "[0]" {
+		t.Errorf("got %v, want an InvalidDateError at [0]", err)
+	}
+
+	err = Unmarshal([]byte(`( <*Dyesterday> )`), &v)
+	if !errors.As(err, &dateErr) {
+		t.Errorf("got %v, want an InvalidDateError", err)
+	}
+}
+
+func TestBase64Error(t *testing.T) {
+	var v interface{}
+	err := Unmarshal([]byte("<plist>\n<dict>\n<key>icon</key>\n  <data>!!!</data>\n</dict>\n</plist>"), &v)
+	var b64 *Base64Error
+	var derr *DecodeError
+	if !errors.As(err, &b64) || !errors.As(err, &derr) {
+		t.Fatalf("got %v, want a Base64Error", err)
+	}
+	if derr.Path != "icon" || derr.Line != 4 || derr.Column != 3 {
+		t.Errorf("got path %q line %d column %d", derr.Path, derr.Line, derr.Column)
+	}
+}
@@ -0,0 +1,113 @@
+package plist
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// detectPeekSize is the number of bytes DetectReaderFormat looks at.
+const detectPeekSize = 512
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// DetectFormat returns the format of the plist in data, or InvalidFormat when
+// data is empty. A UTF-8 byte order mark and leading whitespace are ignored.
+// Anything that is not binary, XML or JSON is reported as OpenStepFormat.
+func DetectFormat(data []byte) Format {
+	if bytes.HasPrefix(data, []byte("bplist0")) {
+		return BinaryFormat
+	}
+	data = bytes.TrimLeft(bytes.TrimPrefix(data, utf8BOM), " \t\r\n")
+	switch {
+	case len(data) == 0:
+		return InvalidFormat
+	case bytes.HasPrefix(data, []byte("<?")) || bytes.HasPrefix(data, []byte("<!")) || bytes.HasPrefix(data, []byte("<plist")):
+		return XMLFormat
+	case isJSON(data):
+		return JSONFormat
+	case hasGNUStepValue(data):
+		return GNUStepFormat
+	}
+	return OpenStepFormat
+}
+
+// DetectReaderFormat detects the format from the start of r. The returned
+// reader yields the complete input, including the bytes read for detection.
+func DetectReaderFormat(r io.Reader) (Format, io.Reader, error) {
+	br := bufio.NewReaderSize(r, detectPeekSize)
+	head, err := br.Peek(detectPeekSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return InvalidFormat, br, err
+	}
+	return DetectFormat(head), br, nil
+}
+
+// isJSON reports whether data starts like a JSON array or object. OpenStep
+// arrays use parentheses and OpenStep dictionaries separate keys with '=',
+// so only an object whose first key is followed by ':' is JSON.
+func isJSON(data []byte) bool {
+	switch data[0] {
+	case '[':
+		return true
+	case '{':
+	default:
+		return false
+	}
+	// {} is an empty dictionary in both formats and parsed as OpenStep
+	rest := bytes.TrimLeft(data[1:], " \t\r\n")
+	if len(rest) == 0 || rest[0] != '"' {
+		return false
+	}
+	for i := 1; i < len(rest); i++ {
+		switch rest[i] {
+		case '\\':
+			i++
+		case '"':
+			after := bytes.TrimLeft(rest[i+1:], " \t\r\n")
+			return len(after) > 0 && after[0] == ':'
+		}
+	}
+	return false
+}
+
+// hasGNUStepValue reports whether data holds a GNUstep <*...> typed value. The
+// scan follows OpenStep tokens so <* inside quoted strings and comments is ignored.
+func hasGNUStepValue(data []byte) bool {
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == '"' || c == '\'':
+			for i++; i < len(data) && data[i] != c; i++ {
+				if data[i] == '\\' {
+					i++
+				}
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				return false
+			}
+			i += end + 3
+		case isUnquotedChar(c):
+			// an unquoted string such as a/b//c may hold slashes
+			for i+1 < len(data) && isUnquotedChar(data[i+1]) {
+				i++
+			}
+		case c == '<' && i+1 < len(data) && data[i+1] == '*':
+			return true
+		}
+	}
+	return false
+}
+
+// trimInput removes a UTF-8 byte order mark and leading whitespace from text formats
+func trimInput(data []byte, format Format) []byte {
+	if format == BinaryFormat {
+		return data
+	}
+	return bytes.TrimLeft(bytes.TrimPrefix(data, utf8BOM), " \t\r\n")
+}
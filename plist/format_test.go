@@ -0,0 +1,139 @@
+package plist
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const xmlDoc = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0"><dict><key>name</key><string>widuu</string></dict></plist>`
+
+func TestDetectFormat(t *testing.T) {
+	bom := string(utf8BOM)
+	tests := []struct {
+		in   string
+		want Format
+	}{
+		{"", InvalidFormat},
+		{" \n\t", InvalidFormat},
+		{bom, InvalidFormat},
+		{"b", OpenStepFormat},
+		{"bplist", OpenStepFormat},
+		{"bplist00", BinaryFormat},
+		{xmlDoc, XMLFormat},
+		{bom + "\n  " + xmlDoc, XMLFormat},
+		{"<plist version=\"1.0\"><true/></plist>", XMLFormat},
+		{"<!-- comment --><plist/>", XMLFormat},
+		{`{"name": "widuu"}`, JSONFormat},
+		{bom + ` [1, 2]`, JSONFormat},
+		{`{ "name" = widuu; }`, OpenStepFormat},
+		{`{name = widuu;}`, OpenStepFormat},
+		{`{}`, OpenStepFormat},
+		{`(a, b)`, OpenStepFormat},
+		{`<0fbd>`, OpenStepFormat},
+		{`"key" = "value";`, OpenStepFormat},
+		{`{i = <*I1>;}`, GNUStepFormat},
+		{`(a, "b", <*BY>)`, GNUStepFormat},
+		// <* is only a typed value outside strings and comments
+		{`{s = "<*I1>";}`, OpenStepFormat},
+		{`{s = 'a \' <*I1>';}`, OpenStepFormat},
+		{"{s = a; // <*I1>\n}", OpenStepFormat},
+		{`{s = a; /* <*I1> */}`, OpenStepFormat},
+		{"{url = http://a; i = <*I1>;}", GNUStepFormat},
+	}
+	for _, tt := range tests {
+		if got := DetectFormat([]byte(tt.in)); got != tt.want {
+			t.Errorf("DetectFormat(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+		got, r, err := DetectReaderFormat(strings.NewReader(tt.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("DetectReaderFormat(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+		if rest, _ := ioutil.ReadAll(r); string(rest) != tt.in {
+			t.Errorf("DetectReaderFormat(%q) reader returned %q", tt.in, rest)
+		}
+	}
+}
+
+func TestUnmarshalShortInput(t *testing.T) {
+	// must not panic, short words are valid OpenStep strings
+	for _, in := range []string{"b", "bp", "bplist"} {
+		var v interface{}
+		Unmarshal([]byte(in), &v)
+	}
+	for _, in := range []string{"", " ", "\n", "bplist0", "bplist00", "<", "{", string(utf8BOM)} {
+		var v interface{}
+		if err := Unmarshal([]byte(in), &v); err == nil {
+			t.Errorf("Unmarshal(%q) succeeded", in)
+		}
+	}
+	var v interface{}
+	if err := Unmarshal(nil, &v); err != ErrEmptyInput {
+		t.Errorf("Unmarshal(nil) error = %v, want ErrEmptyInput", err)
+	}
+}
+
+func TestUnmarshalBOM(t *testing.T) {
+	var out map[string]string
+	if err := Unmarshal([]byte(string(utf8BOM)+"\n"+xmlDoc), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out["name"] != "widuu" {
+		t.Errorf("got %v", out)
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	var out map[string]interface{}
+	if err := Unmarshal([]byte(`{"name": "widuu", "count": 3, "neg": -1, "ratio": 1.5, "ok": true, "list": ["a"]}`), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"name":  "widuu",
+		"count": uint64(3),
+		"neg":   int64(-1),
+		"ratio": 1.5,
+		"ok":    true,
+		"list":  []interface{}{"a"},
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("got %#v\nwant %#v", out, want)
+	}
+}
+
+func TestAutoDecoder(t *testing.T) {
+	binary, err := MarshalFormat(map[string]string{"name": "widuu"}, BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs := map[string][]byte{
+		"xml":      []byte(xmlDoc),
+		"binary":   binary,
+		"openstep": []byte(`{name = widuu;}`),
+		"json":     []byte(`{"name": "widuu"}`),
+	}
+	for name, in := range inputs {
+		var out map[string]string
+		// hide the io.ReadSeeker of bytes.Reader
+		r := ioutil.NopCloser(bytes.NewReader(in))
+		if err := NewAutoDecoder(r).Decode(&out); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if out["name"] != "widuu" {
+			t.Errorf("%s: got %v", name, out)
+		}
+	}
+
+	var out interface{}
+	if err := NewAutoDecoder(strings.NewReader("  ")).Decode(&out); err != ErrEmptyInput {
+		t.Errorf("empty input error = %v, want ErrEmptyInput", err)
+	}
+}
@@ -0,0 +1,144 @@
+package plist
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// jsonParser parses JSON property lists, as written by plutil -convert json
+type jsonParser struct {
+	*json.Decoder
+	limits *limiter
+}
+
+func newJSONParser(r io.Reader) *jsonParser {
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	return &jsonParser{Decoder: d}
+}
+
+func (p *jsonParser) parseDocument() (*plistValue, error) {
+	val, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.Token(); err != io.EOF {
+		return nil, fmt.Errorf("plist: unexpected data after the json root value")
+	}
+	return val, nil
+}
+
+func (p *jsonParser) parseValue() (*plistValue, error) {
+	tok, err := p.Token()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.limits.object(); err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			return p.parseObject()
+		case '[':
+			return p.parseArray()
+		}
+		return nil, fmt.Errorf("plist: unexpected json delimiter %v", t)
+	}
+	return p.parseScalar(tok)
+}
+
+// parseScalar converts a json token that is not a delimiter
+func (p *jsonParser) parseScalar(tok json.Token) (*plistValue, error) {
+	switch t := tok.(type) {
+	case string:
+		if err := p.limits.stringSize(uint64(len(t))); err != nil {
+			return nil, err
+		}
+		return &plistValue{String, t}, nil
+	case bool:
+		return &plistValue{Boolean, t}, nil
+	case json.Number:
+		return parseJSONNumber(t)
+	case nil:
+		return nil, fmt.Errorf("plist: json null has no plist equivalent")
+	}
+	return nil, fmt.Errorf("plist: unexpected json token %v", tok)
+}
+
+func (p *jsonParser) parseObject() (*plistValue, error) {
+	if err := p.limits.enter(); err != nil {
+		return nil, err
+	}
+	defer p.limits.leave()
+	dict := &dictionary{m: map[string]*plistValue{}}
+	for p.More() {
+		tok, err := p.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("plist: json object key is not a string: %v", tok)
+		}
+		if err := p.limits.object(); err != nil {
+			return nil, err
+		}
+		if err := p.limits.stringSize(uint64(len(key))); err != nil {
+			return nil, err
+		}
+		val, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		dict.set(key, val)
+	}
+	// closing brace
+	if _, err := p.Token(); err != nil {
+		return nil, err
+	}
+	return &plistValue{Dictionary, dict}, nil
+}
+
+func (p *jsonParser) parseArray() (*plistValue, error) {
+	if err := p.limits.enter(); err != nil {
+		return nil, err
+	}
+	defer p.limits.leave()
+	values := []*plistValue{}
+	for p.More() {
+		val, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, val)
+	}
+	// closing bracket
+	if _, err := p.Token(); err != nil {
+		return nil, err
+	}
+	return &plistValue{Array, values}, nil
+}
+
+// parseJSONNumber returns integers without a fraction or exponent as Integer, and others as Real
+func parseJSONNumber(n json.Number) (*plistValue, error) {
+	s := n.String()
+	if !strings.ContainsAny(s, ".eE") {
+		if strings.HasPrefix(s, "-") {
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return &plistValue{Integer, signedInt{uint64(i), true}}, nil
+			}
+		} else if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return &plistValue{Integer, signedInt{u, false}}, nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("plist: invalid json number %s", s)
+	}
+	return &plistValue{Real, sizedFloat{f, 64}}, nil
+}
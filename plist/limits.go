@@ -0,0 +1,158 @@
+package plist
+
+import (
+	"fmt"
+	"io"
+)
+
+// Limits bounds the resources used to decode a document, to protect against
+// untrusted input. A zero field means no limit.
+type Limits struct {
+	MaxDepth      int   // nesting of dictionaries and arrays, the root container is depth 1
+	MaxObjects    int   // values and dictionary keys, counting every reference to a shared binary object
+	MaxStringSize int   // bytes of a string or dictionary key, two per UTF-16 unit in binary plists
+	MaxDataSize   int   // bytes of a data value
+	MaxBytes      int64 // bytes of input
+}
+
+// DefaultLimits are the limits Unmarshal, new Decoders and TokenReaders
+// decode with. They are far above real documents, but stop a crafted binary
+// plist that references shared objects over and over, or nests them deeply,
+// before it exhausts memory or the stack. SetLimits(Limits{}) removes them.
+var DefaultLimits = Limits{MaxDepth: 512, MaxObjects: 1 << 24}
+
+// LimitError is returned when a document exceeds one of its Limits.
+type LimitError struct {
+	Limit string // name of the Limits field
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("plist: document exceeds %s of %d", e.Limit, e.Max)
+}
+
+// SetLimits sets the limits for the documents the decoder reads, replacing
+// DefaultLimits. Limits{} decodes without limits.
+func (d *Decoder) SetLimits(limits Limits) {
+	d.limits = limits
+}
+
+// limiter tracks a document against its limits, a nil limiter allows everything
+type limiter struct {
+	Limits
+	depth   int
+	objects int
+}
+
+func newLimiter(limits Limits) *limiter {
+	if limits == (Limits{}) {
+		return nil
+	}
+	return &limiter{Limits: limits}
+}
+
+// object counts a value of the document
+func (l *limiter) object() error {
+	if l == nil {
+		return nil
+	}
+	l.objects++
+	if l.MaxObjects > 0 && l.objects > l.MaxObjects {
+		return &LimitError{"MaxObjects", int64(l.MaxObjects)}
+	}
+	return nil
+}
+
+// count checks the number of elements of a container before they are read
+func (l *limiter) count(n uint64) error {
+	if l == nil || l.MaxObjects <= 0 {
+		return nil
+	}
+	if n > uint64(l.MaxObjects-l.objects) {
+		return &LimitError{"MaxObjects", int64(l.MaxObjects)}
+	}
+	return nil
+}
+
+// enter starts a container, leave must be called when it ends
+func (l *limiter) enter() error {
+	if l == nil {
+		return nil
+	}
+	l.depth++
+	if l.MaxDepth > 0 && l.depth > l.MaxDepth {
+		return &LimitError{"MaxDepth", int64(l.MaxDepth)}
+	}
+	return nil
+}
+
+func (l *limiter) leave() {
+	if l != nil {
+		l.depth--
+	}
+}
+
+func (l *limiter) stringSize(n uint64) error {
+	if l == nil || l.MaxStringSize <= 0 || n <= uint64(l.MaxStringSize) {
+		return nil
+	}
+	return &LimitError{"MaxStringSize", int64(l.MaxStringSize)}
+}
+
+func (l *limiter) dataSize(n uint64) error {
+	if l == nil || l.MaxDataSize <= 0 || n <= uint64(l.MaxDataSize) {
+		return nil
+	}
+	return &LimitError{"MaxDataSize", int64(l.MaxDataSize)}
+}
+
+// reader returns r limited to MaxBytes
+func (l *limiter) reader(r io.Reader) io.Reader {
+	if l == nil || l.MaxBytes <= 0 {
+		return r
+	}
+	return &limitReader{r, l.MaxBytes, l.MaxBytes}
+}
+
+// seeker checks the size of a seekable input against MaxBytes, binary
+// plists are read with absolute offsets so the whole input counts
+func (l *limiter) seeker(r io.ReadSeeker) error {
+	if l == nil || l.MaxBytes <= 0 {
+		return nil
+	}
+	cur, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Seek(cur, io.SeekStart); err != nil {
+		return err
+	}
+	if end > l.MaxBytes {
+		return &LimitError{"MaxBytes", l.MaxBytes}
+	}
+	return nil
+}
+
+// limitReader fails with a LimitError after n bytes, instead of the silent
+// EOF of io.LimitReader
+type limitReader struct {
+	r   io.Reader
+	n   int64 // bytes left
+	max int64
+}
+
+func (l *limitReader) Read(b []byte) (int, error) {
+	if int64(len(b)) > l.n+1 {
+		b = b[:l.n+1]
+	}
+	n, err := l.r.Read(b)
+	if int64(n) > l.n {
+		return int(l.n), &LimitError{"MaxBytes", l.max}
+	}
+	l.n -= int64(n)
+	return n, err
+}
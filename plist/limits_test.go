@@ -0,0 +1,180 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDecoderLimits(t *testing.T) {
+	doc := map[string]interface{}{
+		"name":  strings.Repeat("n", 100),
+		"icon":  make([]byte, 100),
+		"items": []interface{}{[]interface{}{[]interface{}{1, 2, 3}}},
+	}
+	tests := []struct {
+		limits Limits
+		limit  string
+	}{
+		{Limits{}, ""},
+		{Limits{MaxDepth: 4, MaxObjects: 20, MaxStringSize: 100, MaxDataSize: 100, MaxBytes: 1 << 20}, ""},
+		{Limits{MaxDepth: 3}, "MaxDepth"},
+		{Limits{MaxObjects: 10}, "MaxObjects"},
+		{Limits{MaxStringSize: 99}, "MaxStringSize"},
+		{Limits{MaxDataSize: 99}, "MaxDataSize"},
+		{Limits{MaxBytes: 100}, "MaxBytes"},
+	}
+	for _, format := range []Format{XMLFormat, BinaryFormat, OpenStepFormat, GNUStepFormat} {
+		data, err := MarshalFormat(doc, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range tests {
+			d := NewAutoDecoder(bytes.NewReader(data))
+			d.SetLimits(tt.limits)
+			var v interface{}
+			err := d.Decode(&v)
+			checkLimitError(t, format.String()+" decode", err, tt.limit)
+
+			tr := NewTokenReader(bytes.NewReader(data))
+			tr.SetLimits(tt.limits)
+			for err = nil; err == nil; _, err = tr.Token() {
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			checkLimitError(t, format.String()+" tokens", err, tt.limit)
+		}
+	}
+}
+
+func checkLimitError(t *testing.T, name string, err error, limit string) {
+	t.Helper()
+	var lerr *LimitError
+	switch {
+	case limit == "" && err != nil:
+		t.Errorf("%s: unexpected error %v", name, err)
+	case limit != "" && (!errors.As(err, &lerr) || lerr.Limit != limit):
+		t.Errorf("%s: got %v, want a %s LimitError", name, err, limit)
+	}
+}
+
+func TestBinaryObjectCycle(t *testing.T) {
+	data, err := MarshalFormat([]interface{}{[]interface{}{}}, BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// point the inner array back at the root: a2 01 becomes a1 00
+	i := bytes.Index(data, []byte{0xa1, 0x01, 0xa0})
+	if i < 0 {
+		t.Fatalf("unexpected encoding % x", data)
+	}
+	data[i+1] = 0x00
+	var v interface{}
+	if err := Unmarshal(data, &v); err == nil || !strings.Contains(err.Error(), "contains itself") {
+		t.Errorf("got %v, want a cycle error", err)
+	}
+}
+
+// testBinaryArrays builds a binary plist of n nested arrays, array i holding
+// refs references to array i+1
+func testBinaryArrays(n, refs int) []byte {
+	data := []byte("bplist00")
+	var offsets []byte
+	for i := 0; i < n; i++ {
+		offsets = append(offsets, byte(len(data)>>8), byte(len(data)))
+		if i == n-1 {
+			data = append(data, 0xa0)
+			continue
+		}
+		data = append(data, 0xa0|byte(refs))
+		for j := 0; j < refs; j++ {
+			data = append(data, byte((i+1)>>8), byte(i+1))
+		}
+	}
+	table := len(data)
+	data = append(data, offsets...)
+	trailer := make([]byte, 32)
+	trailer[6], trailer[7] = 2, 2
+	binary.BigEndian.PutUint64(trailer[8:], uint64(n))
+	binary.BigEndian.PutUint64(trailer[24:], uint64(table))
+	return append(data, trailer...)
+}
+
+func TestUnmarshalDefaultLimits(t *testing.T) {
+	var v interface{}
+	if err := Unmarshal(testBinaryArrays(100, 1), &v); err != nil {
+		t.Fatal(err)
+	}
+	deep := testBinaryArrays(DefaultLimits.MaxDepth+10, 1)
+	checkLimitError(t, "deep", Unmarshal(deep, &v), "MaxDepth")
+
+	// decoders and token readers start with the default limits
+	checkLimitError(t, "binary decoder", NewBinaryDecoder(bytes.NewReader(deep)).Decode(&v), "MaxDepth")
+	checkLimitError(t, "auto decoder", NewAutoDecoder(bytes.NewReader(deep)).Decode(&v), "MaxDepth")
+	tr := NewTokenReader(bytes.NewReader(deep))
+	var err error
+	for err == nil {
+		_, err = tr.Token()
+	}
+	checkLimitError(t, "token reader", err, "MaxDepth")
+
+	// Limits{} removes them
+	d := NewBinaryDecoder(bytes.NewReader(deep))
+	d.SetLimits(Limits{})
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	tr = NewTokenReader(bytes.NewReader(deep))
+	tr.SetLimits(Limits{})
+	for err = nil; err == nil; _, err = tr.Token() {
+	}
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+
+	defer func(limits Limits) { DefaultLimits = limits }(DefaultLimits)
+	DefaultLimits = Limits{MaxObjects: 1000}
+	// 2^30 references to shared arrays
+	checkLimitError(t, "shared", Unmarshal(testBinaryArrays(30, 2), &v), "MaxObjects")
+	// a decoder without limits reads the same document as far as it is asked to
+	d = NewBinaryDecoder(bytes.NewReader(testBinaryArrays(12, 2)))
+	d.SetLimits(Limits{})
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBinaryTrailerBounds(t *testing.T) {
+	valid, err := MarshalFormat(map[string]interface{}{"icon": make([]byte, 300)}, BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trailer := len(valid) - 32
+	tests := []struct {
+		name   string
+		change func(data []byte)
+	}{
+		{"objects", func(data []byte) { binary.BigEndian.PutUint64(data[trailer+8:], 1<<40) }},
+		{"objects past the table", func(data []byte) { data[trailer+15]++ }},
+		{"table offset", func(data []byte) { binary.BigEndian.PutUint64(data[trailer+24:], uint64(len(data))) }},
+		{"offset int size", func(data []byte) { data[trailer+6] = 0 }},
+		{"object ref size", func(data []byte) { data[trailer+7] = 9 }},
+		{"data size", func(data []byte) {
+			i := bytes.Index(data, []byte{0x4f, 0x11, 0x01, 0x2c})
+			data[i+2], data[i+3] = 0xff, 0xff
+		}},
+	}
+	for _, tt := range tests {
+		data := append([]byte(nil), valid...)
+		tt.change(data)
+		// no limits are set, the input size alone bounds the document
+		var v interface{}
+		if err := NewBinaryDecoder(bytes.NewReader(data)).Decode(&v); err == nil {
+			t.Errorf("%s: decoded a corrupt trailer", tt.name)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// gnustepDateFormat is the layout of GNUstep <*D...> dates
+const gnustepDateFormat = "2006-01-02 15:04:05 -0700"
+
+// openStepParser parses old-style ASCII plists, with the GNUstep <*I>, <*R>,
+// <*B> and <*D> typed value extensions
+type openStepParser struct {
+	data   []byte
+	pos    int
+	line   int
+	limits *limiter
+}
+
+func newOpenStepParser(data []byte) *openStepParser {
+	return &openStepParser{data: data, line: 1}
+}
+
+// OpenStepSyntaxError reports the line of malformed OpenStep input. Err is
+// an IntegerOverflowError or InvalidDateError for bad GNUstep typed values.
+type OpenStepSyntaxError struct {
+	Msg  string
+	Line int
+	Err  error
+}
+
+func (e *OpenStepSyntaxError) Error() string {
+	return fmt.Sprintf("plist: openstep syntax error on line %d: %s", e.Line, e.Msg)
+}
+
+func (e *OpenStepSyntaxError) Unwrap() error {
+	return e.Err
+}
+
+func (p *openStepParser) errorf(format string, args ...interface{}) error {
+	return &OpenStepSyntaxError{Msg: fmt.Sprintf(format, args...), Line: p.line}
+}
+
+// wrapError returns err as an OpenStepSyntaxError on the current line
+func (p *openStepParser) wrapError(err error) error {
+	return &OpenStepSyntaxError{Msg: strings.TrimPrefix(err.Error(), "plist: "), Line: p.line, Err: err}
+}
+
+func (p *openStepParser) parseDocument() (*plistValue, error) {
+	if err := p.skipSpace(); err != nil {
+		return nil, err
+	}
+	if p.pos == len(p.data) {
+		// an empty strings file
+		return &plistValue{Dictionary, &dictionary{m: map[string]*plistValue{}}}, nil
+	}
+	val, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.skipSpace(); err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == '=' && val.kind == String {
+		// .strings files are dictionaries without braces
+		p.pos++
+		return p.parseDictionaryBody(val.value.(string), 0)
+	}
+	if p.pos != len(p.data) {
+		return nil, p.errorf("unexpected %q after the root value", p.data[p.pos])
+	}
+	return val, nil
+}
+
+func (p *openStepParser) parseValue() (*plistValue, error) {
+	if err := p.skipSpace(); err != nil {
+		return nil, err
+	}
+	if p.pos == len(p.data) {
+		return nil, p.errorf("unexpected end of input")
+	}
+	if err := p.limits.object(); err != nil {
+		return nil, p.wrapError(err)
+	}
+	switch c := p.data[p.pos]; c {
+	case '{':
+		p.pos++
+		return p.parseDictionaryBody("", '}')
+	case '(':
+		p.pos++
+		return p.parseArray()
+	case '<':
+		p.pos++
+		if p.pos < len(p.data) && p.data[p.pos] == '*' {
+			p.pos++
+			return p.parseGNUStepValue()
+		}
+		return p.parseData()
+	case '"', '\'':
+		p.pos++
+		s, err := p.parseQuotedString(c)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.limits.stringSize(uint64(len(s))); err != nil {
+			return nil, p.wrapError(err)
+		}
+		return &plistValue{String, s}, nil
+	default:
+		if !isUnquotedChar(c) {
+			return nil, p.errorf("unexpected %q", c)
+		}
+		start := p.pos
+		for p.pos < len(p.data) && isUnquotedChar(p.data[p.pos]) {
+			p.pos++
+		}
+		if err := p.limits.stringSize(uint64(p.pos - start)); err != nil {
+			return nil, p.wrapError(err)
+		}
+		return &plistValue{String, string(p.data[start:p.pos])}, nil
+	}
+}
+
+// parseDictionaryBody parses key = value; pairs until end, a zero end parses until the end of input.
+// A non-empty firstKey has already been read along with its '='.
+func (p *openStepParser) parseDictionaryBody(firstKey string, end byte) (*plistValue, error) {
+	if err := p.limits.enter(); err != nil {
+		return nil, p.wrapError(err)
+	}
+	defer p.limits.leave()
+	dict := &dictionary{m: map[string]*plistValue{}}
+	key := firstKey
+	for {
+		if key == "" {
+			if err := p.skipSpace(); err != nil {
+				return nil, err
+			}
+			if p.pos == len(p.data) {
+				if end == 0 {
+					return &plistValue{Dictionary, dict}, nil
+				}
+				return nil, p.errorf("unterminated dictionary")
+			}
+			if p.data[p.pos] == end {
+				p.pos++
+				return &plistValue{Dictionary, dict}, nil
+			}
+			k, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			if k.kind != String {
+				return nil, p.errorf("dictionary key is not a string")
+			}
+			key = k.value.(string)
+			if err := p.expect('='); err != nil {
+				return nil, err
+			}
+		}
+		val, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(';'); err != nil {
+			return nil, err
+		}
+		dict.set(key, val)
+		key = ""
+	}
+}
+
+func (p *openStepParser) parseArray() (*plistValue, error) {
+	if err := p.limits.enter(); err != nil {
+		return nil, p.wrapError(err)
+	}
+	defer p.limits.leave()
+	var values []*plistValue
+	for {
+		if err := p.skipSpace(); err != nil {
+			return nil, err
+		}
+		if p.pos == len(p.data) {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.data[p.pos] == ')' {
+			p.pos++
+			return &plistValue{Array, values}, nil
+		}
+		val, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, val)
+		if err := p.skipSpace(); err != nil {
+			return nil, err
+		}
+		if p.pos < len(p.data) && p.data[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		if p.pos < len(p.data) && p.data[p.pos] == ')' {
+			continue
+		}
+		return nil, p.errorf("expected ',' or ')' in array")
+	}
+}
+
+func (p *openStepParser) parseData() (*plistValue, error) {
+	var digits []byte
+	for p.pos < len(p.data) && p.data[p.pos] != '>' {
+		c := p.data[p.pos]
+		p.pos++
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+		case c == '\n':
+			p.line++
+		case strings.IndexByte("0123456789abcdefABCDEF", c) >= 0:
+			digits = append(digits, c)
+		default:
+			return nil, p.errorf("invalid character %q in data", c)
+		}
+	}
+	if p.pos == len(p.data) {
+		return nil, p.errorf("unterminated data")
+	}
+	p.pos++
+	if len(digits)%2 != 0 {
+		return nil, p.errorf("odd number of hex digits in data")
+	}
+	if err := p.limits.dataSize(uint64(len(digits) / 2)); err != nil {
+		return nil, p.wrapError(err)
+	}
+	data := make([]byte, len(digits)/2)
+	if _, err := hex.Decode(data, digits); err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	return &plistValue{Data, data}, nil
+}
+
+func (p *openStepParser) parseGNUStepValue() (*plistValue, error) {
+	if p.pos == len(p.data) {
+		return nil, p.errorf("unterminated typed value")
+	}
+	typ := p.data[p.pos]
+	p.pos++
+	end := bytes.IndexByte(p.data[p.pos:], '>')
+	if end < 0 {
+		return nil, p.errorf("unterminated typed value")
+	}
+	s := string(p.data[p.pos : p.pos+end])
+	p.pos += end + 1
+	switch typ {
+	case 'I':
+		if strings.HasPrefix(s, "-") {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return nil, p.integerError(s, err)
+			}
+			return &plistValue{Integer, signedInt{uint64(n), true}}, nil
+		}
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, p.integerError(s, err)
+		}
+		return &plistValue{Integer, signedInt{n, false}}, nil
+	case 'R':
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, p.errorf("invalid real %q", s)
+		}
+		return &plistValue{Real, sizedFloat{f, 64}}, nil
+	case 'B':
+		switch s {
+		case "Y":
+			return &plistValue{Boolean, true}, nil
+		case "N":
+			return &plistValue{Boolean, false}, nil
+		}
+		return nil, p.errorf("invalid boolean %q", s)
+	case 'D':
+		t, err := time.Parse(gnustepDateFormat, s)
+		if err != nil {
+			return nil, p.wrapError(&InvalidDateError{s, err})
+		}
+		return &plistValue{Date, t.In(time.UTC)}, nil
+	}
+	return nil, p.errorf("unknown typed value <*%c", typ)
+}
+
+func (p *openStepParser) integerError(s string, err error) error {
+	if overflow, ok := integerError(s, err).(*IntegerOverflowError); ok {
+		return p.wrapError(overflow)
+	}
+	return p.errorf("invalid integer %q", s)
+}
+
+func (p *openStepParser) parseQuotedString(quote byte) (string, error) {
+	var b strings.Builder
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case quote:
+			return b.String(), nil
+		case '\n':
+			p.line++
+			b.WriteByte(c)
+		case '\\':
+			if err := p.parseEscape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *openStepParser) parseEscape(b *strings.Builder) error {
+	if p.pos == len(p.data) {
+		return p.errorf("unterminated string")
+	}
+	c := p.data[p.pos]
+	p.pos++
+	switch c {
+	case 'a':
+		b.WriteByte('\a')
+	case 'b':
+		b.WriteByte('\b')
+	case 'f':
+		b.WriteByte('\f')
+	case 'n':
+		b.WriteByte('\n')
+	case 'r':
+		b.WriteByte('\r')
+	case 't':
+		b.WriteByte('\t')
+	case 'v':
+		b.WriteByte('\v')
+	case 'U', 'u':
+		if p.pos+4 > len(p.data) {
+			return p.errorf("short unicode escape")
+		}
+		n, err := strconv.ParseUint(string(p.data[p.pos:p.pos+4]), 16, 16)
+		if err != nil {
+			return p.errorf("invalid unicode escape %q", p.data[p.pos:p.pos+4])
+		}
+		p.pos += 4
+		r := rune(n)
+		if utf16.IsSurrogate(r) && p.pos+6 <= len(p.data) && p.data[p.pos] == '\\' && (p.data[p.pos+1] == 'U' || p.data[p.pos+1] == 'u') {
+			if low, err := strconv.ParseUint(string(p.data[p.pos+2:p.pos+6]), 16, 16); err == nil {
+				r = utf16.DecodeRune(r, rune(low))
+				p.pos += 6
+			}
+		}
+		b.WriteRune(r)
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		n := int(c - '0')
+		for i := 0; i < 2 && p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '7'; i++ {
+			n = n*8 + int(p.data[p.pos]-'0')
+			p.pos++
+		}
+		if n > 0377 {
+			return p.errorf("octal escape \\%o out of range", n)
+		}
+		b.WriteByte(byte(n))
+	case '\n':
+		p.line++
+		b.WriteByte(c)
+	default:
+		b.WriteByte(c)
+	}
+	return nil
+}
+
+func (p *openStepParser) expect(c byte) error {
+	if err := p.skipSpace(); err != nil {
+		return err
+	}
+	if p.pos == len(p.data) {
+		return p.errorf("expected %q, got end of input", c)
+	}
+	if p.data[p.pos] != c {
+		return p.errorf("expected %q, got %q", c, p.data[p.pos])
+	}
+	p.pos++
+	return nil
+}
+
+// skipSpace skips whitespace and // and /* */ comments
+func (p *openStepParser) skipSpace() error {
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			p.pos++
+		case c == '/' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '/':
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == '/' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '*':
+			end := bytes.Index(p.data[p.pos+2:], []byte("*/"))
+			if end < 0 {
+				return p.errorf("unterminated comment")
+			}
+			p.line += bytes.Count(p.data[p.pos:p.pos+2+end], []byte("\n"))
+			p.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// isUnquotedChar reports whether c may appear in an unquoted string
+func isUnquotedChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		strings.IndexByte("_$+/:.-", c) >= 0
+}
@@ -0,0 +1,161 @@
+package plist
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const openStepDoc = `// !$*UTF8*$!
+{
+	archiveVersion = 1;
+	/* a block
+	   comment */
+	classes = {
+	};
+	name = "Hello \"World\"\n";
+	path = Sources/App.swift;
+	data = <0fbd 7769
+		6475>;
+	list = (
+		one,
+		"two words",
+		'single',
+	);
+	unicode = "caf\U00e9";
+	octal = "\101\102";
+}
+`
+
+func TestOpenStepParse(t *testing.T) {
+	var out map[string]interface{}
+	if err := Unmarshal([]byte(openStepDoc), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"archiveVersion": "1",
+		"classes":        map[string]interface{}{},
+		"name":           "Hello \"World\"\n",
+		"path":           "Sources/App.swift",
+		"data":           []byte{0x0f, 0xbd, 0x77, 0x69, 0x64, 0x75},
+		"list":           []interface{}{"one", "two words", "single"},
+		"unicode":        "café",
+		"octal":          "AB",
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("got %#v\nwant %#v", out, want)
+	}
+}
+
+func TestOpenStepStrings(t *testing.T) {
+	var out map[string]string
+	doc := "/* Localizable.strings */\n\"greeting\" = \"Hello\";\nfarewell = Bye;\n"
+	if err := Unmarshal([]byte(doc), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out["greeting"] != "Hello" || out["farewell"] != "Bye" || len(out) != 2 {
+		t.Errorf("got %v", out)
+	}
+}
+
+func TestGNUStepTypes(t *testing.T) {
+	var out map[string]interface{}
+	doc := `{i = <*I-12>; r = <*R1.5>; y = <*BY>; n = <*BN>; d = <*D2020-05-01 12:30:00 +0000>;}`
+	if err := Unmarshal([]byte(doc), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"i": int64(-12),
+		"r": 1.5,
+		"y": true,
+		"n": false,
+		"d": time.Date(2020, 5, 1, 12, 30, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("got %#v\nwant %#v", out, want)
+	}
+}
+
+func TestOpenStepSyntaxError(t *testing.T) {
+	for _, doc := range []string{"{a = b", "{a = b;\n c = (d e);}", "(a, b", `"abc`, "{a = <0g>;}", "/* x", `"\777"`, "<*I12"} {
+		var out interface{}
+		err := Unmarshal([]byte(doc), &out)
+		if _, ok := err.(*OpenStepSyntaxError); !ok {
+			t.Errorf("Unmarshal(%q) error = %v, want OpenStepSyntaxError", doc, err)
+		}
+	}
+}
+
+func TestOpenStepOctalEscape(t *testing.T) {
+	var out string
+	if err := Unmarshal([]byte(`"\101\0\377\1x"`), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != "A\x00\xff\x01x" {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestOpenStepLargeDocument(t *testing.T) {
+	// comments and typed values are scanned without copying the rest of the input
+	var b strings.Builder
+	b.WriteString("(")
+	for i := 0; i < 50000; i++ {
+		b.WriteString("/* item */ <*I1>,\n")
+	}
+	b.WriteString(")")
+	var out []int
+	if err := Unmarshal([]byte(b.String()), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 50000 {
+		t.Errorf("got %d items", len(out))
+	}
+}
+
+func TestOpenStepRoundTrip(t *testing.T) {
+	in := map[string]interface{}{
+		"name":  "Hello \"World\"\n",
+		"path":  "Sources/App.swift",
+		"empty": "",
+		"slash": "//not a comment",
+		"data":  []byte{1, 2, 3},
+		"list":  []interface{}{"a", "b c"},
+		"dict":  map[string]interface{}{"k": "v"},
+	}
+	for _, indent := range []string{"", "\t"} {
+		var buf bytes.Buffer
+		enc := NewOpenStepEncoder(&buf)
+		enc.Indent(indent)
+		if err := enc.Encode(in); err != nil {
+			t.Fatal(err)
+		}
+		var out map[string]interface{}
+		if err := Unmarshal(buf.Bytes(), &out); err != nil {
+			t.Fatalf("%v\n%s", err, buf.Bytes())
+		}
+		if !reflect.DeepEqual(in, out) {
+			t.Errorf("round trip mismatch\n got %#v\nwant %#v\n%s", out, in, buf.Bytes())
+		}
+	}
+}
+
+func TestOpenStepWriter(t *testing.T) {
+	data, err := MarshalFormat(map[string]interface{}{"count": 3, "ok": true, "list": []string{"a"}}, OpenStepFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{ count = 3; list = ( a, ); ok = YES; }\n"; string(data) != want {
+		t.Errorf("got %q, want %q", data, want)
+	}
+
+	data, err = MarshalFormat(map[string]interface{}{"count": 3, "ok": true}, GNUStepFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "count = <*I3>;") || !strings.Contains(string(data), "ok = <*BY>;") {
+		t.Errorf("unexpected gnustep output %q", data)
+	}
+}
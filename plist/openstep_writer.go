@@ -0,0 +1,179 @@
+package plist
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openStepEncoder writes plistValues as an old-style ASCII plist. OpenStep
+// has no typed scalars, so integers, reals, booleans and dates are written as
+// strings unless gnustep is set, which uses the <*I>, <*R>, <*B> and <*D> forms.
+type openStepEncoder struct {
+	*bufio.Writer
+	indent  string
+	gnustep bool
+}
+
+func newOpenStepEncoder(w io.Writer, gnustep bool) *openStepEncoder {
+	return &openStepEncoder{Writer: bufio.NewWriter(w), gnustep: gnustep}
+}
+
+func (e *openStepEncoder) Indent(indent string) {
+	e.indent = indent
+}
+
+func (e *openStepEncoder) generateDocument(pval *plistValue) error {
+	if err := e.writePlistValue(pval, 0); err != nil {
+		return err
+	}
+	e.WriteString("\n")
+	return e.Flush()
+}
+
+func (e *openStepEncoder) writePlistValue(pval *plistValue, depth int) error {
+	switch pval.kind {
+	case String:
+		e.writeString(pval.value.(string))
+	case Dictionary:
+		return e.writeDictionary(pval.value.(*dictionary), depth)
+	case Array:
+		return e.writeArray(pval.value.([]*plistValue), depth)
+	case UIDKind:
+		return e.writeDictionary(uidDictionary(pval.value.(UID)).value.(*dictionary), depth)
+	case Data:
+		e.WriteString("<")
+		e.WriteString(hex.EncodeToString(pval.value.([]byte)))
+		e.WriteString(">")
+	case Integer:
+		i := pval.value.(signedInt)
+		s := strconv.FormatUint(i.value, 10)
+		if i.signed {
+			s = strconv.FormatInt(int64(i.value), 10)
+		}
+		e.writeTyped('I', s)
+	case Real:
+		f := pval.value.(sizedFloat).value
+		var s string
+		switch {
+		case math.IsInf(f, 1):
+			s = "inf"
+		case math.IsInf(f, -1):
+			s = "-inf"
+		case math.IsNaN(f):
+			s = "nan"
+		default:
+			s = strconv.FormatFloat(f, 'g', -1, pval.value.(sizedFloat).bits)
+		}
+		e.writeTyped('R', s)
+	case Boolean:
+		if e.gnustep {
+			if pval.value.(bool) {
+				e.WriteString("<*BY>")
+			} else {
+				e.WriteString("<*BN>")
+			}
+		} else if pval.value.(bool) {
+			e.WriteString("YES")
+		} else {
+			e.WriteString("NO")
+		}
+	case Date:
+		e.writeTyped('D', pval.value.(time.Time).In(time.UTC).Format(gnustepDateFormat))
+	default:
+		return fmt.Errorf("plist: cannot encode %v in an OpenStep plist", pval.kind)
+	}
+	return nil
+}
+
+func (e *openStepEncoder) writeTyped(typ byte, s string) {
+	if e.gnustep {
+		fmt.Fprintf(e, "<*%c%s>", typ, s)
+		return
+	}
+	e.writeString(s)
+}
+
+func (e *openStepEncoder) writeDictionary(dict *dictionary, depth int) error {
+	dict.populateArrays()
+	e.WriteString("{")
+	for i, k := range dict.keys {
+		e.newline(depth + 1)
+		e.writeString(k)
+		e.WriteString(" = ")
+		if err := e.writePlistValue(dict.values[i], depth+1); err != nil {
+			return err
+		}
+		e.WriteString(";")
+	}
+	if len(dict.keys) > 0 {
+		e.newline(depth)
+	}
+	e.WriteString("}")
+	return nil
+}
+
+func (e *openStepEncoder) writeArray(values []*plistValue, depth int) error {
+	e.WriteString("(")
+	for _, v := range values {
+		e.newline(depth + 1)
+		if err := e.writePlistValue(v, depth+1); err != nil {
+			return err
+		}
+		e.WriteString(",")
+	}
+	if len(values) > 0 {
+		e.newline(depth)
+	}
+	e.WriteString(")")
+	return nil
+}
+
+// newline starts a new indented line, or writes a space when not indenting
+func (e *openStepEncoder) newline(depth int) {
+	if e.indent == "" {
+		e.WriteString(" ")
+		return
+	}
+	e.WriteString("\n")
+	e.WriteString(strings.Repeat(e.indent, depth))
+}
+
+// writeString writes s unquoted when possible
+func (e *openStepEncoder) writeString(s string) {
+	unquoted := s != ""
+	for i := 0; i < len(s) && unquoted; i++ {
+		unquoted = isUnquotedChar(s[i])
+	}
+	// a leading // or /* would read back as a comment
+	if unquoted && !strings.HasPrefix(s, "//") && !strings.HasPrefix(s, "/*") {
+		e.WriteString(s)
+		return
+	}
+	e.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			e.WriteByte('\\')
+			e.WriteRune(r)
+		case '\n':
+			e.WriteString("\\n")
+		case '\t':
+			e.WriteString("\\t")
+		case '\r':
+			e.WriteString("\\r")
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(e, "\\%03o", r)
+			} else {
+				e.WriteRune(r)
+			}
+		}
+	}
+	e.WriteByte('"')
+}
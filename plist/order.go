@@ -0,0 +1,87 @@
+package plist
+
+import "reflect"
+
+// OrderedMap is a dictionary that keeps the order of its keys. Decode fills
+// an OrderedMap in source order, and Encode writes it in Keys order.
+// A Decoder with PreserveOrder decodes dictionaries into *OrderedMap when the
+// target is an empty interface.
+type OrderedMap struct {
+	Keys   []string
+	Values map[string]interface{}
+}
+
+var orderedMapType = reflect.TypeOf(OrderedMap{})
+
+// NewOrderedMap returns an empty OrderedMap.
+func NewOrderedMap() *OrderedMap {
+	return &OrderedMap{Values: map[string]interface{}{}}
+}
+
+// Len returns the number of entries.
+func (m *OrderedMap) Len() int {
+	return len(m.Keys)
+}
+
+// Get returns the value of key.
+func (m *OrderedMap) Get(key string) (interface{}, bool) {
+	v, ok := m.Values[key]
+	return v, ok
+}
+
+// Set sets the value of key, new keys are added at the end.
+func (m *OrderedMap) Set(key string, value interface{}) {
+	if m.Values == nil {
+		m.Values = map[string]interface{}{}
+	}
+	if _, ok := m.Values[key]; !ok {
+		m.Keys = append(m.Keys, key)
+	}
+	m.Values[key] = value
+}
+
+// Delete removes key.
+func (m *OrderedMap) Delete(key string) {
+	if _, ok := m.Values[key]; !ok {
+		return
+	}
+	delete(m.Values, key)
+	for i, k := range m.Keys {
+		if k == key {
+			m.Keys = append(m.Keys[:i], m.Keys[i+1:]...)
+			break
+		}
+	}
+}
+
+func (e *Encoder) marshalOrderedMap(m OrderedMap) (*plistValue, error) {
+	dict := &dictionary{m: make(map[string]*plistValue, len(m.Keys)), ordered: true}
+	for _, k := range m.Keys {
+		v, ok := m.Values[k]
+		if !ok {
+			continue
+		}
+		pval, err := e.marshal(reflect.ValueOf(v))
+		if err != nil {
+			return nil, err
+		}
+		dict.set(k, pval)
+	}
+	return &plistValue{Dictionary, dict}, nil
+}
+
+func (d *Decoder) unmarshalOrderedMap(dict *dictionary, v reflect.Value) {
+	// nested dictionaries keep their order too
+	od := *d
+	od.preserveOrder = true
+	v.Set(reflect.ValueOf(*od.orderedMapInterface(dict)))
+}
+
+func (d *Decoder) orderedMapInterface(dict *dictionary) *OrderedMap {
+	m := &OrderedMap{Values: make(map[string]interface{}, len(dict.m))}
+	for _, k := range dict.orderedKeys() {
+		m.Keys = append(m.Keys, k)
+		m.Values[k] = d.valueInterface(dict.m[k])
+	}
+	return m
+}
@@ -0,0 +1,93 @@
+package plist
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDecoderPreserveOrder(t *testing.T) {
+	d := NewDecoder(strings.NewReader(infoPlist))
+	d.PreserveOrder(true)
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	m, ok := v.(*OrderedMap)
+	if !ok {
+		t.Fatalf("decoded %T, want *OrderedMap", v)
+	}
+	if got := strings.Join(m.Keys, ","); got != "CFBundleName,CFBundleIdentifier,CFBundleURLTypes,Icon,Build" {
+		t.Errorf("keys = %s", got)
+	}
+	types := m.Values["CFBundleURLTypes"].([]interface{})
+	if _, ok := types[0].(*OrderedMap); !ok {
+		t.Errorf("nested dictionary decoded as %T", types[0])
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	if name, build := strings.Index(buf.String(), "CFBundleName"), strings.Index(buf.String(), "Build<"); name > build {
+		t.Errorf("order not kept:\n%s", buf.String())
+	}
+}
+
+func TestDecoderDefaultOrder(t *testing.T) {
+	var v interface{}
+	if err := Unmarshal([]byte(infoPlist), &v); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.(map[string]interface{}); !ok {
+		t.Errorf("decoded %T, want map", v)
+	}
+}
+
+func TestUnmarshalOrderedMap(t *testing.T) {
+	var m OrderedMap
+	if err := Unmarshal([]byte(`{ b = 1; a = { d = x; c = y; }; }`), &m); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(m.Keys, ","); got != "b,a" {
+		t.Errorf("keys = %s", got)
+	}
+	if sub := m.Values["a"].(*OrderedMap); strings.Join(sub.Keys, ",") != "d,c" {
+		t.Errorf("nested keys = %v", sub.Keys)
+	}
+	m.Set("0", "z")
+	m.Delete("b")
+	data, err := MarshalFormat(m, OpenStepFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{ a = { d = x; c = y; }; 0 = z; }\n"; string(data) != want {
+		t.Errorf("got %q, want %q", data, want)
+	}
+}
+
+func TestEncoderPreserveOrder(t *testing.T) {
+	v := struct {
+		Zeta  string
+		Alpha string
+		Mid   int
+	}{"z", "a", 1}
+
+	data, err := MarshalFormat(v, OpenStepFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{ Alpha = a; Mid = 1; Zeta = z; }\n"; string(data) != want {
+		t.Errorf("default got %q, want %q", data, want)
+	}
+
+	var buf bytes.Buffer
+	e := NewOpenStepEncoder(&buf)
+	e.PreserveOrder(true)
+	if err := e.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	if want := "{ Zeta = z; Alpha = a; Mid = 1; }\n"; buf.String() != want {
+		t.Errorf("preserved got %q, want %q", buf.String(), want)
+	}
+}
@@ -2,10 +2,11 @@ package plist
 
 import "sort"
 
-type plistKind uint
+// Kind is the type of a plist value.
+type Kind uint
 
 const (
-	Invalid plistKind = iota
+	Invalid Kind = iota
 	Dictionary
 	Array
 	String
@@ -14,9 +15,10 @@ const (
 	Boolean
 	Data
 	Date
+	UIDKind
 )
 
-var plistKindNames = map[plistKind]string{
+var kindNames = map[Kind]string{
 	Invalid:    "invalid",
 	Dictionary: "dictionary",
 	Array:      "array",
@@ -26,10 +28,46 @@ var plistKindNames = map[plistKind]string{
 	Boolean:    "boolean",
 	Data:       "data",
 	Date:       "date",
+	UIDKind:    "uid",
+}
+
+func (k Kind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+	return "invalid"
+}
+
+// Format is a plist serialization format.
+type Format int
+
+const (
+	InvalidFormat Format = iota
+	XMLFormat
+	BinaryFormat
+	OpenStepFormat
+	GNUStepFormat
+	JSONFormat
+)
+
+var formatNames = map[Format]string{
+	InvalidFormat:  "invalid",
+	XMLFormat:      "xml",
+	BinaryFormat:   "binary",
+	OpenStepFormat: "openstep",
+	GNUStepFormat:  "gnustep",
+	JSONFormat:     "json",
+}
+
+func (f Format) String() string {
+	if name, ok := formatNames[f]; ok {
+		return name
+	}
+	return "invalid"
 }
 
 type plistValue struct {
-	kind  plistKind
+	kind  Kind
 	value interface{}
 }
 
@@ -48,6 +86,20 @@ type dictionary struct {
 	m      map[string]*plistValue
 	keys   sort.StringSlice
 	values []*plistValue
+
+	order   []string // keys in source or insertion order
+	ordered bool     // populateArrays keeps order instead of sorting
+}
+
+// set stores the value and records the key order
+func (d *dictionary) set(key string, val *plistValue) {
+	if d.m == nil {
+		d.m = make(map[string]*plistValue)
+	}
+	if _, ok := d.m[key]; !ok {
+		d.order = append(d.order, key)
+	}
+	d.m[key] = val
 }
 
 func (d *dictionary) Len() int {
@@ -64,6 +116,14 @@ func (d *dictionary) Swap(i, j int) {
 }
 
 func (d *dictionary) populateArrays() {
+	if d.ordered {
+		d.keys = d.orderedKeys()
+		d.values = make([]*plistValue, len(d.keys))
+		for i, k := range d.keys {
+			d.values[i] = d.m[k]
+		}
+		return
+	}
 	d.keys = make([]string, len(d.m))
 	d.values = make([]*plistValue, len(d.m))
 	i := 0
@@ -74,3 +134,26 @@ func (d *dictionary) populateArrays() {
 	}
 	sort.Sort(d)
 }
+
+// orderedKeys returns the keys in recorded order, followed by sorted keys that were not recorded
+func (d *dictionary) orderedKeys() []string {
+	keys := make([]string, 0, len(d.m))
+	seen := make(map[string]bool, len(d.m))
+	for _, k := range d.order {
+		if _, ok := d.m[k]; ok && !seen[k] {
+			keys = append(keys, k)
+			seen[k] = true
+		}
+	}
+	if len(keys) == len(d.m) {
+		return keys
+	}
+	var rest []string
+	for k := range d.m {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
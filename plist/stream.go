@@ -0,0 +1,681 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+)
+
+// TokenKind is the type of a Token.
+type TokenKind int
+
+const (
+	StartDictionaryToken TokenKind = iota + 1
+	EndDictionaryToken
+	StartArrayToken
+	EndArrayToken
+	ValueToken
+)
+
+var tokenKindNames = map[TokenKind]string{
+	StartDictionaryToken: "start dictionary",
+	EndDictionaryToken:   "end dictionary",
+	StartArrayToken:      "start array",
+	EndArrayToken:        "end array",
+	ValueToken:           "value",
+}
+
+func (k TokenKind) String() string {
+	if name, ok := tokenKindNames[k]; ok {
+		return name
+	}
+	return "invalid"
+}
+
+// Token is an element of a plist document read by a TokenReader.
+type Token struct {
+	Kind  TokenKind
+	Key   string      // dictionary key of the value or container, empty in arrays and for the root
+	Path  string      // key path of the value or container, like CFBundleURLTypes[0]
+	Value interface{} // the value of a ValueToken, as Decode stores it in an empty interface
+}
+
+// TokenReader reads a plist document as a stream of tokens, so that huge
+// documents can be walked without building the whole value tree. XML, JSON
+// and binary documents are read incrementally; OpenStep and GNUstep
+// documents are parsed into memory first.
+//
+// A dictionary or array is returned as a start token, the tokens of its
+// entries and an end token. Decode and Skip read a whole container.
+type TokenReader struct {
+	reader io.Reader
+	limits Limits
+
+	lim      *limiter
+	src      tokenSource
+	frames   []tokenFrame
+	path     keyPath
+	last     rawToken
+	lastPath keyPath
+}
+
+// NewTokenReader returns a TokenReader that reads a document of any format from r.
+func NewTokenReader(r io.Reader) *TokenReader {
+	return &TokenReader{reader: r, limits: DefaultLimits}
+}
+
+// SetLimits sets the limits for the document, it must be called before the first Token.
+// A TokenReader starts with DefaultLimits, Limits{} removes them.
+func (t *TokenReader) SetLimits(limits Limits) {
+	t.limits = limits
+}
+
+// rawToken is a token of a tokenSource, value is set for ValueToken
+type rawToken struct {
+	kind  TokenKind
+	key   string
+	value *plistValue
+}
+
+// tokenSource produces the tokens of one format, and io.EOF after the document
+type tokenSource interface {
+	next() (rawToken, error)
+}
+
+type tokenFrame struct {
+	dict  bool
+	key   string
+	index int
+}
+
+// Token returns the next token of the document, or io.EOF at its end.
+func (t *TokenReader) Token() (Token, error) {
+	_, tok, err := t.next()
+	return tok, err
+}
+
+// Decode stores the value of the last token returned by Token in the value
+// pointed to by v, like Decoder.Decode. After a start token it reads the
+// container through its end token.
+func (t *TokenReader) Decode(v interface{}) error {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr {
+		return errors.New("plist: non-pointer passed to Decode")
+	}
+	last, path := t.last, append(keyPath(nil), t.lastPath...)
+	t.last = rawToken{}
+	var pval *plistValue
+	switch last.kind {
+	case ValueToken:
+		pval = last.value
+	case StartDictionaryToken, StartArrayToken:
+		var err error
+		if pval, err = t.readContainer(last.kind); err != nil {
+			return err
+		}
+	default:
+		return errors.New("plist: Decode must follow a start or value token")
+	}
+	d := &Decoder{path: path}
+	return d.unmarshal(pval, val.Elem())
+}
+
+// Skip reads the rest of the container started by the last token returned
+// by Token. It does nothing after other tokens.
+func (t *TokenReader) Skip() error {
+	kind := t.last.kind
+	t.last = rawToken{}
+	if kind != StartDictionaryToken && kind != StartArrayToken {
+		return nil
+	}
+	for depth := 1; depth > 0; {
+		raw, _, err := t.next()
+		if err != nil {
+			return err
+		}
+		switch raw.kind {
+		case StartDictionaryToken, StartArrayToken:
+			depth++
+		case EndDictionaryToken, EndArrayToken:
+			depth--
+		}
+	}
+	return nil
+}
+
+// readContainer builds the value of a container whose start token was read
+func (t *TokenReader) readContainer(kind TokenKind) (*plistValue, error) {
+	var dict *dictionary
+	list := []*plistValue{}
+	if kind == StartDictionaryToken {
+		dict = &dictionary{m: map[string]*plistValue{}}
+	}
+	for {
+		raw, tok, err := t.next()
+		if err != nil {
+			return nil, err
+		}
+		var val *plistValue
+		switch raw.kind {
+		case EndDictionaryToken, EndArrayToken:
+			if dict != nil {
+				return &plistValue{Dictionary, dict}, nil
+			}
+			return &plistValue{Array, list}, nil
+		case ValueToken:
+			val = raw.value
+		default:
+			if val, err = t.readContainer(raw.kind); err != nil {
+				return nil, err
+			}
+		}
+		if dict != nil {
+			dict.set(tok.Key, val)
+		} else {
+			list = append(list, val)
+		}
+	}
+}
+
+func (t *TokenReader) next() (rawToken, Token, error) {
+	if t.src == nil {
+		if err := t.init(); err != nil {
+			return rawToken{}, Token{}, err
+		}
+	}
+	raw, err := t.src.next()
+	if err == io.EOF && len(t.frames) > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return rawToken{}, Token{}, t.wrapError(err)
+	}
+	tok, err := t.token(raw)
+	if err != nil {
+		return rawToken{}, Token{}, t.wrapError(err)
+	}
+	return raw, tok, nil
+}
+
+// token tracks the container frames and key path of a raw token
+func (t *TokenReader) token(raw rawToken) (Token, error) {
+	if raw.kind == EndDictionaryToken || raw.kind == EndArrayToken {
+		if len(t.frames) == 0 {
+			return Token{}, fmt.Errorf("plist: unexpected %v", raw.kind)
+		}
+		frame := t.frames[len(t.frames)-1]
+		t.frames = t.frames[:len(t.frames)-1]
+		tok := Token{Kind: raw.kind, Key: frame.key, Path: t.path.String()}
+		if len(t.frames) > 0 {
+			t.path.pop()
+		}
+		t.lim.leave()
+		t.last = raw
+		return tok, nil
+	}
+
+	if err := t.lim.object(); err != nil {
+		return Token{}, err
+	}
+	var key string
+	if n := len(t.frames); n > 0 {
+		frame := &t.frames[n-1]
+		if frame.dict {
+			key = raw.key
+			t.path.pushKey(key)
+		} else {
+			t.path.pushIndex(frame.index)
+		}
+		frame.index++
+	}
+	tok := Token{Kind: raw.kind, Key: key, Path: t.path.String()}
+	t.last, t.lastPath = raw, append(t.lastPath[:0], t.path...)
+	if raw.kind == ValueToken {
+		tok.Value = (&Decoder{}).valueInterface(raw.value)
+		if len(t.frames) > 0 {
+			t.path.pop()
+		}
+		return tok, nil
+	}
+	if err := t.lim.enter(); err != nil {
+		return Token{}, err
+	}
+	t.frames = append(t.frames, tokenFrame{dict: raw.kind == StartDictionaryToken, key: key})
+	return tok, nil
+}
+
+// wrapError adds the key path to errors of the token sources
+func (t *TokenReader) wrapError(err error) error {
+	if err == io.EOF {
+		return err
+	}
+	if derr, ok := err.(*DecodeError); ok {
+		if derr.Path == "" {
+			derr.Path = t.path.String()
+		}
+		return derr
+	}
+	return &DecodeError{Path: t.path.String(), Err: err}
+}
+
+// init detects the format and sets up the token source
+func (t *TokenReader) init() error {
+	t.lim = newLimiter(t.limits)
+	start := inputStart(t.reader)
+	format, reader, err := DetectReaderFormat(t.reader)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case InvalidFormat:
+		return ErrEmptyInput
+	case BinaryFormat:
+		rs, ok := t.reader.(io.ReadSeeker)
+		if ok {
+			if err := t.lim.seeker(rs); err != nil {
+				return err
+			}
+		} else {
+			data, err := ioutil.ReadAll(t.lim.reader(reader))
+			if err != nil {
+				return err
+			}
+			rs = bytes.NewReader(data)
+		}
+		// the token reader counts objects and depth, the parser checks sizes
+		bp, err := newBinaryParser(rs, newLimiter(Limits{MaxStringSize: t.limits.MaxStringSize, MaxDataSize: t.limits.MaxDataSize}))
+		if err != nil {
+			return err
+		}
+		if err := t.lim.count(bp.NumObjects); err != nil {
+			return err
+		}
+		t.src = &binaryTokens{bp: bp, limits: t.lim}
+	case OpenStepFormat, GNUStepFormat:
+		root, err := (&Decoder{reader: reader, format: format, limits: t.limits}).parse()
+		if err != nil {
+			return err
+		}
+		t.src = &treeTokens{root: root}
+	case JSONFormat:
+		p := newJSONParser(skipBOM(t.lim.reader(reader)))
+		p.limits = t.lim
+		t.src = &jsonTokens{p: p}
+	default:
+		p := newXMLParser(skipBOM(t.lim.reader(reader)))
+		p.limits = t.lim
+		p.setInput(t.reader, start)
+		t.src = &xmlTokens{p: p}
+	}
+	return nil
+}
+
+// xmlTokens reads tokens from the xml.Decoder of an xmlParser. Like the XML
+// parser it reads a {CF$UID = n} dictionary as a UID, so a dictionary start
+// is returned after looking ahead at its first entry.
+type xmlTokens struct {
+	p       *xmlParser
+	key     string // the <key> of the next value in a dictionary
+	hasKey  bool
+	dicts   []bool // whether each open container is a dictionary
+	pending []xmlPending
+}
+
+// xmlPending is a token read ahead of a dictionary start
+type xmlPending struct {
+	tok rawToken
+	err error
+}
+
+func (s *xmlTokens) next() (rawToken, error) {
+	tok, err := s.take()
+	if err != nil || tok.kind != StartDictionaryToken {
+		return tok, err
+	}
+	entry, err := s.take()
+	if err != nil || entry.kind != ValueToken || entry.key != cfUIDKey || entry.value.kind != Integer {
+		s.unread(xmlPending{entry, err})
+		return tok, nil
+	}
+	end, err := s.take()
+	if err == nil && end.kind == EndDictionaryToken {
+		dict := &dictionary{m: map[string]*plistValue{}}
+		dict.set(cfUIDKey, entry.value)
+		if uid, ok := dictionaryUID(dict); ok {
+			return rawToken{kind: ValueToken, key: tok.key, value: &plistValue{UIDKind, uid}}, nil
+		}
+	}
+	s.unread(xmlPending{entry, nil}, xmlPending{end, err})
+	return tok, nil
+}
+
+// take returns the first token read ahead, or reads the next one
+func (s *xmlTokens) take() (rawToken, error) {
+	if len(s.pending) > 0 {
+		next := s.pending[0]
+		s.pending = s.pending[1:]
+		return next.tok, next.err
+	}
+	return s.read()
+}
+
+// unread puts tokens back in front of the tokens read ahead
+func (s *xmlTokens) unread(tokens ...xmlPending) {
+	s.pending = append(tokens, s.pending...)
+}
+
+// read returns the next token of the document, values and containers in a
+// dictionary take the preceding <key>
+func (s *xmlTokens) read() (rawToken, error) {
+	for {
+		offset := s.p.InputOffset()
+		tok, err := s.p.Token()
+		if err != nil {
+			if err == io.EOF {
+				return rawToken{}, err
+			}
+			return rawToken{}, s.p.errorAt(offset, err)
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			if el.Name.Local == "plist" {
+				continue
+			}
+			if el.Name.Local == "key" {
+				var k string
+				if err := s.p.DecodeElement(&k, &el); err != nil {
+					return rawToken{}, s.p.errorAt(offset, err)
+				}
+				if err := s.p.limits.object(); err != nil {
+					return rawToken{}, s.p.errorAt(offset, err)
+				}
+				if err := s.p.limits.stringSize(uint64(len(k))); err != nil {
+					return rawToken{}, s.p.errorAt(offset, err)
+				}
+				s.key, s.hasKey = k, true
+				continue
+			}
+			key, err := s.takeKey()
+			if err != nil {
+				return rawToken{}, s.p.errorAt(offset, err)
+			}
+			switch el.Name.Local {
+			case "dict":
+				s.dicts = append(s.dicts, true)
+				return rawToken{kind: StartDictionaryToken, key: key}, nil
+			case "array":
+				s.dicts = append(s.dicts, false)
+				return rawToken{kind: StartArrayToken, key: key}, nil
+			}
+			val, err := s.p.parseXMLElement(&el)
+			if err != nil {
+				return rawToken{}, s.p.errorAt(offset, err)
+			}
+			return rawToken{kind: ValueToken, key: key, value: val}, nil
+		case xml.EndElement:
+			switch el.Name.Local {
+			case "dict", "array":
+				if len(s.dicts) > 0 {
+					s.dicts = s.dicts[:len(s.dicts)-1]
+				}
+				s.hasKey = false
+				if el.Name.Local == "dict" {
+					return rawToken{kind: EndDictionaryToken}, nil
+				}
+				return rawToken{kind: EndArrayToken}, nil
+			}
+		}
+	}
+}
+
+// takeKey returns the key of a value and resets it, a value in a dictionary must have one
+func (s *xmlTokens) takeKey() (string, error) {
+	key, hasKey := s.key, s.hasKey
+	s.key, s.hasKey = "", false
+	if n := len(s.dicts); n > 0 && s.dicts[n-1] && !hasKey {
+		return "", errors.New("plist: missing key in dict")
+	}
+	return key, nil
+}
+
+// jsonTokens reads tokens from the json.Decoder of a jsonParser
+type jsonTokens struct {
+	p      *jsonParser
+	frames []jsonFrame
+}
+
+type jsonFrame struct {
+	object    bool
+	expectKey bool
+}
+
+func (s *jsonTokens) next() (rawToken, error) {
+	var key string
+	for {
+		tok, err := s.p.Token()
+		if err != nil {
+			return rawToken{}, err
+		}
+		var top *jsonFrame
+		if n := len(s.frames); n > 0 {
+			top = &s.frames[n-1]
+		}
+		if d, ok := tok.(json.Delim); ok {
+			switch d {
+			case '{', '[':
+				if top != nil && top.object {
+					top.expectKey = true
+				}
+				s.frames = append(s.frames, jsonFrame{object: d == '{', expectKey: d == '{'})
+				if d == '{' {
+					return rawToken{kind: StartDictionaryToken, key: key}, nil
+				}
+				return rawToken{kind: StartArrayToken, key: key}, nil
+			case '}':
+				s.frames = s.frames[:len(s.frames)-1]
+				return rawToken{kind: EndDictionaryToken}, nil
+			default:
+				s.frames = s.frames[:len(s.frames)-1]
+				return rawToken{kind: EndArrayToken}, nil
+			}
+		}
+		if top != nil && top.expectKey {
+			k, _ := tok.(string)
+			if err := s.p.limits.object(); err != nil {
+				return rawToken{}, err
+			}
+			if err := s.p.limits.stringSize(uint64(len(k))); err != nil {
+				return rawToken{}, err
+			}
+			key, top.expectKey = k, false
+			continue
+		}
+		val, err := s.p.parseScalar(tok)
+		if err != nil {
+			return rawToken{}, err
+		}
+		if top != nil && top.object {
+			top.expectKey = true
+		}
+		return rawToken{kind: ValueToken, key: key, value: val}, nil
+	}
+}
+
+// binaryTokens walks the object table of a binary plist from the root
+// object, reading each object when its token is needed
+type binaryTokens struct {
+	bp      *binaryParser
+	limits  *limiter
+	frames  []*binaryFrame
+	started bool
+}
+
+type binaryFrame struct {
+	ref          uint64
+	keys, values []uint64 // keys is nil for arrays
+	i            int
+}
+
+func (s *binaryTokens) next() (rawToken, error) {
+	if !s.started {
+		s.started = true
+		return s.open(s.bp.RootObject, "")
+	}
+	if len(s.frames) == 0 {
+		return rawToken{}, io.EOF
+	}
+	frame := s.frames[len(s.frames)-1]
+	if frame.i == len(frame.values) {
+		s.frames = s.frames[:len(s.frames)-1]
+		if frame.keys != nil {
+			return rawToken{kind: EndDictionaryToken}, nil
+		}
+		return rawToken{kind: EndArrayToken}, nil
+	}
+	var key string
+	if frame.keys != nil {
+		if err := s.limits.object(); err != nil {
+			return rawToken{}, err
+		}
+		k, err := s.bp.parseObjectRef(frame.keys[frame.i])
+		if err != nil {
+			return rawToken{}, err
+		}
+		if k.kind != String {
+			return rawToken{}, fmt.Errorf("plist: dictionary key is not a string: %v", k)
+		}
+		key = k.value.(string)
+	}
+	ref := frame.values[frame.i]
+	frame.i++
+	return s.open(ref, key)
+}
+
+// open returns the token of an object, containers are read without their entries
+func (s *binaryTokens) open(ref uint64, key string) (rawToken, error) {
+	if ref >= uint64(len(s.bp.OffsetTable)) {
+		return rawToken{}, fmt.Errorf("plist: offset too large: %d", ref)
+	}
+	for _, f := range s.frames {
+		if f.ref == ref {
+			return rawToken{}, fmt.Errorf("plist: object %d contains itself", ref)
+		}
+	}
+	if _, err := s.bp.Seek(int64(s.bp.OffsetTable[ref]), io.SeekStart); err != nil {
+		return rawToken{}, err
+	}
+	b := make([]byte, 1)
+	if _, err := s.bp.Read(b); err != nil {
+		return rawToken{}, err
+	}
+	marker := b[0]
+	switch marker >> 4 {
+	case 0xa, 0xd:
+		count, err := s.bp.readCount(marker)
+		if err != nil {
+			return rawToken{}, err
+		}
+		frame := &binaryFrame{ref: ref}
+		kind := StartArrayToken
+		if marker>>4 == 0xd {
+			kind = StartDictionaryToken
+			if err := s.limits.count(2 * count); err != nil {
+				return rawToken{}, err
+			}
+			if frame.keys, err = s.readRefs(count); err != nil {
+				return rawToken{}, err
+			}
+		} else if err := s.limits.count(count); err != nil {
+			return rawToken{}, err
+		}
+		if frame.values, err = s.readRefs(count); err != nil {
+			return rawToken{}, err
+		}
+		s.frames = append(s.frames, frame)
+		return rawToken{kind: kind, key: key}, nil
+	}
+	val, err := s.bp.parseObjectRef(ref)
+	if err != nil {
+		return rawToken{}, err
+	}
+	return rawToken{kind: ValueToken, key: key, value: val}, nil
+}
+
+func (s *binaryTokens) readRefs(count uint64) ([]uint64, error) {
+	if err := s.bp.fits(count, uint64(s.bp.ObjectRefSize)); err != nil {
+		return nil, err
+	}
+	refs := make([]uint64, count)
+	buf := make([]byte, 8)
+	for i := range refs {
+		if _, err := io.ReadFull(s.bp, buf[8-s.bp.ObjectRefSize:]); err != nil {
+			return nil, err
+		}
+		refs[i] = binary.BigEndian.Uint64(buf)
+	}
+	return refs, nil
+}
+
+// treeTokens walks a parsed value tree
+type treeTokens struct {
+	root    *plistValue
+	frames  []*treeFrame
+	started bool
+}
+
+type treeFrame struct {
+	keys   []string // nil for arrays
+	values []*plistValue
+	i      int
+}
+
+func (s *treeTokens) next() (rawToken, error) {
+	if !s.started {
+		s.started = true
+		return s.open(s.root, ""), nil
+	}
+	if len(s.frames) == 0 {
+		return rawToken{}, io.EOF
+	}
+	frame := s.frames[len(s.frames)-1]
+	if frame.i == len(frame.values) {
+		s.frames = s.frames[:len(s.frames)-1]
+		if frame.keys != nil {
+			return rawToken{kind: EndDictionaryToken}, nil
+		}
+		return rawToken{kind: EndArrayToken}, nil
+	}
+	var key string
+	if frame.keys != nil {
+		key = frame.keys[frame.i]
+	}
+	val := frame.values[frame.i]
+	frame.i++
+	return s.open(val, key), nil
+}
+
+func (s *treeTokens) open(pval *plistValue, key string) rawToken {
+	switch pval.kind {
+	case Dictionary:
+		dict := pval.value.(*dictionary)
+		frame := &treeFrame{keys: dict.orderedKeys()}
+		for _, k := range frame.keys {
+			frame.values = append(frame.values, dict.m[k])
+		}
+		if frame.keys == nil {
+			frame.keys = []string{}
+		}
+		s.frames = append(s.frames, frame)
+		return rawToken{kind: StartDictionaryToken, key: key}
+	case Array:
+		s.frames = append(s.frames, &treeFrame{values: pval.value.([]*plistValue)})
+		return rawToken{kind: StartArrayToken, key: key}
+	}
+	return rawToken{kind: ValueToken, key: key, value: pval}
+}
@@ -0,0 +1,203 @@
+package plist
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// collectTokens renders the tokens of a document, one per line
+func collectTokens(t *testing.T, r io.Reader) string {
+	t.Helper()
+	tr := NewTokenReader(r)
+	var b strings.Builder
+	for {
+		tok, err := tr.Token()
+		if err == io.EOF {
+			return b.String()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&b, "%v %s", tok.Kind, tok.Path)
+		if tok.Kind == ValueToken {
+			fmt.Fprintf(&b, " = %v", tok.Value)
+		}
+		b.WriteString("\n")
+	}
+}
+
+func TestTokenReaderFormats(t *testing.T) {
+	want := `start dictionary 
+value CFBundleName = App
+value CFBundleIdentifier = com.example.app
+start array CFBundleURLTypes
+start dictionary CFBundleURLTypes[0]
+start array CFBundleURLTypes[0].CFBundleURLSchemes
+value CFBundleURLTypes[0].CFBundleURLSchemes[0] = example
+end array CFBundleURLTypes[0].CFBundleURLSchemes
+end dictionary CFBundleURLTypes[0]
+end array CFBundleURLTypes
+value Icon = [0 1 2]
+value Build = 42
+end dictionary 
+`
+	if got := collectTokens(t, strings.NewReader(infoPlist)); got != want {
+		t.Errorf("xml tokens:\n%s\nwant:\n%s", got, want)
+	}
+
+	v, err := ParseValue([]byte(infoPlist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []Format{BinaryFormat, OpenStepFormat, GNUStepFormat} {
+		data, err := v.Marshal(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := collectTokens(t, bytes.NewReader(data)); got != want {
+			t.Errorf("%v tokens:\n%s\nwant:\n%s", format, got, want)
+		}
+	}
+
+	json := `{"CFBundleName": "App", "CFBundleIdentifier": "com.example.app",
+		"CFBundleURLTypes": [{"CFBundleURLSchemes": ["example"]}], "Build": 42}`
+	want = strings.Replace(want, "value Icon = [0 1 2]\n", "", 1)
+	if got := collectTokens(t, strings.NewReader(json)); got != want {
+		t.Errorf("json tokens:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestTokenReaderDecodeAndSkip(t *testing.T) {
+	data, err := MarshalFormat(map[string]interface{}{
+		"a": []string{"x", "y"},
+		"b": map[string]interface{}{"n": 1},
+		"c": "z",
+	}, BinaryFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := NewTokenReader(bytes.NewReader(data))
+	var b struct {
+		N int `plist:"n"`
+	}
+	var c string
+	for {
+		tok, err := tr.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch tok.Path {
+		case "a":
+			if err := tr.Skip(); err != nil {
+				t.Fatal(err)
+			}
+		case "b":
+			if err := tr.Decode(&b); err != nil {
+				t.Fatal(err)
+			}
+		case "c":
+			if err := tr.Decode(&c); err != nil {
+				t.Fatal(err)
+			}
+		case "a[0]", "a[1]", "b.n":
+			t.Errorf("token %s was not skipped", tok.Path)
+		}
+	}
+	if b.N != 1 || c != "z" {
+		t.Errorf("got b %+v, c %q", b, c)
+	}
+}
+
+func TestTokenReaderErrors(t *testing.T) {
+	tr := NewTokenReader(strings.NewReader(`{"a": [1, 2, "x"]}`))
+	var err error
+	for err == nil {
+		var tok Token
+		if tok, err = tr.Token(); err == nil && tok.Path == "a[2]" {
+			var n int
+			err = tr.Decode(&n)
+		}
+	}
+	if derr, ok := err.(*DecodeError); !ok || derr.Path != "a[2]" {
+		t.Errorf("got %v, want a DecodeError at a[2]", err)
+	}
+
+	tr = NewTokenReader(strings.NewReader(`<plist><array><string>a</string>`))
+	for err = nil; err == nil; _, err = tr.Token() {
+	}
+	if err == io.EOF {
+		t.Error("truncated document ended with io.EOF")
+	}
+}
+
+func TestTokenReaderXMLUID(t *testing.T) {
+	doc := `<plist><dict>
+	<key>obj</key><dict><key>CF$UID</key><integer>3</integer></dict>
+	<key>negative</key><dict><key>CF$UID</key><integer>-1</integer></dict>
+	<key>more</key><dict><key>CF$UID</key><integer>1</integer><key>x</key><string>y</string></dict>
+	<key>nested</key><dict><key>CF$UID</key><dict/></dict>
+</dict></plist>`
+	want := `start dictionary 
+value obj = 3
+start dictionary negative
+value negative.CF$UID = -1
+end dictionary negative
+start dictionary more
+value more.CF$UID = 1
+value more.x = y
+end dictionary more
+start dictionary nested
+start dictionary nested.CF$UID
+end dictionary nested.CF$UID
+end dictionary nested
+end dictionary 
+`
+	if got := collectTokens(t, strings.NewReader(doc)); got != want {
+		t.Errorf("tokens:\n%s\nwant:\n%s", got, want)
+	}
+
+	// the tokens agree with Decode
+	var decoded map[string]interface{}
+	if err := Unmarshal([]byte(doc), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	tr := NewTokenReader(strings.NewReader(doc))
+	tr.Token()
+	tok, err := tr.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Value != decoded["obj"] || tok.Value != UID(3) {
+		t.Errorf("token value %#v, Decode %#v", tok.Value, decoded["obj"])
+	}
+	var uid UID
+	if err := tr.Decode(&uid); err != nil || uid != 3 {
+		t.Errorf("Decode = %v, %v", uid, err)
+	}
+}
+
+func TestTokenReaderXMLMissingKey(t *testing.T) {
+	for _, doc := range []string{
+		`<plist><dict><string>x</string></dict></plist>`,
+		`<plist><dict><key>a</key><string>x</string><string>y</string></dict></plist>`,
+		`<plist><dict><key>a</key><array/><string>y</string></dict></plist>`,
+	} {
+		tr := NewTokenReader(strings.NewReader(doc))
+		var err error
+		for err == nil {
+			_, err = tr.Token()
+		}
+		if err == io.EOF || !strings.Contains(err.Error(), "missing key in dict") {
+			t.Errorf("%s: error %v, want missing key", doc, err)
+		}
+		if err := Unmarshal([]byte(doc), new(interface{})); err == nil {
+			t.Errorf("%s: Unmarshal accepted a value without a key", doc)
+		}
+	}
+}
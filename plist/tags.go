@@ -49,6 +49,9 @@ type field struct {
 	index     []int
 	typ       reflect.Type
 	omitEmpty bool
+	inline    bool // a map that holds the keys of no other field
+	asString  bool // a number or bool encoded as a string
+	required  bool // decoding fails when the key is missing
 }
 
 func (f field) value(v reflect.Value) reflect.Value {
@@ -153,6 +156,13 @@ func typeFields(t reflect.Type) []field {
 					ft = ft.Elem()
 				}
 
+				// Inline maps have no key of their own. The empty name
+				// makes two of them conflict, so that neither is used.
+				if opts.Contains("inline") && ft.Kind() == reflect.Map && ft.Key().Kind() == reflect.String {
+					fields = append(fields, field{index: index, typ: ft, inline: true})
+					continue
+				}
+
 				// Record found field and index sequence.
 				if name != "" || !sf.Anonymous || ft.Kind() != reflect.Struct {
 					tagged := name != ""
@@ -165,6 +175,8 @@ func typeFields(t reflect.Type) []field {
 						index:     index,
 						typ:       ft,
 						omitEmpty: opts.Contains("omitempty"),
+						asString:  opts.Contains("string") && isStringable(ft),
+						required:  opts.Contains("required"),
 					})
 					if count[f.typ] > 1 {
 						// If there were multiple instances, add a second,
@@ -302,3 +314,25 @@ func isValidTag(s string) bool {
 	}
 	return true
 }
+
+// isStringable reports whether the ,string option applies to a field of type t
+func isStringable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// inlineField returns the inline map field of fields
+func inlineField(fields []field) (field, bool) {
+	for _, f := range fields {
+		if f.inline {
+			return f, true
+		}
+	}
+	return field{}, false
+}
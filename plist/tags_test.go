@@ -0,0 +1,111 @@
+package plist
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type taggedProfile struct {
+	Name     string                 `plist:"name,required"`
+	Count    int                    `plist:"count,string"`
+	Enabled  *bool                  `plist:"enabled,string,omitempty"`
+	Version  float64                `plist:"version,string"`
+	Extra    map[string]interface{} `plist:",inline"`
+	internal string
+}
+
+func TestTagOptionsRoundTrip(t *testing.T) {
+	enabled := true
+	in := taggedProfile{
+		Name:    "App",
+		Count:   3,
+		Enabled: &enabled,
+		Version: 1.5,
+		Extra:   map[string]interface{}{"other": "x", "name": "ignored"},
+	}
+	data, err := MarshalFormat(in, OpenStepFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{ count = 3; enabled = true; name = App; other = x; version = 1.5; }\n"
+	if string(data) != want {
+		t.Errorf("got %q, want %q", data, want)
+	}
+
+	var raw map[string]interface{}
+	if err := Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw["count"].(string); !ok {
+		t.Errorf("count encoded as %T, want string", raw["count"])
+	}
+
+	var out taggedProfile
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Extra = map[string]interface{}{"other": "x"}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
+
+func TestStringOptionAcceptsNumbers(t *testing.T) {
+	var out taggedProfile
+	if err := Unmarshal([]byte(`{"name": "App", "count": 7}`), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Count != 7 {
+		t.Errorf("count = %d", out.Count)
+	}
+	err := Unmarshal([]byte(`{"name": "App", "count": "seven"}`), &out)
+	var typeErr UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("got %v, want an UnmarshalTypeError", err)
+	}
+}
+
+func TestRequiredField(t *testing.T) {
+	var out taggedProfile
+	err := Unmarshal([]byte(`{ count = 1; }`), &out)
+	var rerr *RequiredFieldError
+	if !errors.As(err, &rerr) || rerr.Key != "name" {
+		t.Fatalf("got %v, want a RequiredFieldError for name", err)
+	}
+}
+
+func TestDisallowUnknownFields(t *testing.T) {
+	type device struct {
+		ID   string `plist:"id"`
+		Name string `plist:"name"`
+	}
+	var out struct {
+		Devices []device `plist:"devices"`
+	}
+	input := `{ devices = ( { id = 1; name = a; udid = x; } ); }`
+
+	if err := Unmarshal([]byte(input), &out); err != nil {
+		t.Fatalf("unknown keys are ignored by default: %v", err)
+	}
+
+	d := NewOpenStepDecoder(strings.NewReader(input))
+	d.DisallowUnknownFields()
+	err := d.Decode(&out)
+	var uerr *UnknownFieldError
+	if !errors.As(err, &uerr) || uerr.Key != "udid" {
+		t.Fatalf("got %v, want an UnknownFieldError for udid", err)
+	}
+
+	// an inline map takes the unknown keys
+	var inline taggedProfile
+	d = NewOpenStepDecoder(strings.NewReader(`{ name = a; udid = x; }`))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&inline); err != nil {
+		t.Fatal(err)
+	}
+	if inline.Extra["udid"] != "x" {
+		t.Errorf("extra = %v", inline.Extra)
+	}
+}
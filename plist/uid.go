@@ -0,0 +1,71 @@
+package plist
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+)
+
+// UID is a reference to an object of an NSKeyedArchiver archive, stored with
+// marker 0x8 in binary plists. XML and OpenStep have no UID type, so a UID is
+// written as a dictionary with the single integer key CF$UID, and the XML
+// parser reads such a dictionary back as a UID.
+type UID uint64
+
+const cfUIDKey = "CF$UID"
+
+var uidType = reflect.TypeOf(UID(0))
+
+// uidDictionary returns the {CF$UID = n} dictionary of a UID
+func uidDictionary(uid UID) *plistValue {
+	dict := &dictionary{m: map[string]*plistValue{}}
+	dict.set(cfUIDKey, &plistValue{Integer, signedInt{uint64(uid), false}})
+	return &plistValue{Dictionary, dict}
+}
+
+// dictionaryUID returns the UID of a {CF$UID = n} dictionary
+func dictionaryUID(dict *dictionary) (UID, bool) {
+	if len(dict.m) != 1 {
+		return 0, false
+	}
+	val, ok := dict.m[cfUIDKey]
+	if !ok || val.kind != Integer {
+		return 0, false
+	}
+	i := val.value.(signedInt)
+	if i.signed && int64(i.value) < 0 {
+		return 0, false
+	}
+	return UID(i.value), true
+}
+
+func (bp *binaryParser) parseUID(marker byte) (*plistValue, error) {
+	nbytes := int(marker&0xf) + 1
+	if nbytes > 8 {
+		return nil, fmt.Errorf("plist: cannot decode uids longer than 8 bytes (%d)", nbytes)
+	}
+	buf := make([]byte, 8)
+	if _, err := bp.Read(buf[8-nbytes:]); err != nil {
+		return nil, err
+	}
+	return &plistValue{UIDKind, UID(binary.BigEndian.Uint64(buf))}, nil
+}
+
+func (d *Decoder) unmarshalUID(pval *plistValue, v reflect.Value) error {
+	uid := pval.value.(UID)
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.OverflowUint(uint64(uid)) {
+			return UnmarshalTypeError{fmt.Sprintf("uid %d", uid), v.Type()}
+		}
+		v.SetUint(uint64(uid))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if int64(uid) < 0 || v.OverflowInt(int64(uid)) {
+			return UnmarshalTypeError{fmt.Sprintf("uid %d", uid), v.Type()}
+		}
+		v.SetInt(int64(uid))
+	default:
+		return UnmarshalTypeError{fmt.Sprintf("uid %d", uid), v.Type()}
+	}
+	return nil
+}
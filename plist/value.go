@@ -0,0 +1,507 @@
+package plist
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Value is a mutable plist value tree. Unlike decoding into
+// map[string]interface{}, it keeps the plist type of every value and the
+// order of dictionary keys, which is preserved when the tree is encoded.
+// Decode into a Value, or pass one to Encode, like any other Go value.
+type Value struct {
+	kind   Kind
+	scalar interface{} // string, signedInt, sizedFloat, bool, []byte, time.Time or UID
+	keys   []string
+	dict   map[string]*Value
+	array  []*Value
+}
+
+var valueType = reflect.TypeOf(Value{})
+
+// ParseValue parses a plist in any format into a Value tree.
+func ParseValue(data []byte) (*Value, error) {
+	v := new(Value)
+	if err := Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// ValueOf returns the Value tree of a Go value, as Encode would encode it.
+func ValueOf(v interface{}) (*Value, error) {
+	pval, err := (&Encoder{}).marshal(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	return newValue(pval), nil
+}
+
+// NewDictionary returns an empty dictionary.
+func NewDictionary() *Value {
+	return &Value{kind: Dictionary, dict: map[string]*Value{}}
+}
+
+// NewArray returns an array of the values.
+func NewArray(values ...*Value) *Value {
+	return &Value{kind: Array, array: append([]*Value{}, values...)}
+}
+
+// NewString returns a string value.
+func NewString(s string) *Value {
+	return &Value{kind: String, scalar: s}
+}
+
+// NewInteger returns a signed integer value.
+func NewInteger(i int64) *Value {
+	return &Value{kind: Integer, scalar: signedInt{uint64(i), i < 0}}
+}
+
+// NewUnsigned returns an unsigned integer value.
+func NewUnsigned(u uint64) *Value {
+	return &Value{kind: Integer, scalar: signedInt{u, false}}
+}
+
+// NewReal returns a 64-bit real value.
+func NewReal(f float64) *Value {
+	return &Value{kind: Real, scalar: sizedFloat{f, 64}}
+}
+
+// NewBoolean returns a boolean value.
+func NewBoolean(b bool) *Value {
+	return &Value{kind: Boolean, scalar: b}
+}
+
+// NewData returns a data value.
+func NewData(data []byte) *Value {
+	return &Value{kind: Data, scalar: data}
+}
+
+// NewDate returns a date value.
+func NewDate(t time.Time) *Value {
+	return &Value{kind: Date, scalar: t}
+}
+
+// NewUID returns a UID value.
+func NewUID(uid UID) *Value {
+	return &Value{kind: UIDKind, scalar: uid}
+}
+
+func newValue(pval *plistValue) *Value {
+	switch pval.kind {
+	case Dictionary:
+		d := pval.value.(*dictionary)
+		v := &Value{kind: Dictionary, dict: make(map[string]*Value, len(d.m))}
+		v.keys = d.orderedKeys()
+		for _, k := range v.keys {
+			v.dict[k] = newValue(d.m[k])
+		}
+		return v
+	case Array:
+		list := pval.value.([]*plistValue)
+		v := &Value{kind: Array, array: make([]*Value, len(list))}
+		for i, sub := range list {
+			v.array[i] = newValue(sub)
+		}
+		return v
+	}
+	return &Value{kind: pval.kind, scalar: pval.value}
+}
+
+// plistValue converts the tree back, dictionaries keep their key order. A zero
+// Value has no plist type and can not be encoded.
+func (v *Value) plistValue() (*plistValue, error) {
+	if v == nil || v.kind == Invalid {
+		return nil, &UnsupportedValueError{reflect.ValueOf(v), "zero plist.Value"}
+	}
+	switch v.kind {
+	case Dictionary:
+		d := &dictionary{m: make(map[string]*plistValue, len(v.keys)), ordered: true}
+		for _, k := range v.keys {
+			sub, err := v.dict[k].plistValue()
+			if err != nil {
+				return nil, err
+			}
+			d.set(k, sub)
+		}
+		return &plistValue{Dictionary, d}, nil
+	case Array:
+		list := make([]*plistValue, len(v.array))
+		for i, sub := range v.array {
+			pval, err := sub.plistValue()
+			if err != nil {
+				return nil, err
+			}
+			list[i] = pval
+		}
+		return &plistValue{Array, list}, nil
+	}
+	return &plistValue{v.kind, v.scalar}, nil
+}
+
+// Marshal encodes the tree in the format.
+func (v *Value) Marshal(format Format) ([]byte, error) {
+	return MarshalFormat(v, format)
+}
+
+// Kind returns the plist type of the value.
+func (v *Value) Kind() Kind {
+	return v.kind
+}
+
+// Interface returns the value as the Go types Decode uses for an empty interface,
+// or nil for a zero Value.
+func (v *Value) Interface() interface{} {
+	pval, err := v.plistValue()
+	if err != nil {
+		return nil
+	}
+	return (&Decoder{}).valueInterface(pval)
+}
+
+// AsString returns the string of a string value.
+func (v *Value) AsString() (string, bool) {
+	s, ok := v.scalar.(string)
+	return s, ok && v.kind == String
+}
+
+// AsInt returns the integer value as an int64, unsigned values above
+// math.MaxInt64 do not fit and return false.
+func (v *Value) AsInt() (int64, bool) {
+	i, ok := v.scalar.(signedInt)
+	if !ok || !i.signed && i.value > math.MaxInt64 {
+		return 0, false
+	}
+	return int64(i.value), true
+}
+
+// AsUint returns a non-negative integer value as a uint64.
+func (v *Value) AsUint() (uint64, bool) {
+	i, ok := v.scalar.(signedInt)
+	if !ok || i.signed && int64(i.value) < 0 {
+		return 0, false
+	}
+	return i.value, true
+}
+
+// AsFloat returns the real value.
+func (v *Value) AsFloat() (float64, bool) {
+	f, ok := v.scalar.(sizedFloat)
+	return f.value, ok
+}
+
+// AsBool returns the boolean value.
+func (v *Value) AsBool() (bool, bool) {
+	b, ok := v.scalar.(bool)
+	return b, ok
+}
+
+// AsData returns the bytes of a data value.
+func (v *Value) AsData() ([]byte, bool) {
+	b, ok := v.scalar.([]byte)
+	return b, ok
+}
+
+// AsDate returns the date value.
+func (v *Value) AsDate() (time.Time, bool) {
+	t, ok := v.scalar.(time.Time)
+	return t, ok
+}
+
+// AsUID returns the UID value.
+func (v *Value) AsUID() (UID, bool) {
+	uid, ok := v.scalar.(UID)
+	return uid, ok
+}
+
+// Len returns the number of entries of a dictionary or array.
+func (v *Value) Len() int {
+	switch v.kind {
+	case Dictionary:
+		return len(v.keys)
+	case Array:
+		return len(v.array)
+	}
+	return 0
+}
+
+// Keys returns the dictionary keys in order.
+func (v *Value) Keys() []string {
+	return append([]string(nil), v.keys...)
+}
+
+// Get returns the dictionary value of key, or nil.
+func (v *Value) Get(key string) *Value {
+	return v.dict[key]
+}
+
+// Index returns the array element i, or nil.
+func (v *Value) Index(i int) *Value {
+	if v.kind != Array || i < 0 || i >= len(v.array) {
+		return nil
+	}
+	return v.array[i]
+}
+
+// errNilValue is returned when a nil *Value is added to a tree
+var errNilValue = errors.New("plist: nil value")
+
+// SetKey sets a dictionary entry, new keys are added at the end.
+func (v *Value) SetKey(key string, val *Value) error {
+	if val == nil {
+		return errNilValue
+	}
+	if v.kind != Dictionary {
+		return fmt.Errorf("plist: cannot set key %q of %v", key, v.kind)
+	}
+	if v.dict == nil {
+		v.dict = map[string]*Value{}
+	}
+	if _, ok := v.dict[key]; !ok {
+		v.keys = append(v.keys, key)
+	}
+	v.dict[key] = val
+	return nil
+}
+
+// DeleteKey removes a dictionary entry.
+func (v *Value) DeleteKey(key string) {
+	if _, ok := v.dict[key]; !ok {
+		return
+	}
+	delete(v.dict, key)
+	for i, k := range v.keys {
+		if k == key {
+			v.keys = append(v.keys[:i], v.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Append adds values to the end of an array.
+func (v *Value) Append(values ...*Value) error {
+	if v.kind != Array {
+		return fmt.Errorf("plist: cannot append to %v", v.kind)
+	}
+	for _, val := range values {
+		if val == nil {
+			return errNilValue
+		}
+	}
+	v.array = append(v.array, values...)
+	return nil
+}
+
+// PathError reports a key path that does not resolve.
+type PathError struct {
+	Path string
+	Msg  string
+}
+
+func (e *PathError) Error() string {
+	return "plist: " + e.Path + ": " + e.Msg
+}
+
+// splitPath splits a key path on dots, "\." is a literal dot. An array index
+// may also be written in brackets, like the DecodeError path a.b[3].
+func splitPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	var parts []string
+	var b strings.Builder
+	indexed := false // the last part was a bracketed index
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case c == '\\' && i+1 < len(path):
+			i++
+			b.WriteByte(path[i])
+		case c == '.':
+			if !indexed || b.Len() > 0 {
+				parts = append(parts, b.String())
+			}
+			b.Reset()
+			indexed = false
+			continue
+		case c == '[':
+			n := bracketIndex(path[i:])
+			if n == 0 {
+				b.WriteByte(c)
+				break
+			}
+			if b.Len() > 0 {
+				parts = append(parts, b.String())
+				b.Reset()
+			}
+			parts = append(parts, path[i+1:i+n-1])
+			i += n - 1
+			indexed = true
+			continue
+		default:
+			b.WriteByte(c)
+		}
+		indexed = false
+	}
+	if indexed {
+		return parts
+	}
+	return append(parts, b.String())
+}
+
+// bracketIndex returns the length of the [n] index at the start of s, or 0
+func bracketIndex(s string) int {
+	end := strings.IndexByte(s, ']')
+	if end < 2 {
+		return 0
+	}
+	for _, c := range s[1:end] {
+		if c < '0' || c > '9' {
+			return 0
+		}
+	}
+	return end + 1
+}
+
+// child returns the entry part of a dictionary or array, or nil
+func (v *Value) child(part string) (*Value, error) {
+	switch v.kind {
+	case Dictionary:
+		return v.dict[part], nil
+	case Array:
+		i, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an array index", part)
+		}
+		return v.Index(i), nil
+	}
+	return nil, fmt.Errorf("%v has no entry %q", v.kind, part)
+}
+
+// Lookup returns the value at a key path like CFBundleURLTypes.0.CFBundleURLSchemes
+// or CFBundleURLTypes[0].CFBundleURLSchemes, array elements are addressed by
+// index and "\." escapes a dot in a key.
+// An empty path returns v.
+func (v *Value) Lookup(path string) (*Value, error) {
+	cur := v
+	for _, part := range splitPath(path) {
+		next, err := cur.child(part)
+		if err != nil {
+			return nil, &PathError{path, err.Error()}
+		}
+		if next == nil {
+			return nil, &PathError{path, fmt.Sprintf("%q not found", part)}
+		}
+		cur = next
+	}
+	return cur, nil
+}
+
+// parent returns the container of the last path element, missing dictionaries are created when create is set
+func (v *Value) parent(path string, create bool) (*Value, string, error) {
+	parts := splitPath(path)
+	if len(parts) == 0 {
+		return nil, "", &PathError{path, "empty path"}
+	}
+	cur := v
+	for _, part := range parts[:len(parts)-1] {
+		next, err := cur.child(part)
+		if err != nil {
+			return nil, "", &PathError{path, err.Error()}
+		}
+		if next == nil {
+			if !create || cur.kind != Dictionary {
+				return nil, "", &PathError{path, fmt.Sprintf("%q not found", part)}
+			}
+			next = NewDictionary()
+			cur.SetKey(part, next)
+		}
+		cur = next
+	}
+	return cur, parts[len(parts)-1], nil
+}
+
+// Set sets the value at the key path, replacing an existing value. Missing
+// intermediate dictionaries are created, and index len appends to an array.
+func (v *Value) Set(path string, val *Value) error {
+	if val == nil {
+		return errNilValue
+	}
+	parent, last, err := v.parent(path, true)
+	if err != nil {
+		return err
+	}
+	switch parent.kind {
+	case Dictionary:
+		return parent.SetKey(last, val)
+	case Array:
+		i, err := strconv.Atoi(last)
+		if err != nil || i < 0 || i > len(parent.array) {
+			return &PathError{path, fmt.Sprintf("index %q out of range", last)}
+		}
+		if i == len(parent.array) {
+			parent.array = append(parent.array, val)
+		} else {
+			parent.array[i] = val
+		}
+		return nil
+	}
+	return &PathError{path, fmt.Sprintf("%v has no entry %q", parent.kind, last)}
+}
+
+// Add adds a value at the key path, like PlistBuddy Add: it fails when a
+// dictionary key exists and inserts before an array index.
+func (v *Value) Add(path string, val *Value) error {
+	if val == nil {
+		return errNilValue
+	}
+	parent, last, err := v.parent(path, true)
+	if err != nil {
+		return err
+	}
+	switch parent.kind {
+	case Dictionary:
+		if _, ok := parent.dict[last]; ok {
+			return &PathError{path, "entry already exists"}
+		}
+		return parent.SetKey(last, val)
+	case Array:
+		i, err := strconv.Atoi(last)
+		if err != nil || i < 0 || i > len(parent.array) {
+			return &PathError{path, fmt.Sprintf("index %q out of range", last)}
+		}
+		parent.array = append(parent.array, nil)
+		copy(parent.array[i+1:], parent.array[i:])
+		parent.array[i] = val
+		return nil
+	}
+	return &PathError{path, fmt.Sprintf("%v has no entry %q", parent.kind, last)}
+}
+
+// Delete removes the value at the key path.
+func (v *Value) Delete(path string) error {
+	parent, last, err := v.parent(path, false)
+	if err != nil {
+		return err
+	}
+	switch parent.kind {
+	case Dictionary:
+		if _, ok := parent.dict[last]; !ok {
+			return &PathError{path, fmt.Sprintf("%q not found", last)}
+		}
+		parent.DeleteKey(last)
+		return nil
+	case Array:
+		i, err := strconv.Atoi(last)
+		if err != nil || i < 0 || i >= len(parent.array) {
+			return &PathError{path, fmt.Sprintf("index %q out of range", last)}
+		}
+		parent.array = append(parent.array[:i], parent.array[i+1:]...)
+		return nil
+	}
+	return &PathError{path, fmt.Sprintf("%v has no entry %q", parent.kind, last)}
+}
@@ -0,0 +1,295 @@
+package plist
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const infoPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CFBundleName</key>
+	<string>App</string>
+	<key>CFBundleIdentifier</key>
+	<string>com.example.app</string>
+	<key>CFBundleURLTypes</key>
+	<array>
+		<dict>
+			<key>CFBundleURLSchemes</key>
+			<array>
+				<string>example</string>
+			</array>
+		</dict>
+	</array>
+	<key>Icon</key>
+	<data>AAEC</data>
+	<key>Build</key>
+	<integer>42</integer>
+</dict>
+</plist>
+`
+
+func TestValueLookup(t *testing.T) {
+	v, err := ParseValue([]byte(infoPlist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(v.Keys(), ","); got != "CFBundleName,CFBundleIdentifier,CFBundleURLTypes,Icon,Build" {
+		t.Errorf("keys = %s", got)
+	}
+	scheme, err := v.Lookup("CFBundleURLTypes.0.CFBundleURLSchemes.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := scheme.AsString(); !ok || s != "example" {
+		t.Errorf("scheme = %q, %v", s, ok)
+	}
+	icon, _ := v.Lookup("Icon")
+	if icon.Kind() != Data {
+		t.Errorf("icon kind = %v, want data", icon.Kind())
+	}
+	if _, ok := icon.AsString(); ok {
+		t.Error("data value returned a string")
+	}
+	build, _ := v.Lookup("Build")
+	if n, ok := build.AsInt(); !ok || n != 42 {
+		t.Errorf("build = %d, %v", n, ok)
+	}
+	for _, path := range []string{"Missing", "CFBundleURLTypes.1", "CFBundleURLTypes.x", "CFBundleName.x"} {
+		if _, err := v.Lookup(path); err == nil {
+			t.Errorf("Lookup(%q) succeeded", path)
+		}
+	}
+}
+
+func TestValueMutation(t *testing.T) {
+	v, err := ParseValue([]byte(infoPlist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Set("CFBundleIdentifier", NewString("com.widuu.app")); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Add("CFBundleURLTypes.0.CFBundleURLSchemes.0", NewString("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Add("CFBundleName", NewString("dup")); err == nil {
+		t.Error("Add of an existing key succeeded")
+	}
+	if err := v.Set("NSAppTransportSecurity.NSAllowsArbitraryLoads", NewBoolean(true)); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Set("dotted\\.key", NewInteger(-1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Delete("Icon"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Delete("Icon"); err == nil {
+		t.Error("Delete of a missing key succeeded")
+	}
+
+	if got := strings.Join(v.Keys(), ","); got != "CFBundleName,CFBundleIdentifier,CFBundleURLTypes,Build,NSAppTransportSecurity,dotted.key" {
+		t.Errorf("keys = %s", got)
+	}
+	schemes, _ := v.Lookup("CFBundleURLTypes.0.CFBundleURLSchemes")
+	if schemes.Len() != 2 {
+		t.Fatalf("schemes len = %d", schemes.Len())
+	}
+	if s, _ := schemes.Index(0).AsString(); s != "first" {
+		t.Errorf("schemes[0] = %q", s)
+	}
+	if n, ok := v.Get("dotted.key").AsInt(); !ok || n != -1 {
+		t.Errorf("dotted.key = %d", n)
+	}
+
+	if err := v.SetKey("nil", nil); err == nil {
+		t.Error("SetKey of a nil value succeeded")
+	}
+	if err := v.Set("nil", nil); err == nil {
+		t.Error("Set of a nil value succeeded")
+	}
+	if err := schemes.Append(NewString("last"), nil); err == nil {
+		t.Error("Append of a nil value succeeded")
+	}
+	if err := v.Add("CFBundleURLTypes.0.CFBundleURLSchemes.0", nil); err == nil {
+		t.Error("Add of a nil value succeeded")
+	}
+	if v.Get("nil") != nil || schemes.Len() != 2 {
+		t.Error("nil value added to the tree")
+	}
+}
+
+func TestValueAsInt(t *testing.T) {
+	tests := []struct {
+		v    *Value
+		want int64
+		ok   bool
+	}{
+		{NewInteger(-1), -1, true},
+		{NewUnsigned(math.MaxInt64), math.MaxInt64, true},
+		{NewUnsigned(math.MaxInt64 + 1), 0, false},
+		{NewUnsigned(math.MaxUint64), 0, false},
+		{NewString("1"), 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := tt.v.AsInt(); got != tt.want || ok != tt.ok {
+			t.Errorf("AsInt of %v = %d, %v, want %d, %v", tt.v.Interface(), got, ok, tt.want, tt.ok)
+		}
+	}
+	if u, ok := NewUnsigned(math.MaxUint64).AsUint(); !ok || u != math.MaxUint64 {
+		t.Errorf("AsUint = %d, %v", u, ok)
+	}
+	if Integer.String() != "integer" || Kind(42).String() != "invalid" {
+		t.Error("unexpected Kind names")
+	}
+}
+
+func TestValueEncodePreservesOrder(t *testing.T) {
+	v, err := ParseValue([]byte(infoPlist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []Format{XMLFormat, BinaryFormat, OpenStepFormat} {
+		data, err := v.Marshal(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := ParseValue(data)
+		if err != nil {
+			t.Fatalf("%v: %v", format, err)
+		}
+		if got := strings.Join(out.Keys(), ","); got != "CFBundleName,CFBundleIdentifier,CFBundleURLTypes,Icon,Build" {
+			t.Errorf("%v: keys = %s", format, got)
+		}
+	}
+
+	// decoding and encoding again must not change the output
+	var first, second bytes.Buffer
+	enc := NewEncoder(&first)
+	enc.Indent("\t")
+	if err := enc.Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	again, err := ParseValue(first.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc = NewEncoder(&second)
+	enc.Indent("\t")
+	if err := enc.Encode(again); err != nil {
+		t.Fatal(err)
+	}
+	if first.String() != second.String() {
+		t.Errorf("xml round trip changed the document:\n%s\n%s", first.String(), second.String())
+	}
+	if strings.Index(first.String(), "CFBundleName") > strings.Index(first.String(), "CFBundleIdentifier") {
+		t.Errorf("xml output reordered keys:\n%s", first.String())
+	}
+}
+
+func TestValueOf(t *testing.T) {
+	v, err := ValueOf(map[string]interface{}{"b": 1, "a": []string{"x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Kind() != Dictionary || v.Len() != 2 {
+		t.Fatalf("unexpected value %+v", v)
+	}
+	if got := v.Interface().(map[string]interface{})["a"].([]interface{})[0]; got != "x" {
+		t.Errorf("a.0 = %v", got)
+	}
+}
+
+func TestMarshalZeroValue(t *testing.T) {
+	var nilValue *Value
+	inputs := map[string]interface{}{
+		"zero":        Value{},
+		"zero field":  struct{ V Value }{},
+		"nil field":   struct{ V *Value }{},
+		"nil pointer": nilValue,
+		"nested":      NewArray(NewString("a"), &Value{}),
+	}
+	for _, format := range []Format{XMLFormat, BinaryFormat, OpenStepFormat, GNUStepFormat, JSONFormat} {
+		for name, v := range inputs {
+			if _, err := MarshalFormat(v, format); err == nil {
+				t.Errorf("%v %s: encoded a zero Value", format, name)
+			}
+		}
+	}
+
+	// omitempty skips a zero Value
+	data, err := MarshalFormat(struct {
+		V Value `plist:"v,omitempty"`
+		S string
+	}{S: "a"}, OpenStepFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "v") {
+		t.Errorf("omitempty zero Value encoded: %s", data)
+	}
+	if v := (&Value{}).Interface(); v != nil {
+		t.Errorf("Interface of a zero Value = %v", v)
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	tests := map[string][]string{
+		"":              nil,
+		"a":             {"a"},
+		"a.0.b":         {"a", "0", "b"},
+		"a[0].b":        {"a", "0", "b"},
+		"a[0][12]":      {"a", "0", "12"},
+		"[3]":           {"3"},
+		`a\.b[1]`:       {"a.b", "1"},
+		"a[x].b":        {"a[x]", "b"},
+		"a[].b[":        {"a[]", "b["},
+		`a\[0]`:         {"a[0]"},
+		"a..b":          {"a", "", "b"},
+		"a[0].b[1].c.2": {"a", "0", "b", "1", "c", "2"},
+	}
+	for path, want := range tests {
+		if got := splitPath(path); !reflect.DeepEqual(got, want) {
+			t.Errorf("splitPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestValueLookupDecodeErrorPath(t *testing.T) {
+	v, err := ParseValue([]byte(infoPlist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info struct {
+		CFBundleURLTypes []struct {
+			CFBundleURLSchemes []int
+		}
+	}
+	err = Unmarshal([]byte(infoPlist), &info)
+	derr, ok := err.(*DecodeError)
+	if !ok || derr.Path != "CFBundleURLTypes[0].CFBundleURLSchemes[0]" {
+		t.Fatalf("got %v, want a DecodeError", err)
+	}
+	scheme, err := v.Lookup(derr.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := scheme.AsString(); s != "example" {
+		t.Errorf("Lookup(%q) = %q", derr.Path, s)
+	}
+	if err := v.Set("CFBundleURLTypes[0].CFBundleURLSchemes[1]", NewString("other")); err != nil {
+		t.Fatal(err)
+	}
+	other, err := v.Lookup("CFBundleURLTypes.0.CFBundleURLSchemes.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := other.AsString(); s != "other" {
+		t.Errorf("Lookup after Set = %q", s)
+	}
+}
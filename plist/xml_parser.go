@@ -14,19 +14,56 @@ import (
 // xmlParser uses xml.Decoder to parse an xml plist into the corresponding plistValues
 type xmlParser struct {
 	*xml.Decoder
+	path    keyPath               // key path of the element being parsed
+	offsets map[*plistValue]int64 // element offsets, for decode errors
+	input   io.ReadSeeker         // the input read again for error positions, or nil
+	start   int64                 // offset of the document in input
+	limits  *limiter
 }
 
 // newXMLParser returns a new xmlParser
 func newXMLParser(r io.Reader) *xmlParser {
-	return &xmlParser{xml.NewDecoder(r)}
+	return &xmlParser{
+		Decoder: xml.NewDecoder(r),
+		offsets: make(map[*plistValue]int64),
+	}
+}
+
+// setInput records where the document starts in src, the reader r of the
+// parser reads from, so errors can report line and column by reading src
+// again. Errors have no position when src is not an io.ReadSeeker.
+func (p *xmlParser) setInput(src io.Reader, start int64) {
+	if rs, ok := src.(io.ReadSeeker); ok && start >= 0 {
+		p.input, p.start = rs, start
+	}
+}
+
+// position returns the line and column of an input offset, zero when unknown
+func (p *xmlParser) position(offset int64) (line, column int) {
+	if p.input == nil {
+		return 0, 0
+	}
+	return inputPosition(p.input, p.start, offset)
+}
+
+// inputStart returns the current offset of r, or -1 when r is not an io.Seeker
+func inputStart(r io.Reader) int64 {
+	if s, ok := r.(io.Seeker); ok {
+		if start, err := s.Seek(0, io.SeekCurrent); err == nil {
+			return start
+		}
+	}
+	return -1
 }
 
 func (p *xmlParser) parseDocument(start *xml.StartElement) (*plistValue, error) {
+	offset := p.InputOffset()
 	if start == nil {
 		for {
+			offset = p.InputOffset()
 			tok, err := p.Token()
 			if err != nil {
-				return nil, err
+				return nil, p.errorAt(offset, err)
 			}
 			if t, ok := tok.(xml.StartElement); ok {
 				start = &t
@@ -34,7 +71,30 @@ func (p *xmlParser) parseDocument(start *xml.StartElement) (*plistValue, error)
 			}
 		}
 	}
-	return p.parseXMLElement(start)
+	return p.parseElement(start, offset)
+}
+
+// parseElement parses the element that starts at offset and records the
+// offset. Errors are returned as a DecodeError with the key path and
+// position of the innermost element.
+func (p *xmlParser) parseElement(element *xml.StartElement, offset int64) (*plistValue, error) {
+	if err := p.limits.object(); err != nil {
+		return nil, p.errorAt(offset, err)
+	}
+	val, err := p.parseXMLElement(element)
+	if err != nil {
+		return nil, p.errorAt(offset, err)
+	}
+	p.offsets[val] = offset
+	return val, nil
+}
+
+func (p *xmlParser) errorAt(offset int64, err error) error {
+	if _, ok := err.(*DecodeError); ok {
+		return err
+	}
+	line, column := p.position(offset)
+	return &DecodeError{Path: p.path.String(), Line: line, Column: column, Err: err}
 }
 
 func (p *xmlParser) parseXMLElement(element *xml.StartElement) (*plistValue, error) {
@@ -64,6 +124,7 @@ func (p *xmlParser) parseXMLElement(element *xml.StartElement) (*plistValue, err
 
 func (p *xmlParser) parsePlist(element *xml.StartElement) (*plistValue, error) {
 	for {
+		offset := p.InputOffset()
 		token, err := p.Token()
 		if err != nil {
 			return nil, err
@@ -72,16 +133,21 @@ func (p *xmlParser) parsePlist(element *xml.StartElement) (*plistValue, error) {
 			break
 		}
 		if el, ok := token.(xml.StartElement); ok {
-			return p.parseXMLElement(&el)
+			return p.parseElement(&el, offset)
 		}
 	}
 	return nil, errors.New("plist: Invalid plist")
 }
 
 func (p *xmlParser) parseDict(element *xml.StartElement) (*plistValue, error) {
+	if err := p.limits.enter(); err != nil {
+		return nil, err
+	}
+	defer p.limits.leave()
 	var key *string
-	var subvalues = make(map[string]*plistValue)
+	dict := &dictionary{m: make(map[string]*plistValue)}
 	for {
+		offset := p.InputOffset()
 		token, err := p.Token()
 		if err != nil {
 			return nil, err
@@ -95,20 +161,32 @@ func (p *xmlParser) parseDict(element *xml.StartElement) (*plistValue, error) {
 				if err := p.DecodeElement(&k, &el); err != nil {
 					return nil, err
 				}
+				if err := p.limits.object(); err != nil {
+					return nil, err
+				}
+				if err := p.limits.stringSize(uint64(len(k))); err != nil {
+					return nil, err
+				}
 				key = &k
 				continue
 			}
 			if key == nil {
 				return nil, errors.New("plist: missing key in dict")
 			}
-			subvalues[*key], err = p.parseXMLElement(&el)
+			p.path.pushKey(*key)
+			val, err := p.parseElement(&el, offset)
+			p.path.pop()
 			if err != nil {
 				return nil, err
 			}
+			dict.set(*key, val)
 			key = nil
 		}
 	}
-	return &plistValue{Dictionary, &dictionary{m: subvalues}}, nil
+	if uid, ok := dictionaryUID(dict); ok {
+		return &plistValue{UIDKind, uid}, nil
+	}
+	return &plistValue{Dictionary, dict}, nil
 }
 
 func (p *xmlParser) parseString(element *xml.StartElement) (*plistValue, error) {
@@ -116,6 +194,9 @@ func (p *xmlParser) parseString(element *xml.StartElement) (*plistValue, error)
 	if err := p.DecodeElement(&value, element); err != nil {
 		return nil, err
 	}
+	if err := p.limits.stringSize(uint64(len(value))); err != nil {
+		return nil, err
+	}
 	return &plistValue{String, value}, nil
 }
 
@@ -128,8 +209,13 @@ func (p *xmlParser) parseBoolean(element *xml.StartElement) (*plistValue, error)
 }
 
 func (p *xmlParser) parseArray(element *xml.StartElement) (*plistValue, error) {
+	if err := p.limits.enter(); err != nil {
+		return nil, err
+	}
+	defer p.limits.leave()
 	var subvalues []*plistValue
 	for {
+		offset := p.InputOffset()
 		token, err := p.Token()
 		if err != nil {
 			return nil, err
@@ -138,7 +224,9 @@ func (p *xmlParser) parseArray(element *xml.StartElement) (*plistValue, error) {
 			break
 		}
 		if el, ok := token.(xml.StartElement); ok {
-			subv, err := p.parseXMLElement(&el)
+			p.path.pushIndex(len(subvalues))
+			subv, err := p.parseElement(&el, offset)
+			p.path.pop()
 			if err != nil {
 				return nil, err
 			}
@@ -171,14 +259,14 @@ func (p *xmlParser) parseInteger(element *xml.StartElement) (*plistValue, error)
 	if strings.HasPrefix(s, "-") {
 		i, err := strconv.ParseInt(s, 10, 64)
 		if err != nil {
-			return nil, err
+			return nil, integerError(s, err)
 		}
 		return &plistValue{Integer, signedInt{uint64(i), true}}, nil
 	}
 	// Otherwise assume positive number and put into uint64.
 	u, err := strconv.ParseUint(s, 10, 64)
 	if err != nil {
-		return nil, err
+		return nil, integerError(s, err)
 	}
 	return &plistValue{Integer, signedInt{u, false}}, nil
 }
@@ -201,6 +289,9 @@ func (p *xmlParser) parseData(element *xml.StartElement) (*plistValue, error) {
 	}
 
 	if err != nil {
+		return nil, &Base64Error{err}
+	}
+	if err := p.limits.dataSize(uint64(len(decoded))); err != nil {
 		return nil, err
 	}
 	data = []byte(decoded)
@@ -208,9 +299,21 @@ func (p *xmlParser) parseData(element *xml.StartElement) (*plistValue, error) {
 }
 
 func (p *xmlParser) parseDate(element *xml.StartElement) (*plistValue, error) {
-	var date time.Time
-	if err := p.DecodeElement(&date, element); err != nil {
+	var s string
+	if err := p.DecodeElement(&s, element); err != nil {
 		return nil, err
 	}
+	date, err := time.Parse(time.RFC3339, strings.TrimSpace(s))
+	if err != nil {
+		return nil, &InvalidDateError{s, err}
+	}
 	return &plistValue{Date, date}, nil
 }
+
+// integerError returns an IntegerOverflowError for out of range integers
+func integerError(s string, err error) error {
+	if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+		return &IntegerOverflowError{Value: s}
+	}
+	return err
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"math"
-	"reflect"
 	"time"
 )
 
@@ -77,8 +76,10 @@ func (e *xmlEncoder) writePlistValue(pval *plistValue) error {
 		return e.writeRealValue(pval)
 	case Data:
 		return e.writeDataValue(pval)
+	case UIDKind:
+		return e.writeDictionaryValue(uidDictionary(pval.value.(UID)))
 	default:
-		return &UnsupportedTypeError{reflect.ValueOf(pval.value).Type()}
+		return fmt.Errorf("plist: cannot encode %v in an XML plist", pval.kind)
 	}
 }
 
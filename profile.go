@@ -3,6 +3,7 @@ package apple
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/widuu/apple/plist"
@@ -15,10 +16,38 @@ const (
 	profileDownUrl  = "https://developerservices2.apple.com/services/QH65B2/ios/downloadTeamProvisioningProfile.action?clientId=XABBG36SBA"
 )
 
+// ErrProfileNotFound no profile matches the search
+var ErrProfileNotFound = errors.New("Profile does not exist")
+
 type ProfileData struct {
-	Stype      string            `json:"type"`
-	Id         string            `json:"id"`
-	Attributes map[string]string `json:"attributes"`
+	Stype string `json:"type"`
+	Id    string `json:"id"`
+	// Attributes string values of the attributes, booleans and numbers are formatted and nulls dropped
+	Attributes    map[string]string    `json:"attributes"`
+	Relationships ProfileRelationships `json:"relationships"`
+}
+
+// ProfileRelationships relationships of a profile
+type ProfileRelationships struct {
+	BundleId     Relationship `json:"bundleId"`
+	Certificates Relationship `json:"certificates"`
+	Devices      Relationship `json:"devices"`
+}
+
+// UnmarshalJSON decode the profile, attributes which are not strings are converted
+func (p *ProfileData) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Stype         string                 `json:"type"`
+		Id            string                 `json:"id"`
+		Attributes    map[string]interface{} `json:"attributes"`
+		Relationships ProfileRelationships   `json:"relationships"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	p.Stype, p.Id, p.Relationships = raw.Stype, raw.Id, raw.Relationships
+	p.Attributes = stringAttributes(raw.Attributes)
+	return nil
 }
 
 type profileListResponse struct {
@@ -28,10 +57,13 @@ type profileListResponse struct {
 		Status string `json:"status"`
 		Detail string `json:"detail"`
 	} `json:"errors"`
-	Data []ProfileData `json:"data"`
+	Data     []ProfileData `json:"data"`
+	Included []Resource    `json:"included"`
+	apiPage
 }
 
 type createProfileRequest struct {
+	ProvisioningProfileID   string   `plist:"provisioningProfileId,omitempty"`
 	TeamID                  string   `plist:"teamId"`
 	BundleId                string   `plist:"appIdId"`
 	Devices                 []string `plist:"deviceIds"`
@@ -44,6 +76,15 @@ type createProfileRequest struct {
 	UserLocale              []string `plist:"userLocale"`
 }
 
+type downloadTeamProfileRequest struct {
+	TeamID          string   `plist:"teamId"`
+	BundleId        string   `plist:"appIdId"`
+	ClientID        string   `plist:"clientId"`
+	Myacinfo        string   `plist:"myacinfo"`
+	ProtocolVersion string   `plist:"protocolVersion"`
+	UserLocale      []string `plist:"userLocale"`
+}
+
 type ProvisioningProfile struct {
 	ProvisioningProfileId string `plist:"provisioningProfileId"`
 	Name                  string `plist:"name"`
@@ -78,11 +119,6 @@ func CreateProfile(provisioningProfileName, bundleId, distributionType string, c
 		UserLocale:              strings.Split(UserLocale, "#"),
 	}
 
-	encoder, err := plist.MarshalIndent(requestParams, "   ")
-	if err != nil {
-		return ProvisioningProfile{}, err
-	}
-
 	// api url
 	var apiUrl string
 	if isRegen {
@@ -91,6 +127,33 @@ func CreateProfile(provisioningProfileName, bundleId, distributionType string, c
 		apiUrl = profileAddUrl
 	}
 
+	return postProfile(apiUrl, requestParams, myacinfo)
+}
+
+// RegenProfile regenerate the profile with profileId
+func RegenProfile(profileId, provisioningProfileName, bundleId, distributionType string, certs, devices []string, teamId, myacinfo string) (ProvisioningProfile, error) {
+	requestParams := createProfileRequest{
+		ProvisioningProfileID:   profileId,
+		TeamID:                  teamId,
+		BundleId:                bundleId,
+		Devices:                 devices,
+		Certs:                   certs,
+		DistributionType:        distributionType,
+		ProvisioningProfileName: provisioningProfileName,
+		ClientID:                ClientID,
+		Myacinfo:                myacinfo,
+		ProtocolVersion:         ProtocolVersion,
+		UserLocale:              strings.Split(UserLocale, "#"),
+	}
+	return postProfile(profileRegenUrl, requestParams, myacinfo)
+}
+
+func postProfile(apiUrl string, requestParams interface{}, myacinfo string) (ProvisioningProfile, error) {
+	encoder, err := plist.MarshalIndent(requestParams, "   ")
+	if err != nil {
+		return ProvisioningProfile{}, err
+	}
+
 	request := NewClientRequest(apiUrl, "POST")
 	RequestHeader["Cookie"] = "myacinfo=" + myacinfo
 	body, _, err := request.SetHeader(RequestHeader).SetBody(encoder).GetBody()
@@ -112,10 +175,94 @@ func CreateProfile(provisioningProfileName, bundleId, distributionType string, c
 	return data.Profile, nil
 }
 
+// DownloadTeamProfile download the Xcode managed team profile of the app id
+func DownloadTeamProfile(bundleId, teamId, myacinfo string) (ProvisioningProfile, error) {
+	requestParams := downloadTeamProfileRequest{
+		TeamID:          teamId,
+		BundleId:        bundleId,
+		ClientID:        ClientID,
+		Myacinfo:        myacinfo,
+		ProtocolVersion: ProtocolVersion,
+		UserLocale:      strings.Split(UserLocale, "#"),
+	}
+	return postProfile(profileDownUrl, requestParams, myacinfo)
+}
+
+// DeleteProfile delete the profile
+func DeleteProfile(Id, teamId, myacinfo string) (bool, error) {
+	requestParams := struct {
+		UrlEncodedQueryParams string `json:"urlEncodedQueryParams"`
+	}{
+		UrlEncodedQueryParams: fmt.Sprintf("teamId=%s", teamId),
+	}
+
+	postJson, err := json.Marshal(requestParams)
+	if err != nil {
+		return false, err
+	}
+
+	// header
+	JSONRequestHeader["Cookie"] = "myacinfo=" + myacinfo
+	JSONRequestHeader["X-HTTP-Method-Override"] = "DELETE"
+
+	// request
+	request := NewClientRequest(profileListUrl+"/"+Id, "POST")
+	body, code, err := request.SetHeader(JSONRequestHeader).SetBody(postJson).GetBody()
+	if err != nil {
+		return false, err
+	}
+
+	if code == 204 {
+		return true, nil
+	}
+
+	var data profileListResponse
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		return false, err
+	}
+
+	if len(data.Error) > 0 {
+		return false, errors.New(data.Error[0].Detail)
+	}
+
+	return false, errors.New("delete profile fail")
+}
+
 // ProfileLists get file
 func ProfileLists(customSearch map[string]string, teamId, myacinfo string) ([]ProfileData, error) {
-	search := BuildSearchQueryString(teamId, customSearch)
+	data, err := listProfiles(customSearch, teamId, myacinfo)
+	if err != nil {
+		return []ProfileData{}, err
+	}
+	return data.Data, nil
+}
+
+// listAllProfiles read every page of the profiles of the team
+func listAllProfiles(teamId, myacinfo string) ([]ProfileData, error) {
+	var profiles []ProfileData
+	query := firstPageQuery(teamId)
+	err := readPages(func(int) (int, int, int, error) {
+		data, err := queryProfiles(query, myacinfo)
+		if err == ErrProfileNotFound {
+			return 0, 0, 0, nil
+		}
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		profiles = append(profiles, data.Data...)
+		var total int
+		query, total = data.next(teamId, query, len(profiles))
+		return len(data.Data), total, 0, nil
+	})
+	return profiles, err
+}
 
+func listProfiles(customSearch map[string]string, teamId, myacinfo string) (profileListResponse, error) {
+	return queryProfiles(BuildSearchQueryString(teamId, customSearch), myacinfo)
+}
+
+func queryProfiles(search, myacinfo string) (profileListResponse, error) {
 	responseParams := struct {
 		UrlEncodedQueryParams string `json:"urlEncodedQueryParams"`
 	}{
@@ -124,7 +271,7 @@ func ProfileLists(customSearch map[string]string, teamId, myacinfo string) ([]Pr
 
 	postJson, err := json.Marshal(responseParams)
 	if err != nil {
-		return []ProfileData{}, err
+		return profileListResponse{}, err
 	}
 
 	// request
@@ -133,23 +280,23 @@ func ProfileLists(customSearch map[string]string, teamId, myacinfo string) ([]Pr
 	JSONRequestHeader["X-HTTP-Method-Override"] = "GET"
 	body, _, err := request.SetHeader(JSONRequestHeader).SetBody(postJson).GetBody()
 	if err != nil {
-		return []ProfileData{}, err
+		return profileListResponse{}, err
 	}
 
 	var data profileListResponse
 	err = json.Unmarshal(body, &data)
 	if err != nil {
-		return []ProfileData{}, err
+		return profileListResponse{}, err
 	}
 	if len(data.Error) > 0 {
-		return []ProfileData{}, errors.New(data.Error[0].Detail)
+		return profileListResponse{}, errors.New(data.Error[0].Detail)
 	}
 
 	if len(data.Data) <= 0 {
-		return []ProfileData{}, errors.New("Profile does not exist")
+		return profileListResponse{}, ErrProfileNotFound
 	}
 
-	return data.Data, nil
+	return data, nil
 }
 
 // GetProfileContent return base64 encode profileContent
@@ -171,3 +318,51 @@ func GetProfileContent(profileId, teamId, myacinfo string) (string, error) {
 
 	return profileContent, nil
 }
+
+// ToProvisioningProfile convert the profile list item to ProvisioningProfile
+func (p ProfileData) ToProvisioningProfile() ProvisioningProfile {
+	return ProvisioningProfile{
+		ProvisioningProfileId: p.Id,
+		Name:                  p.Attributes["name"],
+		Status:                p.Attributes["profileState"],
+		ProvisioningType:      p.Attributes["profileType"],
+		ProProPlatform:        p.Attributes["platform"],
+		UUID:                  p.Attributes["uuid"],
+		ProfileContent:        p.Attributes["profileContent"],
+	}
+}
+
+// AddDevicesToProfile regenerate the profile with its current devices and certificates plus deviceIds,
+// the profile is returned unchanged when it already contains every device
+func AddDevicesToProfile(profileId string, deviceIds []string, teamId, myacinfo string) (ProvisioningProfile, error) {
+	profiles, err := ProfileLists(map[string]string{
+		"id":    profileId,
+		"limit": "1",
+	}, teamId, myacinfo)
+	if err != nil {
+		return ProvisioningProfile{}, err
+	}
+
+	spec, err := GetProfileSpec(profiles[0], teamId, myacinfo)
+	if err != nil {
+		return ProvisioningProfile{}, err
+	}
+
+	devices := make(map[string]bool, len(spec.Devices))
+	for _, id := range spec.Devices {
+		devices[id] = true
+	}
+	changed := false
+	for _, id := range deviceIds {
+		if !devices[id] {
+			devices[id] = true
+			spec.Devices = append(spec.Devices, id)
+			changed = true
+		}
+	}
+	if !changed {
+		return profiles[0].ToProvisioningProfile(), nil
+	}
+
+	return spec.Regen(teamId, myacinfo)
+}
@@ -0,0 +1,139 @@
+package apple
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testProfileAPI team with the development profile PROF1 of APP1 holding DEV1 and CERT1
+func testProfileAPI(t *testing.T) *fakeDeveloperAPI {
+	cert := testAPICertificate(t, "CERT1", time.Now().AddDate(1, 0, 0))
+	signer := newTestIdentity(t, AppleProfileSigningCommonName, nil)
+	api := &fakeDeveloperAPI{
+		t:        t,
+		pageSize: 2,
+		certs:    []CertificateData{cert},
+		profiles: []ProfileData{testAPIProfile(t, signer, "PROF1", "IOS_APP_DEVELOPMENT", "IOS", []string{"udid1"}, cert)},
+		apps:     []AppId{{AppIDID: "APP1", Prefix: "TEAMID1234", Identifier: "com.widuu.app"}},
+		devices: []map[string]string{
+			{"deviceId": "DEV1", "deviceNumber": "udid1"},
+			{"deviceId": "DEV2", "deviceNumber": "udid2"},
+		},
+	}
+	api.serve()
+	return api
+}
+
+func TestDeleteProfile(t *testing.T) {
+	api := testProfileAPI(t)
+	if ok, err := DeleteProfile("PROF1", "TEAMID1234", "session"); !ok || err != nil {
+		t.Errorf("DeleteProfile = %v, %v", ok, err)
+	}
+	if !reflect.DeepEqual(api.deleted, []string{"profiles/PROF1"}) {
+		t.Errorf("deleted %v", api.deleted)
+	}
+	if ok, err := DeleteProfile("PROF1", "TEAMID1234", "session"); ok || err == nil || err.Error() != "There is no profile with id PROF1" {
+		t.Errorf("DeleteProfile of a deleted profile = %v, %v", ok, err)
+	}
+
+	// a failure without an error detail
+	testAPIServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, map[string]interface{}{})
+	})
+	if ok, err := DeleteProfile("PROF1", "TEAMID1234", "session"); ok || err == nil || err.Error() != "delete profile fail" {
+		t.Errorf("DeleteProfile = %v, %v, want delete profile fail", ok, err)
+	}
+}
+
+func TestProfileListsNotFound(t *testing.T) {
+	testProfileAPI(t)
+	profiles, err := ProfileLists(map[string]string{"id": "PROF1", "limit": "1"}, "TEAMID1234", "session")
+	if err != nil || len(profiles) != 1 || profiles[0].Id != "PROF1" {
+		t.Errorf("ProfileLists = %v, %v", profiles, err)
+	}
+	if _, err := ProfileLists(map[string]string{"id": "MISSING", "limit": "1"}, "TEAMID1234", "session"); err != ErrProfileNotFound {
+		t.Errorf("ProfileLists of a missing profile: %v, want ErrProfileNotFound", err)
+	}
+	if _, err := GetProfileContent("MISSING", "TEAMID1234", "session"); err != ErrProfileNotFound {
+		t.Errorf("GetProfileContent of a missing profile: %v, want ErrProfileNotFound", err)
+	}
+	if _, err := AddDevicesToProfile("MISSING", []string{"DEV2"}, "TEAMID1234", "session"); err != ErrProfileNotFound {
+		t.Errorf("AddDevicesToProfile of a missing profile: %v, want ErrProfileNotFound", err)
+	}
+}
+
+func TestRegenProfile(t *testing.T) {
+	api := testProfileAPI(t)
+	profile, err := RegenProfile("PROF1", "Development", "APP1", "limited", []string{"CERT1"}, []string{"DEV1", "DEV2"}, "TEAMID1234", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.ProvisioningProfileId != "PROF1" || profile.Name != "Development" || profile.Status != "Active" {
+		t.Errorf("RegenProfile = %+v", profile)
+	}
+	want := createProfileRequest{
+		ProvisioningProfileID:   "PROF1",
+		TeamID:                  "TEAMID1234",
+		BundleId:                "APP1",
+		Devices:                 []string{"DEV1", "DEV2"},
+		Certs:                   []string{"CERT1"},
+		DistributionType:        "limited",
+		ProvisioningProfileName: "Development",
+		ClientID:                ClientID,
+		Myacinfo:                "session",
+		ProtocolVersion:         ProtocolVersion,
+		UserLocale:              []string{"en_US"},
+	}
+	if len(api.regens) != 1 || !reflect.DeepEqual(api.regens[0], want) {
+		t.Errorf("regen request %+v, want %+v", api.regens, want)
+	}
+
+	api.regenError = "Multiple profiles found with the name 'Development'"
+	if _, err := RegenProfile("PROF1", "Development", "APP1", "limited", nil, nil, "TEAMID1234", "session"); err == nil || err.Error() != api.regenError {
+		t.Errorf("error = %v, want %s", err, api.regenError)
+	}
+}
+
+func TestDownloadTeamProfile(t *testing.T) {
+	api := testProfileAPI(t)
+	profile, err := DownloadTeamProfile("APP1", "TEAMID1234", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.ProvisioningProfileId != "TEAMAPP1" || profile.Name != "iOS Team Provisioning Profile: com.widuu.app" {
+		t.Errorf("DownloadTeamProfile = %+v", profile)
+	}
+	if _, err := DownloadTeamProfile("APP9", "TEAMID1234", "session"); err == nil || err.Error() != "No App ID with id APP9" {
+		t.Errorf("error = %v, want No App ID with id APP9", err)
+	}
+	if !reflect.DeepEqual(api.downloads, []string{"APP1", "APP9"}) {
+		t.Errorf("downloads %v", api.downloads)
+	}
+}
+
+func TestAddDevicesToProfile(t *testing.T) {
+	api := testProfileAPI(t)
+
+	// every device is already in the profile
+	profile, err := AddDevicesToProfile("PROF1", []string{"DEV1"}, "TEAMID1234", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.ProvisioningProfileId != "PROF1" || profile.UUID != "PROF1" || profile.ProfileContent == "" || len(api.regens) != 0 {
+		t.Errorf("unchanged profile %+v regenerated %d times", profile, len(api.regens))
+	}
+
+	profile, err = AddDevicesToProfile("PROF1", []string{"DEV1", "DEV2"}, "TEAMID1234", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.ProvisioningProfileId != "PROF1" || len(api.regens) != 1 {
+		t.Fatalf("profile %+v regenerated %d times", profile, len(api.regens))
+	}
+	req := api.regens[0]
+	if req.BundleId != "APP1" || req.DistributionType != "limited" || !reflect.DeepEqual(req.Certs, []string{"CERT1"}) || !reflect.DeepEqual(req.Devices, []string{"DEV1", "DEV2"}) {
+		t.Errorf("regen request %+v", req)
+	}
+}
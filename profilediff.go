@@ -0,0 +1,230 @@
+package apple
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CertificateChange developer certificate added to or removed from a profile
+type CertificateChange struct {
+	SHA1         string    `json:"sha1"`
+	CommonName   string    `json:"commonName"`
+	SerialNumber string    `json:"serialNumber"`
+	NotAfter     time.Time `json:"notAfter"`
+}
+
+// EntitlementChange entitlement key whose value changed, Old is nil when added and New is nil when removed
+type EntitlementChange struct {
+	Key string      `json:"key"`
+	Old interface{} `json:"old,omitempty"`
+	New interface{} `json:"new,omitempty"`
+}
+
+// ProfileDiff changes from Old to New profile
+type ProfileDiff struct {
+	OldUUID                 string              `json:"oldUUID"`
+	NewUUID                 string              `json:"newUUID"`
+	AddedDevices            []string            `json:"addedDevices,omitempty"`
+	RemovedDevices          []string            `json:"removedDevices,omitempty"`
+	AddedCertificates       []CertificateChange `json:"addedCertificates,omitempty"`
+	RemovedCertificates     []CertificateChange `json:"removedCertificates,omitempty"`
+	Entitlements            []EntitlementChange `json:"entitlements,omitempty"`
+	OldExpirationDate       time.Time           `json:"oldExpirationDate"`
+	NewExpirationDate       time.Time           `json:"newExpirationDate"`
+	OldTeamID               string              `json:"oldTeamID"`
+	NewTeamID               string              `json:"newTeamID"`
+	OldAppID                string              `json:"oldAppID"`
+	NewAppID                string              `json:"newAppID"`
+	OldProvisionsAllDevices bool                `json:"oldProvisionsAllDevices"`
+	NewProvisionsAllDevices bool                `json:"newProvisionsAllDevices"`
+}
+
+// DiffProfiles compare two parsed profiles
+func DiffProfiles(oldProfile, newProfile *Profile) ProfileDiff {
+	diff := ProfileDiff{
+		OldUUID:                 oldProfile.UUID,
+		NewUUID:                 newProfile.UUID,
+		OldExpirationDate:       oldProfile.ExpirationDate,
+		NewExpirationDate:       newProfile.ExpirationDate,
+		OldTeamID:               oldProfile.TeamID(),
+		NewTeamID:               newProfile.TeamID(),
+		OldAppID:                oldProfile.AppID(),
+		NewAppID:                newProfile.AppID(),
+		OldProvisionsAllDevices: oldProfile.ProvisionsAllDevices,
+		NewProvisionsAllDevices: newProfile.ProvisionsAllDevices,
+	}
+	diff.AddedDevices, diff.RemovedDevices = diffStrings(oldProfile.ProvisionedDevices, newProfile.ProvisionedDevices)
+
+	oldCerts := profileCertificates(oldProfile)
+	newCerts := profileCertificates(newProfile)
+	for sha1, c := range newCerts {
+		if _, ok := oldCerts[sha1]; !ok {
+			diff.AddedCertificates = append(diff.AddedCertificates, c)
+		}
+	}
+	for sha1, c := range oldCerts {
+		if _, ok := newCerts[sha1]; !ok {
+			diff.RemovedCertificates = append(diff.RemovedCertificates, c)
+		}
+	}
+	sortCertificateChanges(diff.AddedCertificates)
+	sortCertificateChanges(diff.RemovedCertificates)
+
+	for key, v := range oldProfile.Entitlements {
+		nv, ok := newProfile.Entitlements[key]
+		if !ok {
+			diff.Entitlements = append(diff.Entitlements, EntitlementChange{Key: key, Old: v})
+		} else if !reflect.DeepEqual(v, nv) {
+			diff.Entitlements = append(diff.Entitlements, EntitlementChange{Key: key, Old: v, New: nv})
+		}
+	}
+	for key, v := range newProfile.Entitlements {
+		if _, ok := oldProfile.Entitlements[key]; !ok {
+			diff.Entitlements = append(diff.Entitlements, EntitlementChange{Key: key, New: v})
+		}
+	}
+	sort.Slice(diff.Entitlements, func(i, j int) bool {
+		return diff.Entitlements[i].Key < diff.Entitlements[j].Key
+	})
+	return diff
+}
+
+// DiffProfileFiles compare two .mobileprovision file contents
+func DiffProfileFiles(oldData, newData []byte) (ProfileDiff, error) {
+	o, err := ParseProfile(oldData)
+	if err != nil {
+		return ProfileDiff{}, err
+	}
+	n, err := ParseProfile(newData)
+	if err != nil {
+		return ProfileDiff{}, err
+	}
+	return DiffProfiles(o, n), nil
+}
+
+// DiffProfileContents compare two base64 profileContent returned by GetProfileContent
+func DiffProfileContents(oldContent, newContent string) (ProfileDiff, error) {
+	o, err := ParseProfileContent(oldContent)
+	if err != nil {
+		return ProfileDiff{}, err
+	}
+	n, err := ParseProfileContent(newContent)
+	if err != nil {
+		return ProfileDiff{}, err
+	}
+	return DiffProfiles(o, n), nil
+}
+
+// Empty report whether the profiles have the same devices, certificates, entitlements, expiry, team and app id
+func (d ProfileDiff) Empty() bool {
+	return len(d.AddedDevices) == 0 && len(d.RemovedDevices) == 0 &&
+		len(d.AddedCertificates) == 0 && len(d.RemovedCertificates) == 0 &&
+		len(d.Entitlements) == 0 && d.OldExpirationDate.Equal(d.NewExpirationDate) &&
+		d.OldTeamID == d.NewTeamID && d.OldAppID == d.NewAppID &&
+		d.OldProvisionsAllDevices == d.NewProvisionsAllDevices
+}
+
+// JSON return the diff as indented json
+func (d ProfileDiff) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// String return the human-readable diff
+func (d ProfileDiff) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", d.OldUUID, d.NewUUID)
+	if d.Empty() {
+		b.WriteString("no changes\n")
+		return b.String()
+	}
+	if !d.OldExpirationDate.Equal(d.NewExpirationDate) {
+		fmt.Fprintf(&b, "expiration: %s -> %s\n", d.OldExpirationDate.Format(time.RFC3339), d.NewExpirationDate.Format(time.RFC3339))
+	}
+	if d.OldTeamID != d.NewTeamID {
+		fmt.Fprintf(&b, "team: %s -> %s\n", d.OldTeamID, d.NewTeamID)
+	}
+	if d.OldAppID != d.NewAppID {
+		fmt.Fprintf(&b, "app id: %s -> %s\n", d.OldAppID, d.NewAppID)
+	}
+	if d.OldProvisionsAllDevices != d.NewProvisionsAllDevices {
+		fmt.Fprintf(&b, "provisions all devices: %v -> %v\n", d.OldProvisionsAllDevices, d.NewProvisionsAllDevices)
+	}
+	if len(d.AddedDevices) > 0 || len(d.RemovedDevices) > 0 {
+		b.WriteString("devices:\n")
+		for _, udid := range d.AddedDevices {
+			fmt.Fprintf(&b, "  + %s\n", udid)
+		}
+		for _, udid := range d.RemovedDevices {
+			fmt.Fprintf(&b, "  - %s\n", udid)
+		}
+	}
+	if len(d.AddedCertificates) > 0 || len(d.RemovedCertificates) > 0 {
+		b.WriteString("certificates:\n")
+		for _, c := range d.AddedCertificates {
+			fmt.Fprintf(&b, "  + %s %s (expires %s)\n", c.SHA1, c.CommonName, c.NotAfter.Format("2006-01-02"))
+		}
+		for _, c := range d.RemovedCertificates {
+			fmt.Fprintf(&b, "  - %s %s (expires %s)\n", c.SHA1, c.CommonName, c.NotAfter.Format("2006-01-02"))
+		}
+	}
+	if len(d.Entitlements) > 0 {
+		b.WriteString("entitlements:\n")
+		for _, e := range d.Entitlements {
+			switch {
+			case e.Old == nil:
+				fmt.Fprintf(&b, "  + %s: %v\n", e.Key, e.New)
+			case e.New == nil:
+				fmt.Fprintf(&b, "  - %s: %v\n", e.Key, e.Old)
+			default:
+				fmt.Fprintf(&b, "  ~ %s: %v -> %v\n", e.Key, e.Old, e.New)
+			}
+		}
+	}
+	return b.String()
+}
+
+// profileCertificates developer certificates keyed by SHA1
+func profileCertificates(p *Profile) map[string]CertificateChange {
+	res := make(map[string]CertificateChange, len(p.DeveloperCertificates))
+	for _, cert := range p.DeveloperCertificates {
+		info := GetCertificateInfo(cert)
+		res[info.SHA1] = CertificateChange{
+			SHA1:         info.SHA1,
+			CommonName:   info.CommonName,
+			SerialNumber: info.SerialNumber,
+			NotAfter:     info.NotAfter,
+		}
+	}
+	return res
+}
+
+func sortCertificateChanges(list []CertificateChange) {
+	sort.Slice(list, func(i, j int) bool { return list[i].SHA1 < list[j].SHA1 })
+}
+
+// diffStrings return the values only in newValues and the values only in oldValues, sorted
+func diffStrings(oldValues, newValues []string) (added, removed []string) {
+	oldSet := make(map[string]bool, len(oldValues))
+	for _, v := range oldValues {
+		oldSet[v] = true
+	}
+	newSet := make(map[string]bool, len(newValues))
+	for _, v := range newValues {
+		newSet[v] = true
+		if !oldSet[v] {
+			added = append(added, v)
+		}
+	}
+	for _, v := range oldValues {
+		if !newSet[v] {
+			removed = append(removed, v)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
@@ -0,0 +1,72 @@
+package apple
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffProfiles(t *testing.T) {
+	expires := time.Date(2027, 1, 2, 3, 4, 5, 0, time.UTC)
+	oldProfile := &Profile{
+		UUID:               testUUID1,
+		TeamIdentifier:     []string{"TEAMID1234"},
+		ExpirationDate:     expires,
+		ProvisionedDevices: []string{"A", "B"},
+		Entitlements: map[string]interface{}{
+			"application-identifier": "TEAMID1234.com.example.app",
+			"get-task-allow":         true,
+		},
+	}
+	newProfile := &Profile{
+		UUID:                 testUUID2,
+		TeamIdentifier:       []string{"TEAMID5678"},
+		ExpirationDate:       expires,
+		ProvisionsAllDevices: true,
+		Entitlements: map[string]interface{}{
+			"application-identifier": "TEAMID5678.com.example.app",
+			"get-task-allow":         true,
+		},
+	}
+
+	diff := DiffProfiles(oldProfile, newProfile)
+	if diff.Empty() {
+		t.Fatal("diff is empty")
+	}
+	if diff.OldTeamID != "TEAMID1234" || diff.NewTeamID != "TEAMID5678" {
+		t.Errorf("team = %s -> %s", diff.OldTeamID, diff.NewTeamID)
+	}
+	if diff.OldAppID != "TEAMID1234.com.example.app" || diff.NewAppID != "TEAMID5678.com.example.app" {
+		t.Errorf("app id = %s -> %s", diff.OldAppID, diff.NewAppID)
+	}
+	if diff.OldProvisionsAllDevices || !diff.NewProvisionsAllDevices {
+		t.Errorf("provisions all devices = %v -> %v", diff.OldProvisionsAllDevices, diff.NewProvisionsAllDevices)
+	}
+	if !reflect.DeepEqual(diff.RemovedDevices, []string{"A", "B"}) {
+		t.Errorf("RemovedDevices = %v", diff.RemovedDevices)
+	}
+
+	text := diff.String()
+	for _, want := range []string{"team: TEAMID1234 -> TEAMID5678", "app id: TEAMID1234.com.example.app -> TEAMID5678.com.example.app", "provisions all devices: false -> true"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("String() missing %q:\n%s", want, text)
+		}
+	}
+	data, err := diff.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ProfileDiff
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.NewProvisionsAllDevices || decoded.NewAppID != diff.NewAppID {
+		t.Errorf("json round trip = %+v", decoded)
+	}
+
+	if same := DiffProfiles(oldProfile, oldProfile); !same.Empty() || !strings.Contains(same.String(), "no changes") {
+		t.Errorf("diff of the same profile = %s", same)
+	}
+}
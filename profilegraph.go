@@ -0,0 +1,256 @@
+package apple
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// profile relationships requested by ProfileGraphs
+const profileIncludes = "bundleId,certificates,devices"
+
+// ResourceIdentifier type and id of a related resource
+type ResourceIdentifier struct {
+	Type string `json:"type"`
+	Id   string `json:"id"`
+}
+
+// Relationship to-one or to-many relationship of a resource
+type Relationship struct {
+	Data json.RawMessage `json:"data"`
+}
+
+// Identifiers return the related resource identifiers
+func (r Relationship) Identifiers() ([]ResourceIdentifier, error) {
+	if len(r.Data) == 0 || string(r.Data) == "null" {
+		return nil, nil
+	}
+	if r.Data[0] == '[' {
+		var ids []ResourceIdentifier
+		err := json.Unmarshal(r.Data, &ids)
+		return ids, err
+	}
+	var id ResourceIdentifier
+	if err := json.Unmarshal(r.Data, &id); err != nil {
+		return nil, err
+	}
+	return []ResourceIdentifier{id}, nil
+}
+
+// Resource included resource of a list response
+type Resource struct {
+	Type       string                 `json:"type"`
+	Id         string                 `json:"id"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// String return the string attribute
+func (r Resource) String(key string) string {
+	v, _ := r.Attributes[key].(string)
+	return v
+}
+
+// stringAttributes return the attributes with string values, booleans and numbers are formatted
+func stringAttributes(attributes map[string]interface{}) map[string]string {
+	res := make(map[string]string, len(attributes))
+	for k, v := range attributes {
+		switch t := v.(type) {
+		case string:
+			res[k] = t
+		case bool:
+			res[k] = strconv.FormatBool(t)
+		case float64:
+			// large numbers such as ids are formatted without an exponent
+			res[k] = strconv.FormatFloat(t, 'f', -1, 64)
+		}
+	}
+	return res
+}
+
+// ProfileAttributes typed profile attributes
+type ProfileAttributes struct {
+	Name           string
+	Platform       string
+	ProfileType    string
+	ProfileState   string
+	UUID           string
+	ProfileContent string
+	CreatedDate    time.Time
+	ExpirationDate time.Time
+}
+
+// TypedAttributes return the typed profile attributes
+func (p ProfileData) TypedAttributes() ProfileAttributes {
+	return ProfileAttributes{
+		Name:           p.Attributes["name"],
+		Platform:       p.Attributes["platform"],
+		ProfileType:    p.Attributes["profileType"],
+		ProfileState:   p.Attributes["profileState"],
+		UUID:           p.Attributes["uuid"],
+		ProfileContent: p.Attributes["profileContent"],
+		CreatedDate:    parseAPIDate(p.Attributes["createdDate"]),
+		ExpirationDate: parseAPIDate(p.Attributes["expirationDate"]),
+	}
+}
+
+// BundleIDAttributes typed bundle id attributes
+type BundleIDAttributes struct {
+	Name       string
+	Identifier string
+	Platform   string
+	SeedID     string
+}
+
+// BundleIDResource bundle id related to a profile
+type BundleIDResource struct {
+	Id         string
+	Attributes BundleIDAttributes
+}
+
+func newBundleIDResource(res Resource) *BundleIDResource {
+	attrs := stringAttributes(res.Attributes)
+	return &BundleIDResource{
+		Id: res.Id,
+		Attributes: BundleIDAttributes{
+			Name:       attrs["name"],
+			Identifier: attrs["identifier"],
+			Platform:   attrs["platform"],
+			SeedID:     attrs["seedId"],
+		},
+	}
+}
+
+// DeviceAttributes typed device attributes
+type DeviceAttributes struct {
+	Name        string
+	UDID        string
+	DeviceClass string
+	Model       string
+	Platform    string
+	Status      string
+	AddedDate   time.Time
+}
+
+// DeviceResource device related to a profile
+type DeviceResource struct {
+	Id         string
+	Attributes DeviceAttributes
+}
+
+func newDeviceResource(res Resource) DeviceResource {
+	attrs := stringAttributes(res.Attributes)
+	return DeviceResource{
+		Id: res.Id,
+		Attributes: DeviceAttributes{
+			Name:        attrs["name"],
+			UDID:        attrs["udid"],
+			DeviceClass: attrs["deviceClass"],
+			Model:       attrs["model"],
+			Platform:    attrs["platform"],
+			Status:      attrs["status"],
+			AddedDate:   parseAPIDate(attrs["addedDate"]),
+		},
+	}
+}
+
+// ProfileGraph profile with its bundle id, certificates and devices
+type ProfileGraph struct {
+	Id           string
+	Attributes   ProfileAttributes
+	BundleID     *BundleIDResource
+	Certificates []CertificateData
+	Devices      []DeviceResource
+	// Profile the list item the graph was built from
+	Profile ProfileData
+}
+
+// apple api date layouts
+var apiDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05.000-0700",
+	"2006-01-02T15:04:05-0700",
+}
+
+func parseAPIDate(value string) time.Time {
+	for _, layout := range apiDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// ProfileGraphs list profiles including the related bundle id, certificates and devices
+func ProfileGraphs(customSearch map[string]string, teamId, myacinfo string) ([]ProfileGraph, error) {
+	search := map[string]string{"include": profileIncludes}
+	for k, v := range customSearch {
+		search[k] = v
+	}
+	data, err := listProfiles(search, teamId, myacinfo)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildProfileGraphs(data)
+}
+
+// buildProfileGraphs resolve the relationships of the listed profiles from the included resources
+func buildProfileGraphs(data profileListResponse) ([]ProfileGraph, error) {
+	included := make(map[ResourceIdentifier]Resource, len(data.Included))
+	for _, res := range data.Included {
+		included[ResourceIdentifier{res.Type, res.Id}] = res
+	}
+	related := func(profile ProfileData, name string, rel Relationship) ([]Resource, error) {
+		ids, err := rel.Identifiers()
+		if err != nil {
+			return nil, fmt.Errorf("profile %s relationship %s: %v", profile.Id, name, err)
+		}
+		res := make([]Resource, 0, len(ids))
+		for _, id := range ids {
+			r, ok := included[id]
+			if !ok {
+				r = Resource{Type: id.Type, Id: id.Id}
+			}
+			res = append(res, r)
+		}
+		return res, nil
+	}
+
+	graphs := make([]ProfileGraph, 0, len(data.Data))
+	for _, profile := range data.Data {
+		graph := ProfileGraph{
+			Id:         profile.Id,
+			Attributes: profile.TypedAttributes(),
+			Profile:    profile,
+		}
+
+		bundles, err := related(profile, "bundleId", profile.Relationships.BundleId)
+		if err != nil {
+			return nil, err
+		}
+		if len(bundles) > 0 {
+			graph.BundleID = newBundleIDResource(bundles[0])
+		}
+		certs, err := related(profile, "certificates", profile.Relationships.Certificates)
+		if err != nil {
+			return nil, err
+		}
+		for _, res := range certs {
+			graph.Certificates = append(graph.Certificates, CertificateData{
+				CertType:   res.Type,
+				Id:         res.Id,
+				Attributes: stringAttributes(res.Attributes),
+			})
+		}
+		devices, err := related(profile, "devices", profile.Relationships.Devices)
+		if err != nil {
+			return nil, err
+		}
+		for _, res := range devices {
+			graph.Devices = append(graph.Devices, newDeviceResource(res))
+		}
+		graphs = append(graphs, graph)
+	}
+	return graphs, nil
+}
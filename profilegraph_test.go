@@ -0,0 +1,108 @@
+package apple
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testProfileListResponse = `{
+  "data": [{
+    "type": "profiles",
+    "id": "PROFILE1",
+    "attributes": {
+      "name": "App Development",
+      "platform": "IOS",
+      "profileType": "IOS_APP_DEVELOPMENT",
+      "profileState": "ACTIVE",
+      "uuid": "0f6e2c8e-5f3a-4a57-9f1b-4d2f1f3a9b10",
+      "createdDate": "2026-01-02T03:04:05.000+0000",
+      "expirationDate": "2027-01-02T03:04:05.000+0000",
+      "isOfflineProfile": false,
+      "certificateCount": 2,
+      "profileContent": null
+    },
+    "relationships": {
+      "bundleId": {"data": {"type": "bundleIds", "id": "BUNDLE1"}},
+      "certificates": {"data": [{"type": "certificates", "id": "CERT1"}]},
+      "devices": {"data": [{"type": "devices", "id": "DEVICE1"}, {"type": "devices", "id": "DEVICE2"}]}
+    }
+  }],
+  "included": [
+    {"type": "bundleIds", "id": "BUNDLE1", "attributes": {"name": "App", "identifier": "com.example.app", "platform": "IOS", "seedId": "TEAMID1234"}},
+    {"type": "certificates", "id": "CERT1", "attributes": {"name": "Apple Development", "certificateType": "DEVELOPMENT", "activated": true}},
+    {"type": "devices", "id": "DEVICE1", "attributes": {"name": "iPhone", "udid": "00008030-001", "deviceClass": "IPHONE", "status": "ENABLED", "addedDate": "2026-01-02T03:04:05.000+0000"}}
+  ]
+}`
+
+func TestBuildProfileGraphs(t *testing.T) {
+	var data profileListResponse
+	if err := json.Unmarshal([]byte(testProfileListResponse), &data); err != nil {
+		t.Fatal(err)
+	}
+	profile := data.Data[0]
+	if profile.Attributes["isOfflineProfile"] != "false" || profile.Attributes["certificateCount"] != "2" {
+		t.Errorf("non string attributes = %q, %q", profile.Attributes["isOfflineProfile"], profile.Attributes["certificateCount"])
+	}
+	if _, ok := profile.Attributes["profileContent"]; ok {
+		t.Error("null attribute kept")
+	}
+
+	graphs, err := buildProfileGraphs(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graphs) != 1 {
+		t.Fatalf("got %d graphs, want 1", len(graphs))
+	}
+	graph := graphs[0]
+	want := time.Date(2027, 1, 2, 3, 4, 5, 0, time.UTC)
+	if graph.Attributes.Name != "App Development" || !graph.Attributes.ExpirationDate.Equal(want) {
+		t.Errorf("Attributes = %+v", graph.Attributes)
+	}
+	if graph.BundleID == nil || graph.BundleID.Attributes.Identifier != "com.example.app" || graph.BundleID.Attributes.SeedID != "TEAMID1234" {
+		t.Errorf("BundleID = %+v", graph.BundleID)
+	}
+	if len(graph.Certificates) != 1 || graph.Certificates[0].Attributes["activated"] != "true" {
+		t.Errorf("Certificates = %+v", graph.Certificates)
+	}
+	if len(graph.Devices) != 2 {
+		t.Fatalf("got %d devices, want 2", len(graph.Devices))
+	}
+	if d := graph.Devices[0]; d.Attributes.UDID != "00008030-001" || d.Attributes.Status != "ENABLED" || d.Attributes.AddedDate.IsZero() {
+		t.Errorf("included device = %+v", d)
+	}
+	// not included, only the identifier is known
+	if d := graph.Devices[1]; d.Id != "DEVICE2" || d.Attributes.UDID != "" {
+		t.Errorf("device without attributes = %+v", d)
+	}
+}
+
+func TestBuildProfileGraphsInvalidRelationship(t *testing.T) {
+	data := profileListResponse{Data: []ProfileData{{
+		Id:            "PROFILE1",
+		Relationships: ProfileRelationships{Devices: Relationship{Data: json.RawMessage(`"DEVICE1"`)}},
+	}}}
+	if _, err := buildProfileGraphs(data); err == nil {
+		t.Error("accepted an invalid relationship")
+	}
+}
+
+func TestStringAttributes(t *testing.T) {
+	var profile ProfileData
+	data := `{"id":"PROFILE1","attributes":{"name":"App","offline":true,"count":2,"ratio":0.5,"serial":1e21,"deleted":null,"tags":["a"]}}`
+	if err := json.Unmarshal([]byte(data), &profile); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"name":    "App",
+		"offline": "true",
+		"count":   "2",
+		"ratio":   "0.5",
+		"serial":  "1000000000000000000000",
+	}
+	if !reflect.DeepEqual(profile.Attributes, want) {
+		t.Errorf("Attributes = %v, want %v", profile.Attributes, want)
+	}
+}
@@ -0,0 +1,124 @@
+package apple
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/widuu/apple/pkcs12"
+)
+
+// ProvisionOptions certificate provisioning options
+type ProvisionOptions struct {
+	CSROptions
+	// CertificateType apple certificate type, e.g. IOS_DEVELOPMENT, IOS_DISTRIBUTION
+	CertificateType string
+	// P12Password password of the exported PKCS#12
+	P12Password string
+	// KeyPassphrase encrypt the returned PrivateKey PEM when set
+	KeyPassphrase string
+	// KeyStore save the private key when set
+	KeyStore KeyStore
+	// Revocation revoke a certificate when the certificate limit is reached
+	Revocation *RevocationPolicy
+}
+
+// SigningIdentity certificate, private key and PKCS#12 returned by ProvisionCertificate
+type SigningIdentity struct {
+	Certificate CertificateData
+	X509        *x509.Certificate
+	Key         crypto.Signer
+	// PrivateKey PEM text, encrypted PKCS8 when KeyPassphrase is set,
+	// PrivateKey and P12 are empty when the key is held by an external signer
+	PrivateKey string
+	P12        []byte
+}
+
+// ProvisionCertificate generate CSR, create and download the certificate and export it to p12,
+// the certificate is revoked when a step after creation fails
+func ProvisionCertificate(opts ProvisionOptions, teamId, myacinfo string) (SigningIdentity, error) {
+	if opts.CertificateType == "" {
+		return SigningIdentity{}, errors.New("certificate type is empty")
+	}
+
+	csrContent, key, err := GenerateCertificateSigningRequest(opts.CSROptions)
+	if err != nil {
+		return SigningIdentity{}, err
+	}
+
+	var certData CertificateData
+	if opts.Revocation != nil {
+		certData, err = CreateCertificateWithPolicy(opts.CertificateType, csrContent, opts.Revocation, teamId, myacinfo)
+	} else {
+		certData, err = CreateCertificate(opts.CertificateType, csrContent, teamId, myacinfo)
+	}
+	if err != nil {
+		return SigningIdentity{}, err
+	}
+
+	identity, err := completeSigningIdentity(certData, key, opts, teamId, myacinfo)
+	if err != nil {
+		if _, revokeErr := DeleteCertficate(certData.Id, teamId, myacinfo); revokeErr != nil {
+			return SigningIdentity{}, fmt.Errorf("%v; revoke certificate %s: %v", err, certData.Id, revokeErr)
+		}
+		return SigningIdentity{}, err
+	}
+	return identity, nil
+}
+
+func completeSigningIdentity(certData CertificateData, key crypto.Signer, opts ProvisionOptions, teamId, myacinfo string) (SigningIdentity, error) {
+	// download the certificate if the create response has no content
+	if certData.Attributes["certificateContent"] == "" {
+		certs, err := CertLists(map[string]string{"id": certData.Id, "limit": "1"}, teamId, myacinfo)
+		if err != nil {
+			return SigningIdentity{}, err
+		}
+		certData = certs[0]
+	}
+
+	cert, err := certData.Certificate()
+	if err != nil {
+		return SigningIdentity{}, err
+	}
+	keyID, err := PublicKeyHash(key.Public())
+	if err != nil {
+		return SigningIdentity{}, err
+	}
+	if CertificateKeyHash(cert) != keyID {
+		return SigningIdentity{}, errors.New("certificate does not match the private key")
+	}
+
+	identity := SigningIdentity{Certificate: certData, X509: cert, Key: key}
+
+	// keys held by an external signer can not be exported
+	switch key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+	default:
+		return identity, nil
+	}
+
+	if opts.KeyPassphrase != "" {
+		identity.PrivateKey, err = EncryptPrivateKey(key, opts.KeyPassphrase)
+	} else {
+		identity.PrivateKey, err = EncodePrivateKey(key)
+	}
+	if err != nil {
+		return SigningIdentity{}, err
+	}
+
+	identity.P12, err = pkcs12.Encode(cert.Raw, key, opts.P12Password)
+	if err != nil {
+		return SigningIdentity{}, err
+	}
+
+	if opts.KeyStore != nil {
+		if _, err := opts.KeyStore.Put(key); err != nil {
+			return SigningIdentity{}, err
+		}
+	}
+
+	return identity, nil
+}
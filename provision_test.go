@@ -0,0 +1,232 @@
+package apple
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/widuu/apple/pkcs12"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// testAPIServer send the requests of the package to handler for the duration of the test
+func testAPIServer(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	transport, defaultTransport := server.Client().Transport, http.DefaultTransport
+	http.DefaultTransport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		u := *req.URL
+		u.Scheme, u.Host = "http", server.Listener.Addr().String()
+		req = req.Clone(req.Context())
+		req.URL = &u
+		return transport.RoundTrip(req)
+	})
+	t.Cleanup(func() {
+		http.DefaultTransport = defaultTransport
+		server.Close()
+	})
+}
+
+// apiMethod return the method of a developer API request, the API sends every request as POST
+func apiMethod(r *http.Request) string {
+	if method := r.Header.Get("X-HTTP-Method-Override"); method != "" {
+		return method
+	}
+	return r.Method
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v interface{}) {
+	t.Helper()
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		t.Error(err)
+	}
+}
+
+func apiError(detail string) map[string]interface{} {
+	return map[string]interface{}{"errors": []map[string]string{{"detail": detail}}}
+}
+
+// readCreateCertificate return the attributes of a create certificate request,
+// handlers run outside the test goroutine so errors are reported with t.Error
+func readCreateCertificate(t *testing.T, r *http.Request) map[string]string {
+	t.Helper()
+	var req createCertificatRequest
+	body, _ := ioutil.ReadAll(r.Body)
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Errorf("create certificate request %s: %v", body, err)
+	}
+	return req.Data.Attributes
+}
+
+// testIssueCertificate return the base64 certificate Apple issues for the PEM CSR
+func testIssueCertificate(t *testing.T, csrContent string) string {
+	t.Helper()
+	block, _ := pem.Decode([]byte(csrContent))
+	if block == nil {
+		t.Errorf("not a PEM certificate request: %q", csrContent)
+		return ""
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Error(err)
+		return ""
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(7),
+		Subject:      pkix.Name{CommonName: "Apple Development: " + csr.Subject.CommonName, OrganizationalUnit: []string{"TEAMID1234"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+	}
+	ca, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Error(err)
+		return ""
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, csr.PublicKey, ca)
+	if err != nil {
+		t.Error(err)
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+// testProvisionOptions development certificate options with an EC key
+func testProvisionOptions(store KeyStore) ProvisionOptions {
+	return ProvisionOptions{
+		CSROptions:      CSROptions{CommonName: "dev", KeyType: ECDSAP256},
+		CertificateType: "IOS_DEVELOPMENT",
+		P12Password:     "p12pass",
+		KeyPassphrase:   "secret",
+		KeyStore:        store,
+	}
+}
+
+func TestProvisionCertificate(t *testing.T) {
+	for _, download := range []bool{false, true} {
+		var issued string
+		testAPIServer(t, func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case apiMethod(r) == "POST" && r.URL.Path == "/services/v1/certificates":
+				attributes := readCreateCertificate(t, r)
+				if attributes["certificateType"] != "IOS_DEVELOPMENT" || attributes["teamId"] != "TEAMID1234" {
+					t.Errorf("create attributes = %v", attributes)
+				}
+				issued = testIssueCertificate(t, attributes["csrContent"])
+				created := CertificateData{CertType: "certificates", Id: "CERT1", Attributes: map[string]string{"certificateContent": issued}}
+				if download {
+					created.Attributes = map[string]string{}
+				}
+				writeJSON(t, w, map[string]interface{}{"data": created})
+			case apiMethod(r) == "GET" && r.URL.Path == "/services/v1/certificates" && download:
+				if body, _ := ioutil.ReadAll(r.Body); !strings.Contains(string(body), "filter[id]=CERT1") {
+					t.Errorf("download request %s", body)
+				}
+				writeJSON(t, w, map[string]interface{}{"data": []CertificateData{{CertType: "certificates", Id: "CERT1", Attributes: map[string]string{"certificateContent": issued}}}})
+			default:
+				t.Errorf("unexpected %s %s", apiMethod(r), r.URL.Path)
+				http.NotFound(w, r)
+			}
+		})
+
+		store := NewMemoryKeyStore()
+		identity, err := ProvisionCertificate(testProvisionOptions(store), "TEAMID1234", "session")
+		if err != nil {
+			t.Fatalf("download %v: %v", download, err)
+		}
+		if identity.Certificate.Id != "CERT1" || identity.X509.Subject.CommonName != "Apple Development: dev" {
+			t.Errorf("identity certificate %s %q", identity.Certificate.Id, identity.X509.Subject.CommonName)
+		}
+		if !strings.Contains(identity.PrivateKey, "ENCRYPTED PRIVATE KEY") {
+			t.Errorf("private key is not encrypted: %q", identity.PrivateKey)
+		}
+		key, cert, err := pkcs12.Decode(identity.P12, "p12pass")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cert.Equal(identity.X509) || !identity.Key.(*ecdsa.PrivateKey).Equal(key) {
+			t.Error("p12 holds a different identity")
+		}
+		id, _ := PublicKeyHash(identity.Key.Public())
+		if _, err := store.Get(id); err != nil {
+			t.Errorf("key not saved in the key store: %v", err)
+		}
+	}
+}
+
+func TestProvisionCertificateRejected(t *testing.T) {
+	testAPIServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if apiMethod(r) != "POST" {
+			t.Errorf("unexpected %s %s", apiMethod(r), r.URL.Path)
+		}
+		writeJSON(t, w, apiError("Invalid CSR"))
+	})
+	store := NewMemoryKeyStore()
+	if _, err := ProvisionCertificate(testProvisionOptions(store), "TEAMID1234", "session"); err == nil || err.Error() != "Invalid CSR" {
+		t.Errorf("error = %v, want Invalid CSR", err)
+	}
+	if ids, _ := store.List(); len(ids) != 0 {
+		t.Errorf("key of a rejected request saved: %v", ids)
+	}
+	if _, err := ProvisionCertificate(ProvisionOptions{CSROptions: CSROptions{CommonName: "dev"}}, "TEAMID1234", "session"); err == nil {
+		t.Error("provisioned without a certificate type")
+	}
+}
+
+func TestProvisionCertificateRevoke(t *testing.T) {
+	tests := []struct {
+		name    string
+		revoke  func(w http.ResponseWriter)
+		wantErr string
+	}{
+		{"revoked", func(w http.ResponseWriter) { w.WriteHeader(http.StatusNoContent) }, "certificate does not match the private key"},
+		{"revoke fails", func(w http.ResponseWriter) { writeJSON(t, w, apiError("Forbidden")) }, "certificate does not match the private key; revoke certificate CERT1: Forbidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a certificate of another key
+			mismatched := testCertificateData(t, "CERT1", testECKey(t))
+			revoked := false
+			testAPIServer(t, func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case apiMethod(r) == "POST" && r.URL.Path == "/services/v1/certificates":
+					readCreateCertificate(t, r)
+					writeJSON(t, w, map[string]interface{}{"data": mismatched})
+				case apiMethod(r) == "DELETE" && r.URL.Path == "/services/v1/certificates/CERT1":
+					revoked = true
+					tt.revoke(w)
+				default:
+					t.Errorf("unexpected %s %s", apiMethod(r), r.URL.Path)
+					http.NotFound(w, r)
+				}
+			})
+			store := NewMemoryKeyStore()
+			_, err := ProvisionCertificate(testProvisionOptions(store), "TEAMID1234", "session")
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("error = %v, want %s", err, tt.wantErr)
+			}
+			if !revoked {
+				t.Error("certificate not revoked")
+			}
+			if ids, _ := store.List(); len(ids) != 0 {
+				t.Errorf("key of a revoked certificate saved: %v", ids)
+			}
+		})
+	}
+}
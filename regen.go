@@ -0,0 +1,126 @@
+package apple
+
+import (
+	"errors"
+	"strings"
+)
+
+// profile type to createProvisioningProfile distributionType
+var distributionTypes = map[string]string{
+	"DEVELOPMENT": "limited",
+	"ADHOC":       "adhoc",
+	"STORE":       "store",
+	"INHOUSE":     "inhouse",
+	"DIRECT":      "direct",
+}
+
+// DistributionType return createProvisioningProfile distributionType of a profileType such as IOS_APP_ADHOC
+func DistributionType(profileType string) string {
+	idx := strings.LastIndex(profileType, "_")
+	return distributionTypes[profileType[idx+1:]]
+}
+
+// ProfileSpec createProvisioningProfile parameters of an existing profile
+type ProfileSpec struct {
+	ProfileId        string
+	Name             string
+	BundleId         string
+	DistributionType string
+	Certs            []string
+	Devices          []string
+}
+
+// GetProfileSpec resolve the app id, certificate ids and device ids of the profile
+func GetProfileSpec(profile ProfileData, teamId, myacinfo string) (ProfileSpec, error) {
+	return newProfileResolver(teamId, myacinfo).spec(profile)
+}
+
+// profileResolver load app ids, certificates and devices once for several profiles
+type profileResolver struct {
+	teamId   string
+	myacinfo string
+	apps     []AppId
+	certs    []CertificateData
+	devices  []map[string]string
+	loaded   bool
+}
+
+func newProfileResolver(teamId, myacinfo string) *profileResolver {
+	return &profileResolver{teamId: teamId, myacinfo: myacinfo}
+}
+
+func (r *profileResolver) load() error {
+	if r.loaded {
+		return nil
+	}
+	apps, err := listAllAppIds(r.myacinfo, r.teamId)
+	if err != nil {
+		return err
+	}
+	certs, err := listAllCertificates(r.teamId, r.myacinfo)
+	if err != nil {
+		return err
+	}
+	devices, err := listAllDevices(r.teamId, r.myacinfo)
+	if err != nil {
+		return err
+	}
+	r.apps, r.certs, r.devices, r.loaded = apps, certs, devices, true
+	return nil
+}
+
+func (r *profileResolver) spec(profile ProfileData) (ProfileSpec, error) {
+	parsed, err := ParseProfileContent(profile.Attributes["profileContent"])
+	if err != nil {
+		return ProfileSpec{}, err
+	}
+	if err := r.load(); err != nil {
+		return ProfileSpec{}, err
+	}
+	spec := ProfileSpec{
+		ProfileId:        profile.Id,
+		Name:             profile.Attributes["name"],
+		DistributionType: DistributionType(profile.Attributes["profileType"]),
+	}
+
+	// app id
+	appIdentifier := parsed.AppID()
+	for _, app := range r.apps {
+		if app.Prefix+"."+app.Identifier == appIdentifier {
+			spec.BundleId = app.AppIDID
+			break
+		}
+	}
+	if spec.BundleId == "" {
+		return ProfileSpec{}, errors.New("app id not found: " + appIdentifier)
+	}
+
+	// certificates
+	for _, c := range r.certs {
+		cert, err := c.Certificate()
+		if err != nil {
+			continue
+		}
+		if parsed.HasCertificate(cert) {
+			spec.Certs = append(spec.Certs, c.Id)
+		}
+	}
+
+	// devices
+	deviceIds := make(map[string]string, len(r.devices))
+	for _, device := range r.devices {
+		deviceIds[device["deviceNumber"]] = device["deviceId"]
+	}
+	for _, udid := range parsed.ProvisionedDevices {
+		if id, ok := deviceIds[udid]; ok {
+			spec.Devices = append(spec.Devices, id)
+		}
+	}
+
+	return spec, nil
+}
+
+// Regen regenerate the profile with the spec
+func (s ProfileSpec) Regen(teamId, myacinfo string) (ProvisioningProfile, error) {
+	return RegenProfile(s.ProfileId, s.Name, s.BundleId, s.DistributionType, s.Certs, s.Devices, teamId, myacinfo)
+}
@@ -0,0 +1,147 @@
+package apple
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ExpiringCertificate certificate expiring within the window and the profiles referencing it
+type ExpiringCertificate struct {
+	Certificate CertificateData
+	Info        CertificateInfo
+	Profiles    []ProfileData
+}
+
+// RotationPlan certificates to rotate
+type RotationPlan struct {
+	Window   time.Duration
+	Expiring []ExpiringCertificate
+}
+
+// RotationOptions replacement certificate options
+type RotationOptions struct {
+	// ProvisionOptions of the replacement, CertificateType defaults to the old certificate type
+	ProvisionOptions
+	// Revoke revoke the old certificate after the profiles are regenerated
+	Revoke bool
+}
+
+// RotationResult rotation of one certificate
+type RotationResult struct {
+	Old         CertificateData
+	Replacement SigningIdentity
+	Profiles    []ProvisioningProfile
+	Revoked     bool
+}
+
+// PlanCertificateRotation report certificates expiring within window and the profiles referencing each one
+func PlanCertificateRotation(window time.Duration, teamId, myacinfo string) (RotationPlan, error) {
+	plan := RotationPlan{Window: window}
+
+	certs, err := listAllCertificates(teamId, myacinfo)
+	if err != nil {
+		return RotationPlan{}, err
+	}
+
+	references, err := certificateProfiles(teamId, myacinfo)
+	if err != nil {
+		return RotationPlan{}, err
+	}
+
+	for _, c := range certs {
+		info, err := c.Info()
+		if err != nil {
+			return RotationPlan{}, err
+		}
+		if !info.ExpiresWithin(window) {
+			continue
+		}
+		plan.Expiring = append(plan.Expiring, ExpiringCertificate{
+			Certificate: c,
+			Info:        info,
+			Profiles:    references[info.SHA1],
+		})
+	}
+
+	sort.Slice(plan.Expiring, func(i, j int) bool {
+		return plan.Expiring[i].Info.NotAfter.Before(plan.Expiring[j].Info.NotAfter)
+	})
+	return plan, nil
+}
+
+// certificateProfiles map certificate SHA1 fingerprint to the profiles referencing it
+func certificateProfiles(teamId, myacinfo string) (map[string][]ProfileData, error) {
+	profiles, err := listAllProfiles(teamId, myacinfo)
+	if err != nil {
+		return nil, err
+	}
+	res := map[string][]ProfileData{}
+	for _, profile := range profiles {
+		// profiles which can not be read reference nothing
+		parsed, err := ParseProfileContent(profile.Attributes["profileContent"])
+		if err != nil {
+			continue
+		}
+		for _, cert := range parsed.DeveloperCertificates {
+			fingerprint := GetCertificateInfo(cert).SHA1
+			res[fingerprint] = append(res[fingerprint], profile)
+		}
+	}
+	return res, nil
+}
+
+// Execute create a replacement for every expiring certificate, regenerate the profiles
+// referencing it and revoke the old certificate when opts.Revoke is set
+func (p RotationPlan) Execute(opts RotationOptions, teamId, myacinfo string) ([]RotationResult, error) {
+	var results []RotationResult
+	for _, expiring := range p.Expiring {
+		result, err := rotateCertificate(expiring, opts, teamId, myacinfo)
+		if err != nil {
+			return results, fmt.Errorf("rotate certificate %s: %v", expiring.Certificate.Id, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func rotateCertificate(expiring ExpiringCertificate, opts RotationOptions, teamId, myacinfo string) (RotationResult, error) {
+	result := RotationResult{Old: expiring.Certificate}
+
+	provision := opts.ProvisionOptions
+	if provision.CertificateType == "" {
+		provision.CertificateType = expiring.Info.CertificateType
+	}
+	identity, err := ProvisionCertificate(provision, teamId, myacinfo)
+	if err != nil {
+		return result, err
+	}
+	result.Replacement = identity
+
+	for _, profile := range expiring.Profiles {
+		spec, err := GetProfileSpec(profile, teamId, myacinfo)
+		if err != nil {
+			return result, err
+		}
+		certs := []string{identity.Certificate.Id}
+		for _, id := range spec.Certs {
+			if id != expiring.Certificate.Id && id != identity.Certificate.Id {
+				certs = append(certs, id)
+			}
+		}
+		spec.Certs = certs
+		regen, err := spec.Regen(teamId, myacinfo)
+		if err != nil {
+			return result, err
+		}
+		result.Profiles = append(result.Profiles, regen)
+	}
+
+	if opts.Revoke {
+		if _, err := DeleteCertficate(expiring.Certificate.Id, teamId, myacinfo); err != nil {
+			return result, err
+		}
+		result.Revoked = true
+	}
+	return result, nil
+}
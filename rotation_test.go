@@ -0,0 +1,172 @@
+package apple
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRotationAPI team with certificates expiring in 5, 20 and 200 days over two pages,
+// CERT1 and CERT3 in PROF1, CERT2 in PROF2, CERT3 in PROF3 and a profile which can not be read
+func testRotationAPI(t *testing.T) *fakeDeveloperAPI {
+	now := time.Now()
+	cert1 := testAPICertificate(t, "CERT1", now.Add(5*24*time.Hour))
+	cert2 := testAPICertificate(t, "CERT2", now.Add(20*24*time.Hour))
+	cert3 := testAPICertificate(t, "CERT3", now.Add(200*24*time.Hour))
+	signer := newTestIdentity(t, AppleProfileSigningCommonName, nil)
+
+	unreadable := ProfileData{Stype: "profiles", Id: "PROF4", Attributes: map[string]string{"profileContent": "garbage"}}
+	api := &fakeDeveloperAPI{
+		t:        t,
+		pageSize: 2,
+		certs:    []CertificateData{cert2, cert3, cert1},
+		profiles: []ProfileData{
+			testAPIProfile(t, signer, "PROF1", "IOS_APP_DEVELOPMENT", "IOS", []string{"udid1"}, cert1, cert3),
+			testAPIProfile(t, signer, "PROF2", "IOS_APP_ADHOC", "IOS", nil, cert2),
+			testAPIProfile(t, signer, "PROF3", "IOS_APP_STORE", "IOS", nil, cert3),
+			unreadable,
+		},
+		apps: []AppId{
+			{AppIDID: "APP0", Prefix: "TEAMID1234", Identifier: "com.widuu.other"},
+			{AppIDID: "APP1", Prefix: "TEAMID1234", Identifier: "com.widuu.app"},
+		},
+		devices: []map[string]string{
+			{"deviceId": "DEV1", "deviceNumber": "udid1", "devicePlatform": "ios", "status": "c"},
+		},
+	}
+	api.serve()
+	return api
+}
+
+func planIds(plan RotationPlan) (certs, profiles []string) {
+	for _, e := range plan.Expiring {
+		certs = append(certs, e.Certificate.Id)
+		var ids []string
+		for _, p := range e.Profiles {
+			ids = append(ids, p.Id)
+		}
+		profiles = append(profiles, strings.Join(ids, ","))
+	}
+	return certs, profiles
+}
+
+func TestPlanCertificateRotation(t *testing.T) {
+	testRotationAPI(t)
+	tests := []struct {
+		window   time.Duration
+		certs    []string
+		profiles []string
+	}{
+		{24 * time.Hour, nil, nil},
+		{10 * 24 * time.Hour, []string{"CERT1"}, []string{"PROF1"}},
+		{30 * 24 * time.Hour, []string{"CERT1", "CERT2"}, []string{"PROF1", "PROF2"}},
+		// the last certificate and profiles are on the second page
+		{365 * 24 * time.Hour, []string{"CERT1", "CERT2", "CERT3"}, []string{"PROF1", "PROF2", "PROF1,PROF3"}},
+	}
+	for _, tt := range tests {
+		plan, err := PlanCertificateRotation(tt.window, "TEAMID1234", "session")
+		if err != nil {
+			t.Fatal(err)
+		}
+		certs, profiles := planIds(plan)
+		if plan.Window != tt.window || !reflect.DeepEqual(certs, tt.certs) || !reflect.DeepEqual(profiles, tt.profiles) {
+			t.Errorf("window %v: expiring %v in %v, want %v in %v", tt.window, certs, profiles, tt.certs, tt.profiles)
+		}
+		for _, e := range plan.Expiring {
+			if e.Info.CommonName != "Apple Development: "+e.Certificate.Id || e.Info.CertificateType != "DEVELOPMENT" {
+				t.Errorf("%s: Info = %+v", e.Certificate.Id, e.Info)
+			}
+		}
+	}
+}
+
+func TestPlanCertificateRotationEmptyTeam(t *testing.T) {
+	(&fakeDeveloperAPI{t: t, pageSize: 2}).serve()
+	plan, err := PlanCertificateRotation(DefaultExpiryWindow, "TEAMID1234", "session")
+	if err != nil || len(plan.Expiring) != 0 {
+		t.Errorf("plan %+v, %v", plan, err)
+	}
+}
+
+func TestRotationPlanExecute(t *testing.T) {
+	for _, revoke := range []bool{false, true} {
+		api := testRotationAPI(t)
+		plan, err := PlanCertificateRotation(30*24*time.Hour, "TEAMID1234", "session")
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := RotationOptions{ProvisionOptions: testProvisionOptions(NewMemoryKeyStore()), Revoke: revoke}
+		opts.CertificateType = ""
+		results, err := plan.Execute(opts, "TEAMID1234", "session")
+		if err != nil {
+			t.Fatalf("revoke %v: %v", revoke, err)
+		}
+		if len(results) != 2 {
+			t.Fatalf("revoke %v: %d results", revoke, len(results))
+		}
+		for i, want := range []struct{ old, replacement, profile string }{{"CERT1", "NEW1", "PROF1"}, {"CERT2", "NEW2", "PROF2"}} {
+			res := results[i]
+			if res.Old.Id != want.old || res.Replacement.Certificate.Id != want.replacement || res.Revoked != revoke {
+				t.Errorf("result %d: old %s replacement %s revoked %v", i, res.Old.Id, res.Replacement.Certificate.Id, res.Revoked)
+			}
+			if len(res.Profiles) != 1 || res.Profiles[0].ProvisioningProfileId != want.profile {
+				t.Errorf("result %d: profiles %+v", i, res.Profiles)
+			}
+		}
+
+		// the replacement takes the place of the old certificate, the other certificates and devices stay
+		want := []createProfileRequest{
+			{ProvisioningProfileID: "PROF1", BundleId: "APP1", DistributionType: "limited", Certs: []string{"NEW1", "CERT3"}, Devices: []string{"DEV1"}},
+			{ProvisioningProfileID: "PROF2", BundleId: "APP1", DistributionType: "adhoc", Certs: []string{"NEW2"}, Devices: []string{}},
+		}
+		if len(api.regens) != len(want) {
+			t.Fatalf("revoke %v: %d profiles regenerated", revoke, len(api.regens))
+		}
+		for i, req := range api.regens {
+			got := createProfileRequest{
+				ProvisioningProfileID: req.ProvisioningProfileID,
+				BundleId:              req.BundleId,
+				DistributionType:      req.DistributionType,
+				Certs:                 req.Certs,
+				Devices:               req.Devices,
+			}
+			if !reflect.DeepEqual(got, want[i]) || req.ProvisioningProfileName != want[i].ProvisioningProfileID {
+				t.Errorf("revoke %v: regen %+v, want %+v", revoke, req, want[i])
+			}
+		}
+
+		var wantDeleted []string
+		if revoke {
+			wantDeleted = []string{"certificates/CERT1", "certificates/CERT2"}
+		}
+		if !reflect.DeepEqual(api.deleted, wantDeleted) {
+			t.Errorf("revoke %v: deleted %v", revoke, api.deleted)
+		}
+	}
+}
+
+func TestRotationPlanExecuteFails(t *testing.T) {
+	api := testRotationAPI(t)
+	plan, err := PlanCertificateRotation(30*24*time.Hour, "TEAMID1234", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := RotationOptions{ProvisionOptions: testProvisionOptions(NewMemoryKeyStore()), Revoke: true}
+
+	api.createError = "Invalid CSR"
+	results, err := plan.Execute(opts, "TEAMID1234", "session")
+	if err == nil || err.Error() != "rotate certificate CERT1: Invalid CSR" || len(results) != 0 {
+		t.Errorf("create fails: %d results, error %v", len(results), err)
+	}
+
+	// the old certificate is kept when its profiles are not regenerated
+	api.createError, api.regenError = "", "Profile is locked"
+	results, err = plan.Execute(opts, "TEAMID1234", "session")
+	if err == nil || err.Error() != "rotate certificate CERT1: Profile is locked" || len(results) != 0 {
+		t.Errorf("regen fails: %d results, error %v", len(results), err)
+	}
+	if len(api.deleted) != 0 {
+		t.Errorf("deleted %v", api.deleted)
+	}
+}
@@ -0,0 +1,109 @@
+package apple
+
+import (
+	"strings"
+)
+
+// ProfileSyncResult device sync of one profile
+type ProfileSyncResult struct {
+	Profile ProfileData
+	// Added device ids added to the profile
+	Added       []string
+	Regenerated bool
+	// Updated the regenerated profile, or the current one when nothing changed
+	Updated ProvisioningProfile
+}
+
+// deviceEnabled report whether the listDevices entry is enabled
+func deviceEnabled(device map[string]string) bool {
+	switch strings.ToLower(device["status"]) {
+	case "", "c", "enabled":
+		return true
+	}
+	return false
+}
+
+// devicePlatform return the listDevices devicePlatform of a profile platform, IOS or MAC_OS,
+// ok is false for the platforms whose devices are not synced such as TV_OS and WATCH_OS
+func devicePlatform(profilePlatform string) (platform string, ok bool) {
+	switch strings.ToUpper(profilePlatform) {
+	case "IOS":
+		return "ios", true
+	case "MAC_OS", "MACOS":
+		return "mac", true
+	}
+	return "", false
+}
+
+// SyncProfileDevices make every development and ad-hoc profile in profileIds contain all enabled
+// devices of its platform, an empty profileIds syncs every development and ad-hoc profile;
+// profiles of platforms other than iOS and macOS are skipped and only profiles whose device
+// set changed are regenerated
+func SyncProfileDevices(profileIds []string, teamId, myacinfo string) ([]ProfileSyncResult, error) {
+	var profiles []ProfileData
+	if len(profileIds) == 0 {
+		list, err := listAllProfiles(teamId, myacinfo)
+		if err != nil {
+			return nil, err
+		}
+		profiles = list
+	} else {
+		for _, id := range profileIds {
+			list, err := ProfileLists(map[string]string{"id": id, "limit": "1"}, teamId, myacinfo)
+			if err != nil {
+				return nil, err
+			}
+			profiles = append(profiles, list[0])
+		}
+	}
+
+	resolver := newProfileResolver(teamId, myacinfo)
+	var results []ProfileSyncResult
+	for _, profile := range profiles {
+		switch DistributionType(profile.Attributes["profileType"]) {
+		case "limited", "adhoc":
+		default:
+			continue
+		}
+		platform, ok := devicePlatform(profile.Attributes["platform"])
+		if !ok {
+			continue
+		}
+
+		spec, err := resolver.spec(profile)
+		if err != nil {
+			return results, err
+		}
+
+		result := ProfileSyncResult{Profile: profile}
+		current := make(map[string]bool, len(spec.Devices))
+		for _, id := range spec.Devices {
+			current[id] = true
+		}
+		for _, device := range resolver.devices {
+			id := device["deviceId"]
+			if current[id] || !deviceEnabled(device) {
+				continue
+			}
+			if p := device["devicePlatform"]; p != "" && !strings.EqualFold(p, platform) {
+				continue
+			}
+			current[id] = true
+			spec.Devices = append(spec.Devices, id)
+			result.Added = append(result.Added, id)
+		}
+
+		if len(result.Added) == 0 {
+			result.Updated = profile.ToProvisioningProfile()
+			results = append(results, result)
+			continue
+		}
+		result.Updated, err = spec.Regen(teamId, myacinfo)
+		if err != nil {
+			return results, err
+		}
+		result.Regenerated = true
+		results = append(results, result)
+	}
+	return results, nil
+}
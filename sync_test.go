@@ -0,0 +1,116 @@
+package apple
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeviceEnabled(t *testing.T) {
+	for status, want := range map[string]bool{"": true, "c": true, "ENABLED": true, "r": false, "disabled": false} {
+		if got := deviceEnabled(map[string]string{"status": status}); got != want {
+			t.Errorf("deviceEnabled(%q) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestDevicePlatform(t *testing.T) {
+	tests := []struct {
+		profile, device string
+		ok              bool
+	}{
+		{"IOS", "ios", true},
+		{"ios", "ios", true},
+		{"MAC_OS", "mac", true},
+		{"TV_OS", "", false},
+		{"WATCH_OS", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if device, ok := devicePlatform(tt.profile); device != tt.device || ok != tt.ok {
+			t.Errorf("devicePlatform(%q) = %q, %v, want %q, %v", tt.profile, device, ok, tt.device, tt.ok)
+		}
+	}
+}
+
+// testSyncAPI team with profiles of each type and platform, the devices are over two pages
+func testSyncAPI(t *testing.T) *fakeDeveloperAPI {
+	cert := testAPICertificate(t, "CERT1", time.Now().AddDate(1, 0, 0))
+	signer := newTestIdentity(t, AppleProfileSigningCommonName, nil)
+	api := &fakeDeveloperAPI{
+		t:        t,
+		pageSize: 2,
+		certs:    []CertificateData{cert},
+		profiles: []ProfileData{
+			testAPIProfile(t, signer, "PROF1", "IOS_APP_DEVELOPMENT", "IOS", []string{"udid1"}, cert),
+			testAPIProfile(t, signer, "PROF2", "IOS_APP_ADHOC", "IOS", []string{"udid1", "udid2", "udid5"}, cert),
+			testAPIProfile(t, signer, "PROF3", "IOS_APP_STORE", "IOS", nil, cert),
+			testAPIProfile(t, signer, "PROF4", "MAC_APP_DEVELOPMENT", "MAC_OS", nil, cert),
+			testAPIProfile(t, signer, "PROF5", "TVOS_APP_DEVELOPMENT", "TV_OS", nil, cert),
+		},
+		apps: []AppId{{AppIDID: "APP1", Prefix: "TEAMID1234", Identifier: "com.widuu.app"}},
+		devices: []map[string]string{
+			{"deviceId": "DEV1", "deviceNumber": "udid1", "devicePlatform": "ios", "status": "c"},
+			{"deviceId": "DEV2", "deviceNumber": "udid2", "devicePlatform": "ios", "status": "c"},
+			{"deviceId": "DEV3", "deviceNumber": "udid3", "devicePlatform": "ios", "status": "r"},
+			{"deviceId": "DEV4", "deviceNumber": "udid4", "devicePlatform": "mac", "status": "c"},
+			{"deviceId": "DEV5", "deviceNumber": "udid5", "devicePlatform": "ios"},
+		},
+	}
+	api.serve()
+	return api
+}
+
+func TestSyncProfileDevices(t *testing.T) {
+	api := testSyncAPI(t)
+	results, err := SyncProfileDevices(nil, "TEAMID1234", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the store and tvOS profiles are skipped, disabled devices and devices of another platform are not added
+	want := []struct {
+		profile     string
+		added       []string
+		regenerated bool
+	}{
+		{"PROF1", []string{"DEV2", "DEV5"}, true},
+		{"PROF2", nil, false},
+		{"PROF4", []string{"DEV4"}, true},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("%d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		res := results[i]
+		if res.Profile.Id != w.profile || !reflect.DeepEqual(res.Added, w.added) || res.Regenerated != w.regenerated {
+			t.Errorf("result %d: %s added %v regenerated %v, want %s %v %v", i, res.Profile.Id, res.Added, res.Regenerated, w.profile, w.added, w.regenerated)
+		}
+		if res.Updated.ProvisioningProfileId != w.profile {
+			t.Errorf("result %d: updated %+v", i, res.Updated)
+		}
+	}
+	if len(api.regens) != 2 {
+		t.Fatalf("%d profiles regenerated", len(api.regens))
+	}
+	if req := api.regens[0]; req.ProvisioningProfileID != "PROF1" || !reflect.DeepEqual(req.Devices, []string{"DEV1", "DEV2", "DEV5"}) {
+		t.Errorf("regen %s devices %v", req.ProvisioningProfileID, req.Devices)
+	}
+	if req := api.regens[1]; req.ProvisioningProfileID != "PROF4" || !reflect.DeepEqual(req.Devices, []string{"DEV4"}) {
+		t.Errorf("regen %s devices %v", req.ProvisioningProfileID, req.Devices)
+	}
+}
+
+func TestSyncProfileDevicesIds(t *testing.T) {
+	api := testSyncAPI(t)
+	results, err := SyncProfileDevices([]string{"PROF2", "PROF5"}, "TEAMID1234", "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Profile.Id != "PROF2" || results[0].Regenerated || len(api.regens) != 0 {
+		t.Errorf("results %+v, %d profiles regenerated", results, len(api.regens))
+	}
+	if _, err := SyncProfileDevices([]string{"MISSING"}, "TEAMID1234", "session"); err != ErrProfileNotFound {
+		t.Errorf("error = %v, want ErrProfileNotFound", err)
+	}
+}